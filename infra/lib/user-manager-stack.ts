@@ -5,6 +5,8 @@ import * as dynamodb from 'aws-cdk-lib/aws-dynamodb';
 import * as lambda from 'aws-cdk-lib/aws-lambda';
 import { RestApi, LambdaIntegration } from 'aws-cdk-lib/aws-apigateway';
 import * as iam from 'aws-cdk-lib/aws-iam';
+import * as events from 'aws-cdk-lib/aws-events';
+import * as targets from 'aws-cdk-lib/aws-events-targets';
 
 export class UserManagerStack extends cdk.Stack {
   constructor(scope: Construct, id: string, props?: cdk.StackProps) {
@@ -52,10 +54,96 @@ export class UserManagerStack extends cdk.Stack {
           partitionKey: { name: 'email', type: dynamodb.AttributeType.STRING },
           projectionType: dynamodb.ProjectionType.ALL,
         },
+        {
+          // No longer queried; drop it in a later deploy, once email keys are backfilled
+          indexName: 'tenant-email-index',
+          partitionKey: { name: 'tenant_id', type: dynamodb.AttributeType.STRING },
+          sortKey: { name: 'email', type: dynamodb.AttributeType.STRING },
+          projectionType: dynamodb.ProjectionType.ALL,
+        },
+        {
+          indexName: 'tenant-email-key-index',
+          partitionKey: { name: 'tenant_id', type: dynamodb.AttributeType.STRING },
+          sortKey: { name: 'email_key', type: dynamodb.AttributeType.STRING },
+          projectionType: dynamodb.ProjectionType.ALL,
+        },
+        {
+          indexName: 'tenant-created-index',
+          partitionKey: { name: 'tenant_id', type: dynamodb.AttributeType.STRING },
+          sortKey: { name: 'created_at', type: dynamodb.AttributeType.STRING },
+          projectionType: dynamodb.ProjectionType.ALL,
+        },
       ],
     });
     usersTable.grantReadWriteData(appLambda);
 
+    // One item per (tenant, email), written in the same transaction as the user to keep emails unique
+    const emailLocksTable = new dynamodb.TableV2(this, 'UserManagerEmailLocksTable', {
+      tableName: 'user_email_locks',
+      partitionKey: { name: 'email_key', type: dynamodb.AttributeType.STRING },
+      billing: dynamodb.Billing.onDemand(),
+    });
+    emailLocksTable.grantReadWriteData(appLambda);
+
+    const organizationsTable = new dynamodb.TableV2(this, 'UserManagerOrganizationsTable', {
+      tableName: 'organizations',
+      partitionKey: { name: 'id', type: dynamodb.AttributeType.STRING },
+      billing: dynamodb.Billing.onDemand(),
+    });
+    organizationsTable.grantReadWriteData(appLambda);
+
+    const invitationsTable = new dynamodb.TableV2(this, 'UserManagerInvitationsTable', {
+      tableName: 'invitations',
+      partitionKey: { name: 'id', type: dynamodb.AttributeType.STRING },
+      billing: dynamodb.Billing.onDemand(),
+    });
+    invitationsTable.grantReadWriteData(appLambda);
+
+    const auditEventsTable = new dynamodb.TableV2(this, 'UserManagerAuditEventsTable', {
+      tableName: 'audit_events',
+      partitionKey: { name: 'id', type: dynamodb.AttributeType.STRING },
+      billing: dynamodb.Billing.onDemand(),
+      globalSecondaryIndexes: [
+        {
+          indexName: 'subject-index',
+          partitionKey: { name: 'subject_id', type: dynamodb.AttributeType.STRING },
+          sortKey: { name: 'occurred_at', type: dynamodb.AttributeType.STRING },
+          projectionType: dynamodb.ProjectionType.ALL,
+        },
+      ],
+    });
+    auditEventsTable.grantReadWriteData(appLambda);
+
+    // Responses replayed for retries with an Idempotency-Key; DynamoDB deletes them once expired
+    const idempotencyKeysTable = new dynamodb.TableV2(this, 'UserManagerIdempotencyKeysTable', {
+      tableName: 'idempotency_keys',
+      partitionKey: { name: 'key', type: dynamodb.AttributeType.STRING },
+      billing: dynamodb.Billing.onDemand(),
+      timeToLiveAttribute: 'expires_at',
+    });
+    idempotencyKeysTable.grantReadWriteData(appLambda);
+
+    // Purge job: hard-deletes users deactivated longer than the retention window, once a day
+    const purgeLambda = new lambda.Function(this, 'UserManagerPurgeHandler', {
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      handler: 'bootstrap',
+      code: lambda.Code.fromAsset(path.join(__dirname, '../../lambdas/dist/purge')),
+      architecture: lambda.Architecture.ARM_64,
+      memorySize: 256,
+      timeout: cdk.Duration.minutes(5),
+      environment: {
+        APP_ENV: 'production',
+        DB_BACKEND: 'dynamodb',
+      },
+    });
+    usersTable.grantReadWriteData(purgeLambda);
+    emailLocksTable.grantReadWriteData(purgeLambda);
+    auditEventsTable.grantReadWriteData(purgeLambda);
+    new events.Rule(this, 'UserManagerPurgeSchedule', {
+      schedule: events.Schedule.cron({ minute: '0', hour: '3' }),
+      targets: [new targets.LambdaFunction(purgeLambda)],
+    });
+
     // SES 
     appLambda.addToRolePolicy(new iam.PolicyStatement({
       actions: ['ses:SendEmail', 'ses:SendRawEmail'],
@@ -66,8 +154,8 @@ export class UserManagerStack extends cdk.Stack {
     const api = new RestApi(this, 'UserManagerApi', {
       defaultCorsPreflightOptions: {
         allowOrigins: ['*'],
-        allowMethods: ['OPTIONS', 'GET', 'POST', 'PUT', 'DELETE'],
-        allowHeaders: ['Content-Type', 'Authorization'],
+        allowMethods: ['OPTIONS', 'GET', 'POST', 'PUT', 'PATCH', 'DELETE'],
+        allowHeaders: ['Content-Type', 'Authorization', 'If-Match', 'Idempotency-Key'],
         allowCredentials: false,
       },
     });
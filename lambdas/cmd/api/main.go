@@ -1,26 +1,70 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
 	"strings"
 
-	"github.com/danilobml/user-manager/internal/config"
+	app_config "github.com/danilobml/user-manager/internal/config"
+	"github.com/danilobml/user-manager/internal/ddb"
+	"github.com/danilobml/user-manager/internal/errs"
 	"github.com/danilobml/user-manager/internal/httpx/middleware"
 
 	"github.com/danilobml/user-manager/internal/httpx"
 	mail_service "github.com/danilobml/user-manager/internal/mailer/service"
+	"github.com/danilobml/user-manager/internal/postgres"
 	"github.com/danilobml/user-manager/internal/routes"
+	"github.com/danilobml/user-manager/internal/sqlite"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
 	user_handler "github.com/danilobml/user-manager/internal/user/handler"
 	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/profile"
 	user_repository "github.com/danilobml/user-manager/internal/user/repository"
 	user_service "github.com/danilobml/user-manager/internal/user/service"
 )
 
 func main() {
-	config := config.LoadConfig()
+	config := app_config.LoadConfig()
 
 	jwtManager := jwt.NewJwtManager([]byte(config.App.JwtSecret))
 
-	userRepository := user_repository.NewUserRepositoryInMemory()
+	var userRepository user_repository.UserRepository
+	var organizationRepository user_repository.OrganizationRepository = user_repository.NewOrganizationRepositoryInMemory()
+	var auditRepository user_repository.AuditRepository = user_repository.NewAuditRepositoryInMemory()
+	var invitationRepository user_repository.InvitationRepository = user_repository.NewInvitationRepositoryInMemory()
+	var idempotencyRepository user_repository.IdempotencyRepository = user_repository.NewIdempotencyRepositoryInMemory()
+	var emailKeyBackfiller user_repository.EmailKeyBackfiller
+
+	switch config.Database.Backend {
+	case "", app_config.BackendMemory:
+		userRepository = user_repository.NewUserRepositoryInMemory()
+	case app_config.BackendDynamoDB:
+		ddbClient := ddb.InitDynamo()
+		userRepository = user_repository.NewUserRepositoryDdb(ddbClient)
+		organizationRepository = user_repository.NewOrganizationRepositoryDdb(ddbClient)
+		auditRepository = user_repository.NewAuditRepositoryDdb(ddbClient)
+		invitationRepository = user_repository.NewInvitationRepositoryDdb(ddbClient)
+		idempotencyRepository = user_repository.NewIdempotencyRepositoryDdb(ddbClient)
+	case app_config.BackendPostgres:
+		db := postgres.InitPostgres(config.Database.PostgresDSN)
+		postgresUsers := user_repository.NewUserRepositoryPostgres(db)
+		userRepository, emailKeyBackfiller = postgresUsers, postgresUsers
+		organizationRepository = user_repository.NewOrganizationRepositoryPostgres(db)
+		auditRepository = user_repository.NewAuditRepositoryPostgres(db)
+		invitationRepository = user_repository.NewInvitationRepositoryPostgres(db)
+		idempotencyRepository = user_repository.NewIdempotencyRepositoryPostgres(db)
+	case app_config.BackendSQLite:
+		db := sqlite.InitSQLite(config.Database.SQLitePath)
+		sqliteUsers := user_repository.NewUserRepositorySQLite(db)
+		userRepository, emailKeyBackfiller = sqliteUsers, sqliteUsers
+		organizationRepository = user_repository.NewOrganizationRepositorySQLite(db)
+		auditRepository = user_repository.NewAuditRepositorySQLite(db)
+		invitationRepository = user_repository.NewInvitationRepositorySQLite(db)
+		idempotencyRepository = user_repository.NewIdempotencyRepositorySQLite(db)
+	default:
+		log.Fatalf("unknown database backend %q", config.Database.Backend)
+	}
 
 	mailService := mail_service.NewLocalMailService(mail_service.LocalMailConfig{
 		FromEmail:     config.Mail.FromEmail,
@@ -29,12 +73,51 @@ func main() {
 		SMTPAddr:      config.Mail.SMTPAddr,
 	})
 
-	userService := user_service.NewUserserviceImpl(userRepository, jwtManager, mailService, config.App.BaseUrl)
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{
+		StripPlusTags: config.Email.StripPlusTags,
+		ProviderRules: config.Email.ProviderRules,
+	})
+	// SQL migrations can only lowercase emails, so the keys are rebuilt with the configured rules once migrated
+	if emailKeyBackfiller != nil {
+		report, err := emailKeyBackfiller.BackfillEmailKeys(context.Background(), emailNormalizer.Key, false)
+		if err != nil {
+			log.Printf("email key backfill failed: %v", err)
+		}
+		if len(report.Collisions) > 0 {
+			log.Printf("email key backfill: %d users need their email resolved by hand, see cmd/migrate-email-keys", len(report.Collisions))
+		}
+	}
+	lifecycle := user_service.Lifecycle{
+		RestoreGracePeriod: config.Lifecycle.RestoreGracePeriod,
+		PurgeRetention:     config.Lifecycle.PurgeRetention,
+	}
+	profileSchemas, err := profile.ParseSchemas(config.Profile.Schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+	userService := user_service.NewUserserviceImpl(userRepository, organizationRepository, auditRepository, jwtManager, mailService, config.App.BaseUrl, emailNormalizer, lifecycle, profileSchemas)
+	if config.Bootstrap.AdminEmail != "" {
+		err := userService.BootstrapAdmin(context.Background(), strings.TrimSpace(config.Bootstrap.AdminEmail), config.Bootstrap.AdminPassword)
+		if err != nil && !errors.Is(err, errs.ErrAlreadyBootstrapped) {
+			log.Printf("admin bootstrap failed: %v", err)
+		}
+	}
+
+	organizationService := user_service.NewOrganizationServiceImpl(organizationRepository, userRepository, emailNormalizer)
+	invitationService := user_service.NewInvitationServiceImpl(invitationRepository, organizationRepository, userRepository, jwtManager, mailService, config.App.BaseUrl, emailNormalizer)
 	userHandler := user_handler.NewUserHandler(userService, strings.TrimSpace(config.App.ApiKey))
+	organizationHandler := user_handler.NewOrganizationHandler(organizationService)
+	invitationHandler := user_handler.NewInvitationHandler(invitationService)
+	bulkHandler := user_handler.NewBulkHandler(user_service.NewBulkServiceImpl(userRepository, invitationService, emailNormalizer, profileSchemas))
+
+	authMiddleware := middleware.ApplyMiddlewares(
+		middleware.Authenticate(jwtManager),
+		middleware.AuditImpersonation(auditRepository),
+	)
 
-	authMiddleware := middleware.Authenticate(jwtManager)
+	idempotencyMiddleware := middleware.Idempotency(idempotencyRepository, config.Idempotency.TTL)
 
-	router := routes.NewRouter(userHandler, authMiddleware)
+	router := routes.NewRouter(userHandler, organizationHandler, invitationHandler, bulkHandler, authMiddleware, idempotencyMiddleware)
 
 	httpx.Serve(config.App.Port, &router)
 }
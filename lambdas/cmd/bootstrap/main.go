@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/danilobml/user-manager/internal/config"
+	"github.com/danilobml/user-manager/internal/ddb"
+	"github.com/danilobml/user-manager/internal/errs"
+	mail_service "github.com/danilobml/user-manager/internal/mailer/service"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/jwt"
+	user_repository "github.com/danilobml/user-manager/internal/user/repository"
+	user_service "github.com/danilobml/user-manager/internal/user/service"
+)
+
+// Creates the first platform admin in DynamoDB. Flags default to the bootstrap config values.
+func main() {
+	cfg := config.LoadConfig()
+
+	email := flag.String("email", cfg.Bootstrap.AdminEmail, "email of the first admin")
+	password := flag.String("password", cfg.Bootstrap.AdminPassword, "password of the first admin")
+	flag.Parse()
+
+	jwtManager := jwt.NewJwtManager([]byte(cfg.App.JwtSecret))
+	ddbClient := ddb.InitDynamo()
+	userRepository := user_repository.NewUserRepositoryDdb(ddbClient)
+	organizationRepository := user_repository.NewOrganizationRepositoryDdb(ddbClient)
+	auditRepository := user_repository.NewAuditRepositoryDdb(ddbClient)
+	mailService := mail_service.NewLocalMailService(mail_service.LocalMailConfig{})
+
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{
+		StripPlusTags: cfg.Email.StripPlusTags,
+		ProviderRules: cfg.Email.ProviderRules,
+	})
+	lifecycle := user_service.Lifecycle{
+		RestoreGracePeriod: cfg.Lifecycle.RestoreGracePeriod,
+		PurgeRetention:     cfg.Lifecycle.PurgeRetention,
+	}
+	userService := user_service.NewUserserviceImpl(userRepository, organizationRepository, auditRepository, jwtManager, mailService, cfg.App.BaseUrl, emailNormalizer, lifecycle, nil)
+
+	err := userService.BootstrapAdmin(context.Background(), strings.TrimSpace(*email), strings.TrimSpace(*password))
+	if errors.Is(err, errs.ErrAlreadyBootstrapped) {
+		log.Println("an admin already exists, nothing to do")
+		return
+	}
+	if err != nil {
+		log.Fatalf("admin bootstrap failed: %v", err)
+	}
+
+	log.Printf("admin %s created", strings.TrimSpace(*email))
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/config"
+	"github.com/danilobml/user-manager/internal/ddb"
+	mail_service "github.com/danilobml/user-manager/internal/mailer/service"
+	"github.com/danilobml/user-manager/internal/postgres"
+	"github.com/danilobml/user-manager/internal/sqlite"
+	"github.com/danilobml/user-manager/internal/user/bulkio"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/profile"
+	"github.com/danilobml/user-manager/internal/user/model"
+	user_repository "github.com/danilobml/user-manager/internal/user/repository"
+	user_service "github.com/danilobml/user-manager/internal/user/service"
+)
+
+const usage = `usage:
+  bulk import -file users.csv [-format csv|jsonl] [-tenant <uuid>] [-dry-run] [-invite] [-invited-by <name>]
+  bulk export [-format csv|jsonl] [-tenant <uuid>] [-o users.csv]`
+
+// Imports users from, or exports them to, CSV and JSON Lines files. Runs against DynamoDB unless DB_BACKEND
+// says otherwise, without the size and time limits of the HTTP endpoints.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	cfg := config.LoadConfig()
+
+	switch os.Args[1] {
+	case "import":
+		runImport(cfg, os.Args[2:])
+	case "export":
+		runExport(cfg, os.Args[2:])
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func runImport(cfg config.AppConfig, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("file", "", "CSV or JSON Lines file to import")
+	formatName := flags.String("format", "", "csv or jsonl; guessed from the file extension if empty")
+	tenant := flags.String("tenant", model.DefaultTenantID.String(), "organization to import into")
+	dryRun := flags.Bool("dry-run", false, "validate and report without writing")
+	invite := flags.Bool("invite", false, "invite rows that have no password")
+	invitedBy := flags.String("invited-by", "An administrator", "inviter named in invitation emails")
+	flags.Parse(args)
+
+	if *file == "" {
+		log.Fatal(usage)
+	}
+	tenantID, err := uuid.Parse(*tenant)
+	if err != nil {
+		log.Fatalf("invalid tenant: %v", err)
+	}
+	format, err := bulkio.ParseFormat(formatFor(*formatName, *file))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	in, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+	rows, err := bulkio.NewRowReader(in, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bulkService, _ := buildBulkService(cfg)
+	report, err := bulkService.ImportTenantUsers(context.Background(), tenantID, *invitedBy, rows, dtos.ImportOptions{DryRun: *dryRun, Invite: *invite})
+	printReport(report)
+	if err != nil {
+		log.Fatalf("import stopped: %v", err)
+	}
+	if report.Invalid > 0 || report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runExport(cfg config.AppConfig, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := flags.String("format", "", "csv or jsonl; guessed from the output file extension if empty")
+	tenant := flags.String("tenant", "", "organization to export; every organization if empty")
+	output := flags.String("o", "", "output file; standard output if empty")
+	flags.Parse(args)
+
+	format, err := bulkio.ParseFormat(formatFor(*formatName, *output))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	ctx := context.Background()
+	bulkService, organizationRepository := buildBulkService(cfg)
+
+	tenantIDs := []uuid.UUID{model.DefaultTenantID}
+	if *tenant != "" {
+		tenantID, err := uuid.Parse(*tenant)
+		if err != nil {
+			log.Fatalf("invalid tenant: %v", err)
+		}
+		tenantIDs = []uuid.UUID{tenantID}
+	} else {
+		organizations, err := organizationRepository.List(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, organization := range organizations {
+			tenantIDs = append(tenantIDs, organization.ID)
+		}
+	}
+
+	writer := bulkio.NewUserWriter(out, format)
+	exported := 0
+	for _, tenantID := range tenantIDs {
+		err := bulkService.ExportTenantUsers(ctx, tenantID, func(user dtos.ResponseUser) error {
+			exported++
+			return writer.Write(user)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("exported %d users", exported)
+}
+
+// Defaults to DynamoDB like the Lambda.
+func buildBulkService(cfg config.AppConfig) (*user_service.BulkServiceImpl, user_repository.OrganizationRepository) {
+	var userRepository user_repository.UserRepository
+	var organizationRepository user_repository.OrganizationRepository
+	var invitationRepository user_repository.InvitationRepository
+
+	switch cfg.Database.Backend {
+	case "", config.BackendDynamoDB:
+		ddbClient := ddb.InitDynamo()
+		userRepository = user_repository.NewUserRepositoryDdb(ddbClient)
+		organizationRepository = user_repository.NewOrganizationRepositoryDdb(ddbClient)
+		invitationRepository = user_repository.NewInvitationRepositoryDdb(ddbClient)
+	case config.BackendPostgres:
+		db := postgres.InitPostgres(cfg.Database.PostgresDSN)
+		userRepository = user_repository.NewUserRepositoryPostgres(db)
+		organizationRepository = user_repository.NewOrganizationRepositoryPostgres(db)
+		invitationRepository = user_repository.NewInvitationRepositoryPostgres(db)
+	case config.BackendSQLite:
+		db := sqlite.InitSQLite(cfg.Database.SQLitePath)
+		userRepository = user_repository.NewUserRepositorySQLite(db)
+		organizationRepository = user_repository.NewOrganizationRepositorySQLite(db)
+		invitationRepository = user_repository.NewInvitationRepositorySQLite(db)
+	default:
+		log.Fatalf("bulk needs a persistent database backend, got %q", cfg.Database.Backend)
+	}
+
+	jwtManager := jwt.NewJwtManager([]byte(cfg.App.JwtSecret))
+	mailService := mail_service.NewLocalMailService(mail_service.LocalMailConfig{
+		FromEmail:     cfg.Mail.FromEmail,
+		FromEmailPass: cfg.Mail.FromEmailPass,
+		FromEmailSMTP: cfg.Mail.FromEmailSMTP,
+		SMTPAddr:      cfg.Mail.SMTPAddr,
+	})
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{
+		StripPlusTags: cfg.Email.StripPlusTags,
+		ProviderRules: cfg.Email.ProviderRules,
+	})
+
+	profileSchemas, err := profile.ParseSchemas(cfg.Profile.Schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	invitationService := user_service.NewInvitationServiceImpl(invitationRepository, organizationRepository, userRepository, jwtManager, mailService, cfg.App.BaseUrl, emailNormalizer)
+	return user_service.NewBulkServiceImpl(userRepository, invitationService, emailNormalizer, profileSchemas), organizationRepository
+}
+
+// Helpers
+func formatFor(format string, path string) string {
+	if format != "" {
+		return format
+	}
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+func printReport(report dtos.ImportReport) {
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+}
@@ -1,38 +1,85 @@
 package main
 
 import (
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
 
+	"context"
+	"errors"
+	"log"
 	"strings"
 
 	"github.com/danilobml/user-manager/internal/config"
 	"github.com/danilobml/user-manager/internal/ddb"
+	"github.com/danilobml/user-manager/internal/errs"
 	"github.com/danilobml/user-manager/internal/httpx/middleware"
 	mail_service "github.com/danilobml/user-manager/internal/mailer/service"
 	"github.com/danilobml/user-manager/internal/routes"
 	"github.com/danilobml/user-manager/internal/ses"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
 	user_handler "github.com/danilobml/user-manager/internal/user/handler"
 	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/profile"
 	user_repository "github.com/danilobml/user-manager/internal/user/repository"
 	user_service "github.com/danilobml/user-manager/internal/user/service"
 )
 
+// Kept across invocations of a warm Lambda; nil when caching is off.
+var userCache *user_repository.UserRepositoryCached
+
 func buildHandler() *httpadapter.HandlerAdapter {
 	cfg := config.LoadConfig()
 
 	jwtManager := jwt.NewJwtManager([]byte(cfg.App.JwtSecret))
 	ddbClient := ddb.InitDynamo()
-	userRepository := user_repository.NewUserRepositoryDdb(ddbClient)
+	var userRepository user_repository.UserRepository = user_repository.NewUserRepositoryDdb(ddbClient)
+	if cfg.Cache.UserTTL > 0 {
+		userCache = user_repository.NewUserRepositoryCached(userRepository, cfg.Cache.UserTTL, cfg.Cache.UserSize)
+		userRepository = userCache
+	}
+	organizationRepository := user_repository.NewOrganizationRepositoryDdb(ddbClient)
+	auditRepository := user_repository.NewAuditRepositoryDdb(ddbClient)
+	invitationRepository := user_repository.NewInvitationRepositoryDdb(ddbClient)
+	idempotencyRepository := user_repository.NewIdempotencyRepositoryDdb(ddbClient)
 
 	sesMailClient := ses.Ses_Init()
 	mailService := mail_service.NewSesMailService(sesMailClient, cfg.Mail.FromEmail)
 
-	userService := user_service.NewUserserviceImpl(userRepository, jwtManager, mailService, cfg.App.BaseUrl)
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{
+		StripPlusTags: cfg.Email.StripPlusTags,
+		ProviderRules: cfg.Email.ProviderRules,
+	})
+	lifecycle := user_service.Lifecycle{
+		RestoreGracePeriod: cfg.Lifecycle.RestoreGracePeriod,
+		PurgeRetention:     cfg.Lifecycle.PurgeRetention,
+	}
+	profileSchemas, err := profile.ParseSchemas(cfg.Profile.Schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+	userService := user_service.NewUserserviceImpl(userRepository, organizationRepository, auditRepository, jwtManager, mailService, cfg.App.BaseUrl, emailNormalizer, lifecycle, profileSchemas)
+	if cfg.Bootstrap.AdminEmail != "" {
+		err := userService.BootstrapAdmin(context.Background(), strings.TrimSpace(cfg.Bootstrap.AdminEmail), cfg.Bootstrap.AdminPassword)
+		if err != nil && !errors.Is(err, errs.ErrAlreadyBootstrapped) {
+			log.Printf("admin bootstrap failed: %v", err)
+		}
+	}
+
+	organizationService := user_service.NewOrganizationServiceImpl(organizationRepository, userRepository, emailNormalizer)
+	invitationService := user_service.NewInvitationServiceImpl(invitationRepository, organizationRepository, userRepository, jwtManager, mailService, cfg.App.BaseUrl, emailNormalizer)
 	userHandler := user_handler.NewUserHandler(userService, strings.TrimSpace(cfg.App.ApiKey))
+	organizationHandler := user_handler.NewOrganizationHandler(organizationService)
+	invitationHandler := user_handler.NewInvitationHandler(invitationService)
+	bulkHandler := user_handler.NewBulkHandler(user_service.NewBulkServiceImpl(userRepository, invitationService, emailNormalizer, profileSchemas))
+
+	authMiddleware := middleware.ApplyMiddlewares(
+		middleware.Authenticate(jwtManager),
+		middleware.AuditImpersonation(auditRepository),
+	)
+	idempotencyMiddleware := middleware.Idempotency(idempotencyRepository, cfg.Idempotency.TTL)
 
-	authMiddleware := middleware.Authenticate(jwtManager)
-	router := routes.NewRouter(userHandler, authMiddleware)
+	router := routes.NewRouter(userHandler, organizationHandler, invitationHandler, bulkHandler, authMiddleware, idempotencyMiddleware)
 
 	return httpadapter.New(router)
 }
@@ -40,5 +87,12 @@ func buildHandler() *httpadapter.HandlerAdapter {
 func main() {
 	adapter := buildHandler()
 
-	lambda.Start(adapter.ProxyWithContext)
+	lambda.Start(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		resp, err := adapter.ProxyWithContext(ctx, req)
+		if userCache != nil {
+			stats := userCache.Stats()
+			log.Printf("User cache: Hits: %d, Misses: %d, Evictions: %d, Size: %d", stats.Hits, stats.Misses, stats.Evictions, stats.Size)
+		}
+		return resp, err
+	})
 }
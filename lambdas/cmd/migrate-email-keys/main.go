@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/danilobml/user-manager/internal/config"
+	"github.com/danilobml/user-manager/internal/ddb"
+	"github.com/danilobml/user-manager/internal/postgres"
+	"github.com/danilobml/user-manager/internal/sqlite"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	user_repository "github.com/danilobml/user-manager/internal/user/repository"
+)
+
+// Backfills normalized email keys for existing users, and on DynamoDB the default tenant_id of users created
+// before organizations. Run it after deploying the email key index or SQL migration 0004, and again whenever
+// the email normalization rules change.
+func main() {
+	cfg := config.LoadConfig()
+
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{
+		StripPlusTags: cfg.Email.StripPlusTags,
+		ProviderRules: cfg.Email.ProviderRules,
+	})
+
+	report, err := buildBackfiller(cfg).BackfillEmailKeys(context.Background(), emailNormalizer.Key, *dryRun)
+	if err != nil {
+		log.Fatalf("email key backfill failed: %v", err)
+	}
+
+	verb := "updated"
+	if *dryRun {
+		verb = "would update"
+	}
+	log.Printf("scanned %d users, %s %d", report.Scanned, verb, report.Updated)
+	for _, id := range report.Collisions {
+		log.Printf("user %s: normalized email is taken by another user, left unchanged", id)
+	}
+	if len(report.Collisions) > 0 {
+		log.Fatalf("%d users need their email resolved by hand", len(report.Collisions))
+	}
+}
+
+// Defaults to DynamoDB like the Lambda. The SQL backends are migrated first.
+func buildBackfiller(cfg config.AppConfig) user_repository.EmailKeyBackfiller {
+	switch cfg.Database.Backend {
+	case "", config.BackendDynamoDB:
+		return user_repository.NewUserRepositoryDdb(ddb.InitDynamo())
+	case config.BackendPostgres:
+		return user_repository.NewUserRepositoryPostgres(postgres.InitPostgres(cfg.Database.PostgresDSN))
+	case config.BackendSQLite:
+		return user_repository.NewUserRepositorySQLite(sqlite.InitSQLite(cfg.Database.SQLitePath))
+	default:
+		log.Fatalf("migrate-email-keys needs a persistent database backend, got %q", cfg.Database.Backend)
+		return nil
+	}
+}
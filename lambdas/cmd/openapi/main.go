@@ -0,0 +1,17 @@
+// Prints the OpenAPI document for the route table; `make openapi` writes it to api/openapi.json.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/danilobml/user-manager/internal/routes"
+)
+
+func main() {
+	spec, err := routes.OpenAPI()
+	if err != nil {
+		log.Fatalf("openapi: %v", err)
+	}
+	os.Stdout.Write(spec)
+}
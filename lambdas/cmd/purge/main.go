@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/danilobml/user-manager/internal/config"
+	"github.com/danilobml/user-manager/internal/ddb"
+	mail_service "github.com/danilobml/user-manager/internal/mailer/service"
+	"github.com/danilobml/user-manager/internal/postgres"
+	"github.com/danilobml/user-manager/internal/sqlite"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/jwt"
+	user_repository "github.com/danilobml/user-manager/internal/user/repository"
+	user_service "github.com/danilobml/user-manager/internal/user/service"
+)
+
+// Hard-deletes users deactivated longer than the retention window. Runs once from the command line,
+// or as a Lambda on a schedule when started by the Lambda runtime.
+func main() {
+	cfg := config.LoadConfig()
+	userService := buildUserService(cfg)
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+			return purge(ctx, userService)
+		})
+		return
+	}
+
+	if err := purge(context.Background(), userService); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func purge(ctx context.Context, userService *user_service.UserServiceImpl) error {
+	purged, err := userService.PurgeDeactivatedUsers(ctx, time.Now())
+	log.Printf("purged %d deactivated users", purged)
+	return err
+}
+
+// Defaults to DynamoDB like the Lambda.
+func buildUserService(cfg config.AppConfig) *user_service.UserServiceImpl {
+	var userRepository user_repository.UserRepository
+	var organizationRepository user_repository.OrganizationRepository
+	var auditRepository user_repository.AuditRepository
+
+	switch cfg.Database.Backend {
+	case "", config.BackendDynamoDB:
+		ddbClient := ddb.InitDynamo()
+		userRepository = user_repository.NewUserRepositoryDdb(ddbClient)
+		organizationRepository = user_repository.NewOrganizationRepositoryDdb(ddbClient)
+		auditRepository = user_repository.NewAuditRepositoryDdb(ddbClient)
+	case config.BackendPostgres:
+		db := postgres.InitPostgres(cfg.Database.PostgresDSN)
+		userRepository = user_repository.NewUserRepositoryPostgres(db)
+		organizationRepository = user_repository.NewOrganizationRepositoryPostgres(db)
+		auditRepository = user_repository.NewAuditRepositoryPostgres(db)
+	case config.BackendSQLite:
+		db := sqlite.InitSQLite(cfg.Database.SQLitePath)
+		userRepository = user_repository.NewUserRepositorySQLite(db)
+		organizationRepository = user_repository.NewOrganizationRepositorySQLite(db)
+		auditRepository = user_repository.NewAuditRepositorySQLite(db)
+	default:
+		log.Fatalf("purge needs a persistent database backend, got %q", cfg.Database.Backend)
+	}
+
+	jwtManager := jwt.NewJwtManager([]byte(cfg.App.JwtSecret))
+	mailService := mail_service.NewLocalMailService(mail_service.LocalMailConfig{})
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{
+		StripPlusTags: cfg.Email.StripPlusTags,
+		ProviderRules: cfg.Email.ProviderRules,
+	})
+	lifecycle := user_service.Lifecycle{
+		RestoreGracePeriod: cfg.Lifecycle.RestoreGracePeriod,
+		PurgeRetention:     cfg.Lifecycle.PurgeRetention,
+	}
+
+	return user_service.NewUserserviceImpl(userRepository, organizationRepository, auditRepository, jwtManager, mailService, cfg.App.BaseUrl, emailNormalizer, lifecycle, nil)
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type AppConfig struct {
 	App struct {
 		Port      string `mapstructure:"port"`
@@ -14,4 +16,51 @@ type AppConfig struct {
 		FromEmailSMTP string `mapstructure:"from_email_smtp"`
 		SMTPAddr      string `mapstructure:"smtp_addr"`
 	} `mapstructure:"mail"`
+
+	// Backend is memory (default), dynamodb, postgres or sqlite.
+	Database struct {
+		Backend     string `mapstructure:"backend"`
+		PostgresDSN string `mapstructure:"postgres_dsn"`
+		SQLitePath  string `mapstructure:"sqlite_path"`
+	} `mapstructure:"database"`
+
+	// Optional email normalization rules; lowercasing and Unicode normalization always apply.
+	Email struct {
+		StripPlusTags bool `mapstructure:"strip_plus_tags"`
+		ProviderRules bool `mapstructure:"provider_rules"`
+	} `mapstructure:"email"`
+
+	// In-process cache of user lookups, used by the Lambda. A TTL of 0 turns it off.
+	Cache struct {
+		UserTTL  time.Duration `mapstructure:"user_ttl"`
+		UserSize int           `mapstructure:"user_size"`
+	} `mapstructure:"cache"`
+
+	// Deactivated users can be restored during the grace period and are purged after the retention window.
+	Lifecycle struct {
+		RestoreGracePeriod time.Duration `mapstructure:"restore_grace_period"`
+		PurgeRetention     time.Duration `mapstructure:"purge_retention"`
+	} `mapstructure:"lifecycle"`
+
+	// JSON document of custom profile attributes, see profile.ParseSchemas. Empty means none.
+	Profile struct {
+		Schema string `mapstructure:"schema"`
+	} `mapstructure:"profile"`
+
+	// How long responses to requests sent with an Idempotency-Key are replayed.
+	Idempotency struct {
+		TTL time.Duration `mapstructure:"ttl"`
+	} `mapstructure:"idempotency"`
+
+	Bootstrap struct {
+		AdminEmail    string `mapstructure:"admin_email"`
+		AdminPassword string `mapstructure:"admin_password"`
+	} `mapstructure:"bootstrap"`
 }
+
+const (
+	BackendMemory   = "memory"
+	BackendDynamoDB = "dynamodb"
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+)
@@ -21,6 +21,25 @@ func LoadConfig() AppConfig {
 	_ = viper.BindEnv("mail.from_email_password", "FROM_EMAIL_PASSWORD")
 	_ = viper.BindEnv("mail.from_email_smtp", "FROM_EMAIL_SMTP")
 	_ = viper.BindEnv("mail.smtp_addr", "SMTP_ADDR")
+	_ = viper.BindEnv("database.backend", "DB_BACKEND")
+	_ = viper.BindEnv("database.postgres_dsn", "POSTGRES_DSN")
+	_ = viper.BindEnv("database.sqlite_path", "SQLITE_PATH")
+	viper.SetDefault("database.sqlite_path", "user-manager.db")
+	_ = viper.BindEnv("email.strip_plus_tags", "EMAIL_STRIP_PLUS_TAGS")
+	_ = viper.BindEnv("email.provider_rules", "EMAIL_PROVIDER_RULES")
+	_ = viper.BindEnv("cache.user_ttl", "USER_CACHE_TTL")
+	_ = viper.BindEnv("cache.user_size", "USER_CACHE_SIZE")
+	viper.SetDefault("cache.user_ttl", "30s")
+	viper.SetDefault("cache.user_size", 1000)
+	_ = viper.BindEnv("lifecycle.restore_grace_period", "USER_RESTORE_GRACE_PERIOD")
+	_ = viper.BindEnv("lifecycle.purge_retention", "USER_PURGE_RETENTION")
+	viper.SetDefault("lifecycle.restore_grace_period", "336h")
+	viper.SetDefault("lifecycle.purge_retention", "720h")
+	_ = viper.BindEnv("profile.schema", "PROFILE_SCHEMA")
+	_ = viper.BindEnv("idempotency.ttl", "IDEMPOTENCY_TTL")
+	viper.SetDefault("idempotency.ttl", "24h")
+	_ = viper.BindEnv("bootstrap.admin_email", "BOOTSTRAP_ADMIN_EMAIL")
+	_ = viper.BindEnv("bootstrap.admin_password", "BOOTSTRAP_ADMIN_PASSWORD")
 
 	var config AppConfig
 	if err := viper.Unmarshal(&config); err != nil {
@@ -0,0 +1,55 @@
+package dbmigrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Migration is one embedded SQL file. Each SQL backend applies them with its own locking.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Load reads migrations/<version>_<name>.sql from files. Versions must be unique; the result is in ascending order.
+func Load(files fs.FS) ([]Migration, error) {
+	entries, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	seen := map[int]string{}
+	for _, entry := range entries {
+		base := strings.TrimSuffix(path.Base(entry), ".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %q: expected <version>_<name>.sql", entry)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %q: invalid version", entry)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", other, entry, version)
+		}
+		seen[version] = entry
+
+		content, err := fs.ReadFile(files, entry)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,450 @@
+// Package ddbfake is an in-process stand-in for DynamoDB, so the DynamoDB repositories can be tested offline.
+// It implements ddb.API for tables created with CreateTable, including global secondary indexes,
+// conditions, transactions and Limit/ExclusiveStartKey paging. It is not a full emulator.
+package ddbfake
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danilobml/user-manager/internal/ddb"
+)
+
+var _ ddb.API = (*Client)(nil)
+
+type keySchema struct {
+	hashKey  string
+	rangeKey string
+}
+
+type table struct {
+	key     keySchema
+	indexes map[string]keySchema
+	items   map[string]item
+}
+
+type Client struct {
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+func New() *Client {
+	return &Client{tables: map[string]*table{}}
+}
+
+// CreateTable only reads the table name, key schema and global secondary indexes.
+func (c *Client) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := aws.ToString(params.TableName)
+	if _, exists := c.tables[name]; exists {
+		return nil, &types.ResourceInUseException{Message: aws.String("table already exists: " + name)}
+	}
+
+	t := &table{key: toKeySchema(params.KeySchema), indexes: map[string]keySchema{}, items: map[string]item{}}
+	for _, gsi := range params.GlobalSecondaryIndexes {
+		t.indexes[aws.ToString(gsi.IndexName)] = toKeySchema(gsi.KeySchema)
+	}
+	c.tables[name] = t
+
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (c *Client) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	id, err := t.primaryKey(params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.GetItemOutput{}
+	if existing, ok := t.items[id]; ok {
+		out.Item = copyItem(existing)
+	}
+	return out, nil
+}
+
+func (c *Client) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	op := types.TransactWriteItem{Put: &types.Put{
+		TableName:                 params.TableName,
+		Item:                      params.Item,
+		ConditionExpression:       params.ConditionExpression,
+		ExpressionAttributeNames:  params.ExpressionAttributeNames,
+		ExpressionAttributeValues: params.ExpressionAttributeValues,
+	}}
+	if err := c.writeOne(op); err != nil {
+		return nil, err
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (c *Client) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	op := types.TransactWriteItem{Update: &types.Update{
+		TableName:                 params.TableName,
+		Key:                       params.Key,
+		UpdateExpression:          params.UpdateExpression,
+		ConditionExpression:       params.ConditionExpression,
+		ExpressionAttributeNames:  params.ExpressionAttributeNames,
+		ExpressionAttributeValues: params.ExpressionAttributeValues,
+	}}
+	if err := c.writeOne(op); err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.UpdateItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllNew {
+		t, _ := c.table(params.TableName)
+		id, _ := t.primaryKey(params.Key)
+		out.Attributes = copyItem(t.items[id])
+	}
+	return out, nil
+}
+
+func (c *Client) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	op := types.TransactWriteItem{Delete: &types.Delete{
+		TableName:                 params.TableName,
+		Key:                       params.Key,
+		ConditionExpression:       params.ConditionExpression,
+		ExpressionAttributeNames:  params.ExpressionAttributeNames,
+		ExpressionAttributeValues: params.ExpressionAttributeValues,
+	}}
+	if err := c.writeOne(op); err != nil {
+		return nil, err
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// All conditions are checked before anything is written; any failure cancels the whole transaction.
+func (c *Client) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	canceled := false
+	for i, op := range params.TransactItems {
+		ok, err := c.checkCondition(op)
+		if err != nil {
+			return nil, err
+		}
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+		if !ok {
+			reasons[i] = types.CancellationReason{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")}
+			canceled = true
+		}
+	}
+	if canceled {
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons"),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, op := range params.TransactItems {
+		if err := c.apply(op); err != nil {
+			return nil, err
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (c *Client) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if params.KeyConditionExpression == nil {
+		return nil, fmt.Errorf("ddbfake: Query needs a KeyConditionExpression")
+	}
+	keyCond, err := parseCondition(params.KeyConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseCondition(params.FilterExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	forward := params.ScanIndexForward == nil || *params.ScanIndexForward
+	items, lastKey, scanned, err := c.read(params.TableName, params.IndexName, keyCond, filter, forward, params.Limit, params.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.QueryOutput{Items: items, Count: int32(len(items)), ScannedCount: scanned, LastEvaluatedKey: lastKey}, nil
+}
+
+func (c *Client) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	filter, err := parseCondition(params.FilterExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	items, lastKey, scanned, err := c.read(params.TableName, params.IndexName, nil, filter, true, params.Limit, params.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.ScanOutput{Items: items, Count: int32(len(items)), ScannedCount: scanned, LastEvaluatedKey: lastKey}, nil
+}
+
+// Helpers
+func (c *Client) table(name *string) (*table, error) {
+	t, ok := c.tables[aws.ToString(name)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("table not found: " + aws.ToString(name))}
+	}
+	return t, nil
+}
+
+func (c *Client) writeOne(op types.TransactWriteItem) error {
+	ok, err := c.checkCondition(op)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return c.apply(op)
+}
+
+// Returns the table, the item's primary key, and the condition of a write.
+func (c *Client) target(op types.TransactWriteItem) (*table, string, *string, map[string]string, map[string]types.AttributeValue, error) {
+	var (
+		tableName *string
+		key       item
+		cond      *string
+		names     map[string]string
+		values    map[string]types.AttributeValue
+	)
+	switch {
+	case op.Put != nil:
+		tableName, key, cond, names, values = op.Put.TableName, op.Put.Item, op.Put.ConditionExpression, op.Put.ExpressionAttributeNames, op.Put.ExpressionAttributeValues
+	case op.Update != nil:
+		tableName, key, cond, names, values = op.Update.TableName, op.Update.Key, op.Update.ConditionExpression, op.Update.ExpressionAttributeNames, op.Update.ExpressionAttributeValues
+	case op.Delete != nil:
+		tableName, key, cond, names, values = op.Delete.TableName, op.Delete.Key, op.Delete.ConditionExpression, op.Delete.ExpressionAttributeNames, op.Delete.ExpressionAttributeValues
+	case op.ConditionCheck != nil:
+		tableName, key, cond, names, values = op.ConditionCheck.TableName, op.ConditionCheck.Key, op.ConditionCheck.ConditionExpression, op.ConditionCheck.ExpressionAttributeNames, op.ConditionCheck.ExpressionAttributeValues
+	default:
+		return nil, "", nil, nil, nil, fmt.Errorf("ddbfake: empty transaction item")
+	}
+
+	t, err := c.table(tableName)
+	if err != nil {
+		return nil, "", nil, nil, nil, err
+	}
+	id, err := t.primaryKey(key)
+	if err != nil {
+		return nil, "", nil, nil, nil, err
+	}
+	return t, id, cond, names, values, nil
+}
+
+func (c *Client) checkCondition(op types.TransactWriteItem) (bool, error) {
+	t, id, expr, names, values, err := c.target(op)
+	if err != nil {
+		return false, err
+	}
+	cond, err := parseCondition(expr, names, values)
+	if err != nil || cond == nil {
+		return err == nil, err
+	}
+	existing, ok := t.items[id]
+	if !ok {
+		existing = item{}
+	}
+	return cond.eval(existing), nil
+}
+
+func (c *Client) apply(op types.TransactWriteItem) error {
+	t, id, _, _, _, err := c.target(op)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case op.Put != nil:
+		t.items[id] = copyItem(op.Put.Item)
+	case op.Delete != nil:
+		delete(t.items, id)
+	case op.Update != nil:
+		actions, err := parseUpdate(op.Update.UpdateExpression, op.Update.ExpressionAttributeNames, op.Update.ExpressionAttributeValues)
+		if err != nil {
+			return err
+		}
+		updated, ok := t.items[id]
+		if ok {
+			updated = copyItem(updated)
+		} else {
+			updated = copyItem(op.Update.Key)
+		}
+		if err := applyUpdate(updated, actions); err != nil {
+			return err
+		}
+		t.items[id] = updated
+	}
+	return nil
+}
+
+// Walks the table or index in key order, applying Limit before the filter like DynamoDB does.
+func (c *Client) read(tableName *string, indexName *string, keyCond condition, filter condition, forward bool, limit *int32, startKey item) ([]item, item, int32, error) {
+	t, err := c.table(tableName)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	schema := t.key
+	if indexName != nil {
+		s, ok := t.indexes[*indexName]
+		if !ok {
+			return nil, nil, 0, &types.ResourceNotFoundException{Message: aws.String("index not found: " + *indexName)}
+		}
+		schema = s
+	}
+
+	candidates := make([]item, 0, len(t.items))
+	for _, it := range t.items {
+		// Indexes are sparse: items without the index keys are not in them
+		if it[schema.hashKey] == nil || (schema.rangeKey != "" && it[schema.rangeKey] == nil) {
+			continue
+		}
+		if keyCond == nil || keyCond.eval(it) {
+			candidates = append(candidates, it)
+		}
+	}
+
+	less := func(a, b item) int {
+		if schema.rangeKey != "" {
+			if cmp, _ := compare(a[schema.rangeKey], b[schema.rangeKey]); cmp != 0 {
+				return cmp
+			}
+		}
+		ka, _ := t.primaryKey(a)
+		kb, _ := t.primaryKey(b)
+		return strings.Compare(ka, kb)
+	}
+	if keyCond == nil {
+		// Scans have no meaningful order; table key order keeps them stable
+		sort.Slice(candidates, func(i, j int) bool {
+			ki, _ := t.primaryKey(candidates[i])
+			kj, _ := t.primaryKey(candidates[j])
+			return ki < kj
+		})
+	} else {
+		slices.SortFunc(candidates, less)
+		if !forward {
+			slices.Reverse(candidates)
+		}
+	}
+
+	start := 0
+	if startKey != nil {
+		start = len(candidates)
+		for i, it := range candidates {
+			cmp := less(it, startKey)
+			if keyCond == nil {
+				ki, _ := t.primaryKey(it)
+				ks, _ := t.primaryKey(startKey)
+				cmp = strings.Compare(ki, ks)
+			} else if !forward {
+				cmp = -cmp
+			}
+			if cmp > 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	end := len(candidates)
+	var lastKey item
+	if limit != nil && start+int(*limit) < end {
+		end = start + int(*limit)
+	}
+	if limit != nil && end > start && end-start == int(*limit) {
+		// DynamoDB reports a LastEvaluatedKey whenever it stops at the limit, even if nothing is left
+		last := candidates[end-1]
+		lastKey = item{}
+		for _, attr := range []string{t.key.hashKey, t.key.rangeKey, schema.hashKey, schema.rangeKey} {
+			if attr != "" {
+				lastKey[attr] = last[attr]
+			}
+		}
+	}
+
+	result := []item{}
+	for _, it := range candidates[start:end] {
+		if filter == nil || filter.eval(it) {
+			result = append(result, copyItem(it))
+		}
+	}
+	return result, lastKey, int32(end - start), nil
+}
+
+func toKeySchema(elements []types.KeySchemaElement) keySchema {
+	var ks keySchema
+	for _, e := range elements {
+		if e.KeyType == types.KeyTypeHash {
+			ks.hashKey = aws.ToString(e.AttributeName)
+		} else {
+			ks.rangeKey = aws.ToString(e.AttributeName)
+		}
+	}
+	return ks
+}
+
+func (t *table) primaryKey(key item) (string, error) {
+	hashPart, err := keyPart(key, t.key.hashKey)
+	if err != nil {
+		return "", err
+	}
+	if t.key.rangeKey == "" {
+		return hashPart, nil
+	}
+	rangePart, err := keyPart(key, t.key.rangeKey)
+	if err != nil {
+		return "", err
+	}
+	return hashPart + "\x00" + rangePart, nil
+}
+
+func keyPart(key item, attr string) (string, error) {
+	switch v := key[attr].(type) {
+	case *types.AttributeValueMemberS:
+		return "S" + v.Value, nil
+	case *types.AttributeValueMemberN:
+		return "N" + v.Value, nil
+	}
+	return "", fmt.Errorf("ddbfake: key attribute %q missing or not a string/number", attr)
+}
+
+func copyItem(it item) item {
+	cp := make(item, len(it))
+	for k, v := range it {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,535 @@
+package ddbfake
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type item = map[string]types.AttributeValue
+
+// The subset of the DynamoDB expression language the repositories use:
+// comparisons, BETWEEN, IN, AND/OR/NOT, parentheses, attribute_exists, attribute_not_exists,
+// begins_with and contains in conditions; SET and REMOVE in update expressions.
+type condition interface {
+	eval(it item) bool
+}
+
+type operand struct {
+	path  string
+	value types.AttributeValue
+}
+
+func (o operand) resolve(it item) types.AttributeValue {
+	if o.path != "" {
+		return it[o.path]
+	}
+	return o.value
+}
+
+type andCond struct{ left, right condition }
+
+func (c andCond) eval(it item) bool { return c.left.eval(it) && c.right.eval(it) }
+
+type orCond struct{ left, right condition }
+
+func (c orCond) eval(it item) bool { return c.left.eval(it) || c.right.eval(it) }
+
+type notCond struct{ inner condition }
+
+func (c notCond) eval(it item) bool { return !c.inner.eval(it) }
+
+type compareCond struct {
+	op          string
+	left, right operand
+}
+
+func (c compareCond) eval(it item) bool {
+	l, r := c.left.resolve(it), c.right.resolve(it)
+	if l == nil || r == nil {
+		return c.op == "<>" && (l == nil) != (r == nil)
+	}
+	switch c.op {
+	case "=":
+		return equal(l, r)
+	case "<>":
+		return !equal(l, r)
+	}
+	cmp, ok := compare(l, r)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+type betweenCond struct{ subject, low, high operand }
+
+func (c betweenCond) eval(it item) bool {
+	v, lo, hi := c.subject.resolve(it), c.low.resolve(it), c.high.resolve(it)
+	if v == nil || lo == nil || hi == nil {
+		return false
+	}
+	cmpLo, okLo := compare(v, lo)
+	cmpHi, okHi := compare(v, hi)
+	return okLo && okHi && cmpLo >= 0 && cmpHi <= 0
+}
+
+type inCond struct {
+	subject operand
+	options []operand
+}
+
+func (c inCond) eval(it item) bool {
+	v := c.subject.resolve(it)
+	if v == nil {
+		return false
+	}
+	for _, o := range c.options {
+		if ov := o.resolve(it); ov != nil && equal(v, ov) {
+			return true
+		}
+	}
+	return false
+}
+
+type funcCond struct {
+	name string
+	args []operand
+}
+
+func (c funcCond) eval(it item) bool {
+	switch c.name {
+	case "attribute_exists":
+		return c.args[0].resolve(it) != nil
+	case "attribute_not_exists":
+		return c.args[0].resolve(it) == nil
+	case "begins_with":
+		s, ok1 := c.args[0].resolve(it).(*types.AttributeValueMemberS)
+		prefix, ok2 := c.args[1].resolve(it).(*types.AttributeValueMemberS)
+		return ok1 && ok2 && strings.HasPrefix(s.Value, prefix.Value)
+	case "contains":
+		needle := c.args[1].resolve(it)
+		switch haystack := c.args[0].resolve(it).(type) {
+		case *types.AttributeValueMemberS:
+			s, ok := needle.(*types.AttributeValueMemberS)
+			return ok && strings.Contains(haystack.Value, s.Value)
+		case *types.AttributeValueMemberSS:
+			s, ok := needle.(*types.AttributeValueMemberS)
+			return ok && contains(haystack.Value, s.Value)
+		case *types.AttributeValueMemberL:
+			for _, v := range haystack.Value {
+				if needle != nil && equal(v, needle) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b types.AttributeValue) bool {
+	if an, ok := a.(*types.AttributeValueMemberN); ok {
+		if bn, ok := b.(*types.AttributeValueMemberN); ok {
+			cmp, ok := compareNumbers(an.Value, bn.Value)
+			return ok && cmp == 0
+		}
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Only strings and numbers are ordered.
+func compare(a, b types.AttributeValue) (int, bool) {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS:
+		if bv, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(av.Value, bv.Value), true
+		}
+	case *types.AttributeValueMemberN:
+		if bv, ok := b.(*types.AttributeValueMemberN); ok {
+			return compareNumbers(av.Value, bv.Value)
+		}
+	}
+	return 0, false
+}
+
+func compareNumbers(a, b string) (int, bool) {
+	af, ok1 := new(big.Float).SetString(a)
+	bf, ok2 := new(big.Float).SetString(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return af.Cmp(bf), true
+}
+
+type updateAction struct {
+	remove bool
+	path   string
+	value  []operand // summed if there are two (a + b), for counters
+	minus  bool
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func newParser(expr string, names map[string]string, values map[string]types.AttributeValue) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{tokens: tokens, names: names, values: values}, nil
+}
+
+func parseCondition(expr *string, names map[string]string, values map[string]types.AttributeValue) (condition, error) {
+	if expr == nil || strings.TrimSpace(*expr) == "" {
+		return nil, nil
+	}
+	p, err := newParser(*expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("ddbfake: unexpected %q in %q", p.tokens[p.pos], *expr)
+	}
+	return cond, nil
+}
+
+func parseUpdate(expr *string, names map[string]string, values map[string]types.AttributeValue) ([]updateAction, error) {
+	if expr == nil {
+		return nil, fmt.Errorf("ddbfake: missing update expression")
+	}
+	p, err := newParser(*expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []updateAction
+	for p.pos < len(p.tokens) {
+		clause := strings.ToUpper(p.next())
+		switch clause {
+		case "SET":
+			for {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				first, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				action := updateAction{path: path, value: []operand{first}}
+				if p.peek() == "+" || p.peek() == "-" {
+					action.minus = p.next() == "-"
+					second, err := p.parseOperand()
+					if err != nil {
+						return nil, err
+					}
+					action.value = append(action.value, second)
+				}
+				actions = append(actions, action)
+				if p.peek() != "," {
+					break
+				}
+				p.next()
+			}
+		case "REMOVE":
+			for {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				actions = append(actions, updateAction{remove: true, path: path})
+				if p.peek() != "," {
+					break
+				}
+				p.next()
+			}
+		default:
+			return nil, fmt.Errorf("ddbfake: unsupported update clause %q", clause)
+		}
+	}
+	return actions, nil
+}
+
+func applyUpdate(it item, actions []updateAction) error {
+	// Right-hand sides see the item as it was before the update
+	before := copyItem(it)
+	for _, a := range actions {
+		if a.remove {
+			delete(it, a.path)
+			continue
+		}
+		v := a.value[0].resolve(before)
+		if len(a.value) == 2 {
+			l, lok := v.(*types.AttributeValueMemberN)
+			r, rok := a.value[1].resolve(before).(*types.AttributeValueMemberN)
+			if !lok || !rok {
+				return fmt.Errorf("ddbfake: arithmetic on non-numbers in SET %s", a.path)
+			}
+			lf, _ := new(big.Float).SetString(l.Value)
+			rf, _ := new(big.Float).SetString(r.Value)
+			if a.minus {
+				rf.Neg(rf)
+			}
+			v = &types.AttributeValueMemberN{Value: new(big.Float).Add(lf, rf).Text('f', -1)}
+		}
+		if v == nil {
+			return fmt.Errorf("ddbfake: SET %s to a missing value", a.path)
+		}
+		it[a.path] = v
+	}
+	return nil
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) expect(t string) error {
+	if got := p.next(); !strings.EqualFold(got, t) {
+		return fmt.Errorf("ddbfake: expected %q, got %q", t, got)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orCond{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andCond{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if strings.EqualFold(p.peek(), "NOT") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCond{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.peek() == "(" {
+		p.next()
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+
+	if name := strings.ToLower(p.peek()); p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "(" {
+		switch name {
+		case "attribute_exists", "attribute_not_exists", "begins_with", "contains":
+		default:
+			return nil, fmt.Errorf("ddbfake: unsupported function %q", name)
+		}
+		p.pos += 2
+		var args []operand
+		for {
+			arg, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		want := 2
+		if name == "attribute_exists" || name == "attribute_not_exists" {
+			want = 1
+		}
+		if len(args) != want {
+			return nil, fmt.Errorf("ddbfake: %s takes %d arguments", name, want)
+		}
+		return funcCond{name: name, args: args}, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	switch strings.ToUpper(op) {
+	case "=", "<>", "<", "<=", ">", ">=":
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareCond{op: op, left: left, right: right}, nil
+	case "BETWEEN":
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenCond{subject: left, low: low, high: high}, nil
+	case "IN":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var options []operand
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, o)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		return inCond{subject: left, options: options}, p.expect(")")
+	}
+	return nil, fmt.Errorf("ddbfake: unexpected %q", op)
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	if strings.HasPrefix(t, ":") {
+		p.next()
+		v, ok := p.values[t]
+		if !ok {
+			return operand{}, fmt.Errorf("ddbfake: missing expression value %s", t)
+		}
+		return operand{value: v}, nil
+	}
+	path, err := p.parsePath()
+	return operand{path: path}, err
+}
+
+// Only top-level attributes are supported, no nested paths.
+func (p *parser) parsePath() (string, error) {
+	t := p.next()
+	if strings.HasPrefix(t, "#") {
+		name, ok := p.names[t]
+		if !ok {
+			return "", fmt.Errorf("ddbfake: missing expression name %s", t)
+		}
+		return name, nil
+	}
+	if t == "" || !isIdentStart(rune(t[0])) {
+		return "", fmt.Errorf("ddbfake: expected attribute, got %q", t)
+	}
+	return t, nil
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '#' || r == ':'
+}
+
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("(),=+-", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '<' || r == '>':
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				tokens = append(tokens, string(runes[i:i+2]))
+				i += 2
+			} else {
+				tokens = append(tokens, string(r))
+				i++
+			}
+		case isIdentStart(r):
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("ddbfake: unexpected %q in %q", r, expr)
+		}
+	}
+	return tokens, nil
+}
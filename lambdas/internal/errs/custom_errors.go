@@ -6,7 +6,15 @@ var ErrNotFound = errors.New("not found")
 
 var ErrAlreadyExists = errors.New("user with this email already exists")
 
-var ErrParsingRoles = errors.New("user with this email already exists")
+var ErrParsingRoles = errors.New("invalid role")
+
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+var ErrRoleCycle = errors.New("role hierarchy contains a cycle")
+
+var ErrAlreadyBootstrapped = errors.New("an admin already exists")
 
 var ErrInvalidToken = errors.New("invalid user token")
 
@@ -17,3 +25,39 @@ var ErrInvalidCredentials = errors.New("invalid credentials")
 var ErrUnauthorized = errors.New("unauthorized")
 
 var ErrMailServiceDisabled = errors.New("one or more email config variables are missing")
+
+var ErrConflict = errors.New("user was modified by another request, reload and retry")
+
+var ErrPreconditionFailed = errors.New("user version does not match If-Match")
+
+var ErrRestoreWindowExpired = errors.New("user was deactivated too long ago to be restored")
+
+var ErrUserErased = errors.New("user has been erased")
+
+var ErrInvalidFormat = errors.New("format must be csv or jsonl")
+
+var ErrInvalidImportFile = errors.New("import file can't be read")
+
+var ErrInvalidInvitation = errors.New("invitation is invalid, expired or revoked")
+
+var ErrInvalidProfile = errors.New("invalid profile")
+
+var ErrInvalidIdempotencyKey = errors.New("idempotency key must be 1 to 255 printable ASCII characters")
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request body")
+
+var ErrIdempotencyKeyInUse = errors.New("a request with this idempotency key is still in progress, retry later")
+
+var ErrInvalidJSON = errors.New("request body is not valid JSON")
+
+var ErrInvalidID = errors.New("no valid id supplied")
+
+var ErrValidation = errors.New("validation failed")
+
+var ErrImpersonationNotAllowed = errors.New("not allowed while impersonating")
+
+var ErrOriginNotAllowed = errors.New("CORS origin denied")
+
+var ErrRequestTooLarge = errors.New("request body too large")
+
+var ErrUnsupportedMediaType = errors.New("unsupported Content-Type")
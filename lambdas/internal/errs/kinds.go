@@ -0,0 +1,143 @@
+package errs
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Code is the stable, machine-readable name of an error. Clients branch on it; messages may change.
+type Code string
+
+const (
+	CodeInvalidJSON           Code = "invalid_json"
+	CodeInvalidID             Code = "invalid_id"
+	CodeValidationFailed      Code = "validation_failed"
+	CodeInvalidRole           Code = "invalid_role"
+	CodeInvalidCursor         Code = "invalid_cursor"
+	CodeInvalidDateRange      Code = "invalid_date_range"
+	CodeInvalidFormat         Code = "invalid_format"
+	CodeInvalidImportFile     Code = "invalid_import_file"
+	CodeInvalidInvitation     Code = "invalid_invitation"
+	CodeInvalidProfile        Code = "invalid_profile"
+	CodeInvalidIdempotencyKey Code = "invalid_idempotency_key"
+	CodeAlreadyExists         Code = "already_exists"
+	CodeInvalidCredentials    Code = "invalid_credentials"
+	CodeInvalidToken          Code = "invalid_token"
+	CodeUnauthorized          Code = "unauthorized"
+	CodeImpersonationBlocked  Code = "impersonation_not_allowed"
+	CodeOriginNotAllowed      Code = "origin_not_allowed"
+	CodeNotFound              Code = "not_found"
+	CodeConflict              Code = "conflict"
+	CodeAlreadyBootstrapped   Code = "already_bootstrapped"
+	CodeIdempotencyKeyInUse   Code = "idempotency_key_in_use"
+	CodeRestoreWindowExpired  Code = "restore_window_expired"
+	CodeUserErased            Code = "user_erased"
+	CodePreconditionFailed    Code = "precondition_failed"
+	CodeRequestTooLarge       Code = "request_too_large"
+	CodeUnsupportedMediaType  Code = "unsupported_media_type"
+	CodeIdempotencyKeyReused  Code = "idempotency_key_reused"
+	CodeInternal              Code = "internal_error"
+	CodeMailUnavailable       Code = "mail_unavailable"
+)
+
+// Kind is what clients are told about a class of errors: its code, HTTP status and a title that is
+// safe to show. Errors of a known kind also send their own message; unknown errors only the title.
+type Kind struct {
+	Code   Code
+	Status int
+	Title  string
+}
+
+// Type is the problem type URI (RFC 7807).
+func (k Kind) Type() string {
+	return "urn:user-manager:problem:" + string(k.Code)
+}
+
+var Internal = Kind{CodeInternal, http.StatusInternalServerError, "Internal server error"}
+
+// Checked in order with errors.Is, so wrapped errors keep their kind.
+var kinds = []struct {
+	err  error
+	kind Kind
+}{
+	{ErrInvalidJSON, Kind{CodeInvalidJSON, http.StatusBadRequest, "Invalid JSON"}},
+	{ErrInvalidID, Kind{CodeInvalidID, http.StatusBadRequest, "Invalid ID"}},
+	{ErrValidation, Kind{CodeValidationFailed, http.StatusBadRequest, "Validation failed"}},
+	{ErrParsingRoles, Kind{CodeInvalidRole, http.StatusBadRequest, "Invalid role"}},
+	{ErrInvalidCursor, Kind{CodeInvalidCursor, http.StatusBadRequest, "Invalid cursor"}},
+	{ErrInvalidDateRange, Kind{CodeInvalidDateRange, http.StatusBadRequest, "Invalid date range"}},
+	{ErrInvalidFormat, Kind{CodeInvalidFormat, http.StatusBadRequest, "Invalid format"}},
+	{ErrInvalidImportFile, Kind{CodeInvalidImportFile, http.StatusBadRequest, "Invalid import file"}},
+	{ErrInvalidInvitation, Kind{CodeInvalidInvitation, http.StatusBadRequest, "Invalid invitation"}},
+	{ErrInvalidProfile, Kind{CodeInvalidProfile, http.StatusBadRequest, "Invalid profile"}},
+	{ErrInvalidIdempotencyKey, Kind{CodeInvalidIdempotencyKey, http.StatusBadRequest, "Invalid idempotency key"}},
+	// Kept at 400 for existing clients
+	{ErrAlreadyExists, Kind{CodeAlreadyExists, http.StatusBadRequest, "Already exists"}},
+	{ErrInvalidCredentials, Kind{CodeInvalidCredentials, http.StatusUnauthorized, "Invalid credentials"}},
+	{ErrInvalidToken, Kind{CodeInvalidToken, http.StatusUnauthorized, "Invalid token"}},
+	{ErrParsingToken, Kind{CodeInvalidToken, http.StatusUnauthorized, "Invalid token"}},
+	{ErrUnauthorized, Kind{CodeUnauthorized, http.StatusUnauthorized, "Unauthorized"}},
+	{ErrImpersonationNotAllowed, Kind{CodeImpersonationBlocked, http.StatusForbidden, "Not allowed while impersonating"}},
+	{ErrOriginNotAllowed, Kind{CodeOriginNotAllowed, http.StatusForbidden, "Origin not allowed"}},
+	{ErrNotFound, Kind{CodeNotFound, http.StatusNotFound, "Not found"}},
+	{ErrConflict, Kind{CodeConflict, http.StatusConflict, "Conflict"}},
+	{ErrAlreadyBootstrapped, Kind{CodeAlreadyBootstrapped, http.StatusConflict, "Already bootstrapped"}},
+	{ErrIdempotencyKeyInUse, Kind{CodeIdempotencyKeyInUse, http.StatusConflict, "Request in progress"}},
+	{ErrRestoreWindowExpired, Kind{CodeRestoreWindowExpired, http.StatusGone, "Restore window expired"}},
+	{ErrUserErased, Kind{CodeUserErased, http.StatusGone, "User erased"}},
+	{ErrPreconditionFailed, Kind{CodePreconditionFailed, http.StatusPreconditionFailed, "Precondition failed"}},
+	{ErrRequestTooLarge, Kind{CodeRequestTooLarge, http.StatusRequestEntityTooLarge, "Request too large"}},
+	{ErrUnsupportedMediaType, Kind{CodeUnsupportedMediaType, http.StatusUnsupportedMediaType, "Unsupported media type"}},
+	{ErrIdempotencyKeyReused, Kind{CodeIdempotencyKeyReused, http.StatusUnprocessableEntity, "Idempotency key reused"}},
+	{ErrMailServiceDisabled, Kind{CodeMailUnavailable, http.StatusServiceUnavailable, "Mail unavailable"}},
+}
+
+// KindOf returns the kind of err, or Internal for errors the API doesn't know.
+func KindOf(err error) (Kind, bool) {
+	for _, k := range kinds {
+		if errors.Is(err, k.err) {
+			return k.kind, true
+		}
+	}
+	return Internal, false
+}
+
+// FieldError is one failed check on a request field.
+type FieldError struct {
+	// JSON name of the field (or query parameter), with the index for list items: roles[0]
+	Field string `json:"field"`
+	// The failed rule, e.g. required, email, oneof
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request. It matches ErrValidation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func NewValidationError(fields ...FieldError) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		parts = append(parts, field.Field+" "+field.Message)
+	}
+	return ErrValidation.Error() + ": " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Kinds lists every kind the API can answer with, Internal last.
+func Kinds() []Kind {
+	all := make([]Kind, 0, len(kinds)+1)
+	for _, k := range kinds {
+		all = append(all, k.kind)
+	}
+	return append(all, Internal)
+}
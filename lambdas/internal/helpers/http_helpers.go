@@ -3,22 +3,24 @@ package helpers
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/danilobml/user-manager/internal/errs"
 )
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
-func WriteJSONError(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Error: message,
-	})
+// Problem is an RFC 7807 error response, sent as application/problem+json.
+type Problem struct {
+	Type   string    `json:"type"`
+	Title  string    `json:"title"`
+	Status int       `json:"status"`
+	Detail string    `json:"detail,omitempty"`
+	Code   errs.Code `json:"code"`
+	// Same as the X-Request-ID header, for support requests
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    []errs.FieldError `json:"errors,omitempty"`
 }
 
 func WriteJSONResponse(w http.ResponseWriter, status int, data any) {
@@ -27,26 +29,52 @@ func WriteJSONResponse(w http.ResponseWriter, status int, data any) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// Renders err as a problem. Errors of a known kind (see errs.KindOf) keep their message; anything else is
+// logged and reported as a bare internal error, so storage and driver errors don't reach clients.
 func WriteErrorsResponse(w http.ResponseWriter, err error) {
-	if err != nil {
-		if errors.Is(err, errs.ErrNotFound) {
-			WriteJSONError(w, http.StatusNotFound, err.Error())
-			return
-		}
-		if errors.Is(err, errs.ErrAlreadyExists) {
-			WriteJSONError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		if errors.Is(err, errs.ErrInvalidCredentials) {
-			WriteJSONError(w, http.StatusUnauthorized, err.Error())
-			return
-		}
-		if errors.Is(err, errs.ErrUnauthorized) {
-			WriteJSONError(w, http.StatusUnauthorized, err.Error())
-			return
-		}
-
-		WriteJSONError(w, http.StatusInternalServerError, err.Error())
+	if err == nil {
 		return
 	}
+
+	kind, known := errs.KindOf(err)
+	problem := Problem{
+		Type:      kind.Type(),
+		Title:     kind.Title,
+		Status:    kind.Status,
+		Code:      kind.Code,
+		RequestID: w.Header().Get("X-Request-ID"),
+	}
+	if known {
+		problem.Detail = err.Error()
+	} else {
+		log.Printf("Internal error: %v, Request ID: %s", err, problem.RequestID)
+	}
+	var validationErr *errs.ValidationError
+	if errors.As(err, &validationErr) {
+		problem.Errors = validationErr.Fields
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// ETags are the user's version, quoted.
+func FormatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Returns the version required by If-Match, or nil if there is no precondition.
+// Anything that can't match a version we issued fails the precondition.
+func ParseIfMatch(r *http.Request) (*int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		return nil, errs.ErrPreconditionFailed
+	}
+	return &version, nil
 }
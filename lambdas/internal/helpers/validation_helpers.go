@@ -0,0 +1,82 @@
+package helpers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/danilobml/user-manager/internal/errs"
+)
+
+var validate = newValidator()
+
+// Validates a request and reports every invalid field, named as the client sends it, in an *errs.ValidationError.
+// Shared by the handlers and the bulk import, so row errors read like API errors.
+func ValidateStruct(structToValidate any) error {
+	err := validate.Struct(structToValidate)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+	fields := make([]errs.FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		// The namespace starts with the struct's name
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fields = append(fields, errs.FieldError{Field: field, Rule: fe.Tag(), Message: validationMessage(fe, structToValidate)})
+	}
+	return errs.NewValidationError(fields...)
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(fieldName)
+	return v
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "query"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return ""
+}
+
+func validationMessage(fe validator.FieldError, validated any) string {
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Map:
+		unit = " items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min", "gte":
+		return "must be at least " + fe.Param() + unit
+	case "max", "lte":
+		return "must be at most " + fe.Param() + unit
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "datetime":
+		return "must be an RFC 3339 time"
+	case "excluded_with":
+		other := fe.Param()
+		if field, ok := reflect.Indirect(reflect.ValueOf(validated)).Type().FieldByName(other); ok && fieldName(field) != "" {
+			other = fieldName(field)
+		}
+		return "can't be combined with " + other
+	default:
+		return "failed the " + fe.Tag() + " check"
+	}
+}
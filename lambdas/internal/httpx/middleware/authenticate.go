@@ -5,32 +5,40 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/danilobml/user-manager/internal/errs"
 	"github.com/danilobml/user-manager/internal/helpers"
 	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/model"
 )
 
 type ctxKey string
 
 const claimsCtxKey ctxKey = "claims"
 
+const permissionsCtxKey ctxKey = "permissions"
+
 func Authenticate(jwtManager *jwt.JwtManager) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
 			parts := strings.Fields(authHeader)
 			if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-				helpers.WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+				helpers.WriteErrorsResponse(w, errs.ErrUnauthorized)
 				return
 			}
 			tokenString := parts[1]
 
 			claims, err := jwtManager.ParseAndValidateToken(tokenString)
 			if err != nil {
-				helpers.WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+				helpers.WriteErrorsResponse(w, errs.ErrUnauthorized)
 				return
 			}
 
+			// Resolved once here so handlers and services don't walk the role hierarchy again
+			permissions := model.DefaultRoleHierarchy.EffectivePermissions(claims.Roles)
+
 			ctx := context.WithValue(r.Context(), claimsCtxKey, claims)
+			ctx = context.WithValue(ctx, permissionsCtxKey, permissions)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -42,3 +50,8 @@ func GetClaimsFromContext(ctx context.Context) (*jwt.Claims, bool) {
 	claims, ok := ctx.Value(claimsCtxKey).(*jwt.Claims)
 	return claims, ok
 }
+
+func GetPermissionsFromContext(ctx context.Context) (model.Permissions, bool) {
+	permissions, ok := ctx.Value(permissionsCtxKey).(model.Permissions)
+	return permissions, ok
+}
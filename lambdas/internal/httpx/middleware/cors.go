@@ -5,6 +5,9 @@ import (
 	"slices"
 
 	"github.com/rs/cors"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
 )
 
 func Cors(mux http.Handler) http.Handler {
@@ -14,14 +17,15 @@ func Cors(mux http.Handler) http.Handler {
 		origin := r.Header.Get("Origin")
 
 		if origin != "" && !isInAllowedOrigins(allowedOrigins, origin) {
-			http.Error(w, "CORS origin denied", http.StatusForbidden)
+			helpers.WriteErrorsResponse(w, errs.ErrOriginNotAllowed)
 			return
 		}
 
 		c := cors.New(cors.Options{
 			AllowedOrigins:   allowedOrigins,
-			AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-			AllowedHeaders:   []string{"Content-Type", "Authorization"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "Idempotency-Key", "If-Match"},
+			ExposedHeaders:   []string{"ETag"}, // sent back in If-Match
 			AllowCredentials: false,
 		})
 		c.Handler(mux).ServeHTTP(w, r)
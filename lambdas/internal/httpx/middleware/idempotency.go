@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// The largest request body, the user import
+	maxIdempotentRequestBytes = 10 << 20
+	// DynamoDB items are capped at 400 KB; larger responses aren't kept and retries run again
+	maxStoredResponseBytes = 256 << 10
+	// How long the first request holds its key before a retry may take over
+	idempotencyLockTimeout = time.Minute
+)
+
+// Response headers a replay repeats.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location", "Content-Disposition"}
+
+// Replays the first response to writes sent with an Idempotency-Key, for ttl. Keys are scoped to the
+// method, path and caller, taken from the token, so it runs after Authenticate on protected routes.
+// Public routes share one anonymous caller, so clients should send random keys (UUIDs).
+// Server errors aren't kept, so those requests can be retried.
+func Idempotency(idempotencyRepository repository.IdempotencyRepository, ttl time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !isValidIdempotencyKey(key) {
+				helpers.WriteErrorsResponse(w, errs.ErrInvalidIdempotencyKey)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+			if err != nil {
+				helpers.WriteErrorsResponse(w, errs.ErrRequestTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now().UTC()
+			record := model.IdempotencyRecord{
+				Key:         idempotencyScope(r, key),
+				RequestHash: hashHex([]byte(r.Header.Get("Content-Type")), body),
+				LockedUntil: now.Add(idempotencyLockTimeout),
+				ExpiresAt:   now.Add(ttl),
+			}
+			existing, err := idempotencyRepository.Reserve(r.Context(), record)
+			if err != nil {
+				helpers.WriteErrorsResponse(w, err)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.RequestHash != record.RequestHash:
+					helpers.WriteErrorsResponse(w, errs.ErrIdempotencyKeyReused)
+				case !existing.IsCompleted():
+					helpers.WriteErrorsResponse(w, errs.ErrIdempotencyKeyInUse)
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w}
+			// A panic leaves the key reserved until the lock times out
+			next.ServeHTTP(rw, r)
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+
+			if rw.status >= http.StatusInternalServerError || rw.tooLarge {
+				if err := idempotencyRepository.Release(r.Context(), record.Key); err != nil {
+					log.Printf("idempotency: releasing key failed: %v", err)
+				}
+				return
+			}
+			record.StatusCode = rw.status
+			record.Header = map[string]string{}
+			for _, name := range replayedHeaders {
+				if value := rw.Header().Get(name); value != "" {
+					record.Header[name] = value
+				}
+			}
+			record.Body = rw.body.Bytes()
+			if err := idempotencyRepository.Complete(r.Context(), record); err != nil {
+				log.Printf("idempotency: saving response failed: %v", err)
+			}
+		})
+	}
+}
+
+// Keeps a copy of what the handler writes.
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.tooLarge {
+		if w.body.Len()+len(p) > maxStoredResponseBytes {
+			w.tooLarge = true
+			w.body.Reset()
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Helpers
+func replay(w http.ResponseWriter, record *model.IdempotencyRecord) {
+	for name, value := range record.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// Hashed, so the store holds no emails.
+func idempotencyScope(r *http.Request, key string) string {
+	principal := "anonymous"
+	if claims, ok := GetClaimsFromContext(r.Context()); ok {
+		principal = claims.TenantID.String() + "/" + claims.Subject + "/" + claims.Email
+		if claims.IsImpersonated() {
+			principal += "/" + claims.Act.Sub
+		}
+	}
+	return hashHex([]byte(principal), []byte(r.Method+" "+r.URL.Path), []byte(key))
+}
+
+// Parts are length-prefixed so different splits can't collide.
+func hashHex(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(part))))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isValidIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+	"github.com/google/uuid"
+)
+
+// Runs after Authenticate: flags every request made with an impersonation token in the logs and the audit trail.
+func AuditImpersonation(auditRepository repository.AuditRepository) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaimsFromContext(r.Context())
+			if !ok || !claims.IsImpersonated() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log.Printf(
+				"Impersonated request: Actor: %s, Subject: %s, Request URI: %s, Method: %s, Request ID: %s",
+				claims.Act.Email, claims.Email, r.RequestURI, r.Method, r.Header.Get("X-Request-ID"),
+			)
+
+			actorID, _ := uuid.Parse(claims.Act.Sub)
+			subjectID, _ := uuid.Parse(claims.Subject)
+			err := auditRepository.Record(r.Context(), model.AuditEvent{
+				ID:           uuid.New(),
+				TenantID:     claims.TenantID,
+				OccurredAt:   time.Now().UTC(),
+				Action:       model.AuditImpersonatedRequest,
+				ActorID:      actorID,
+				ActorEmail:   claims.Act.Email,
+				SubjectID:    subjectID,
+				SubjectEmail: claims.Email,
+				Impersonated: true,
+				Detail:       r.Method + " " + r.URL.Path,
+			})
+			if err != nil {
+				log.Printf("error recording audit event: %v", err)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Guards endpoints an impersonating admin must not use on the user's behalf.
+func BlockImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := GetClaimsFromContext(r.Context())
+		if ok && claims.IsImpersonated() {
+			helpers.WriteErrorsResponse(w, errs.ErrImpersonationNotAllowed)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,8 +1,10 @@
 package middleware
 
 import (
-	"log"
+	"fmt"
 	"net/http"
+
+	"github.com/danilobml/user-manager/internal/helpers"
 )
 
 func Recover(next http.Handler) http.Handler {
@@ -10,8 +12,8 @@ func Recover(next http.Handler) http.Handler {
 
 		defer func() {
 			if r := recover(); r != nil {
-				log.Printf("Recovered from panic: %v", r)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				// Logged by WriteErrorsResponse, and answered as a bare internal error
+				helpers.WriteErrorsResponse(w, fmt.Errorf("recovered from panic: %v", r))
 			}
 		}()
 
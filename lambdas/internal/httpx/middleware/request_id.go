@@ -13,6 +13,8 @@ func RequestId(next http.Handler) http.Handler {
 		if r.Header.Get("X-Request-ID") == "" {
 			r.Header.Add("X-Request-ID", id)
 		}
+		// Echoed back, and read from here by error responses
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
 
 		next.ServeHTTP(w, r)
 	})
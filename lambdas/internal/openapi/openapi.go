@@ -0,0 +1,214 @@
+// Package openapi describes the API as an OpenAPI 3.1 document, built from the route table and the
+// request and response types. Validate tags on those types become schema constraints.
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+)
+
+type Auth int
+
+const (
+	AuthNone Auth = iota
+	// Authorization: Bearer <JWT>
+	AuthBearer
+	// User-Api-Key header
+	AuthAPIKey
+)
+
+// Operation documents one route. Query, Body and Response are zero values of the types involved.
+type Operation struct {
+	Summary string
+	Tag     string
+	Auth    Auth
+	// A struct whose query-tagged fields are the query parameters
+	Query any
+	Body  any
+	// Defaults to application/json
+	BodyTypes []string
+	Response  any
+	// Defaults to application/json
+	ResponseTypes []string
+	// Defaults to 200
+	Status int
+	// Accepts If-Match with the user's ETag
+	IfMatch bool
+	// Accepts an Idempotency-Key
+	Idempotent bool
+}
+
+// Endpoint is an operation at a method and path, like "GET" and "/users/{id}".
+type Endpoint struct {
+	Method      string
+	Path        string
+	OperationID string
+	Operation   Operation
+}
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components components                      `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	Responses       map[string]response       `json:"responses"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+type operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// Generate builds the document. Every operation also answers errors as problem+json (the default response).
+func Generate(info Info, endpoints []Endpoint) *Document {
+	b := newSchemaBuilder()
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   map[string]map[string]operation{},
+		Components: components{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]securityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"apiKeyAuth": {Type: "apiKey", In: "header", Name: "User-Api-Key"},
+			},
+		},
+	}
+
+	problem := b.schemaFor(helpers.Problem{})
+	codes := []any{}
+	for _, kind := range errs.Kinds() {
+		if !slices.Contains(codes, any(string(kind.Code))) {
+			codes = append(codes, string(kind.Code))
+		}
+	}
+	b.schemas["Problem"].Properties["code"].Enum = codes
+	doc.Components.Responses = map[string]response{
+		"Problem": {
+			Description: "Error, see code",
+			Content:     map[string]mediaType{"application/problem+json": {Schema: problem}},
+		},
+	}
+
+	for _, endpoint := range endpoints {
+		if doc.Paths[endpoint.Path] == nil {
+			doc.Paths[endpoint.Path] = map[string]operation{}
+		}
+		doc.Paths[endpoint.Path][strings.ToLower(endpoint.Method)] = b.operation(endpoint)
+	}
+
+	return doc
+}
+
+// Helpers
+func (b *schemaBuilder) operation(endpoint Endpoint) operation {
+	op := endpoint.Operation
+	out := operation{
+		OperationID: endpoint.OperationID,
+		Summary:     op.Summary,
+		Responses:   map[string]response{"default": {Ref: "#/components/responses/Problem"}},
+	}
+	if op.Tag != "" {
+		out.Tags = []string{op.Tag}
+	}
+	switch op.Auth {
+	case AuthBearer:
+		out.Security = []map[string][]string{{"bearerAuth": {}}}
+	case AuthAPIKey:
+		out.Security = []map[string][]string{{"apiKeyAuth": {}}}
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(endpoint.Path, -1) {
+		out.Parameters = append(out.Parameters, parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}})
+	}
+	if op.Query != nil {
+		out.Parameters = append(out.Parameters, b.queryParameters(op.Query)...)
+	}
+	if op.IfMatch {
+		out.Parameters = append(out.Parameters, parameter{Name: "If-Match", In: "header", Schema: &Schema{Type: "string"}})
+	}
+	if op.Idempotent {
+		out.Parameters = append(out.Parameters, parameter{Name: "Idempotency-Key", In: "header", Schema: &Schema{Type: "string", MaxLength: intPtr(255)}})
+	}
+
+	if op.Body != nil {
+		out.RequestBody = &requestBody{Required: true, Content: b.content(op.Body, op.BodyTypes)}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := response{Description: http.StatusText(status)}
+	if op.Response != nil && status != http.StatusNoContent {
+		success.Content = b.content(op.Response, op.ResponseTypes)
+	}
+	out.Responses[strconv.Itoa(status)] = success
+
+	return out
+}
+
+func (b *schemaBuilder) content(value any, types []string) map[string]mediaType {
+	if len(types) == 0 {
+		types = []string{"application/json"}
+	}
+	schema := b.schemaFor(value)
+	content := make(map[string]mediaType, len(types))
+	for _, contentType := range types {
+		content[contentType] = mediaType{Schema: schema}
+	}
+	return content
+}
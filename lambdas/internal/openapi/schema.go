@@ -0,0 +1,248 @@
+package openapi
+
+import (
+	"encoding/json"
+	"iter"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Schema is the subset of JSON Schema the document uses.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	uuidType = reflect.TypeFor[uuid.UUID]()
+	rawType  = reflect.TypeFor[json.RawMessage]()
+)
+
+// Named structs become components, referenced by name.
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	types   map[string]reflect.Type
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{schemas: map[string]*Schema{}, types: map[string]reflect.Type{}}
+}
+
+func (b *schemaBuilder) schemaFor(value any) *Schema {
+	return b.schemaOf(reflect.TypeOf(value))
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case t == rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return b.ref(t)
+	default:
+		// Interfaces: any JSON value
+		return &Schema{}
+	}
+}
+
+func (b *schemaBuilder) ref(t reflect.Type) *Schema {
+	name := t.Name()
+	if seen, ok := b.types[name]; ok && seen != t {
+		name = strings.ReplaceAll(t.String(), ".", "")
+	}
+	if _, ok := b.types[name]; !ok {
+		b.types[name] = t
+		// Registered first, so self-references end
+		b.schemas[name] = &Schema{}
+		*b.schemas[name] = *b.structSchema(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Fields are named by their json tag; fields with validate:"required" are required.
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for field := range fields(t) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property, required := b.fieldSchema(field)
+		schema.Properties[name] = property
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+func (b *schemaBuilder) queryParameters(query any) []parameter {
+	var params []parameter
+	for field := range fields(reflect.TypeOf(query)) {
+		name := field.Tag.Get("query")
+		if name == "" {
+			continue
+		}
+		schema, required := b.fieldSchema(field)
+		params = append(params, parameter{Name: name, In: "query", Required: required, Schema: schema})
+	}
+	return params
+}
+
+// Rules after dive apply to the items of a list.
+func (b *schemaBuilder) fieldSchema(field reflect.StructField) (*Schema, bool) {
+	schema := b.schemaOf(field.Type)
+	fieldRules, itemRules, _ := strings.Cut(","+field.Tag.Get("validate"), ",dive")
+	required := applyRules(schema, fieldRules)
+	if schema.Items != nil && itemRules != "" {
+		items := *schema.Items
+		applyRules(&items, strings.TrimPrefix(itemRules, ","))
+		schema.Items = &items
+	}
+	return schema, required
+}
+
+// Sets the constraints of validate rules on schema and reports whether the value is required.
+func applyRules(schema *Schema, rules string) bool {
+	required := false
+	for rule := range strings.SplitSeq(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "url", "http_url":
+			schema.Format = "uri"
+		case "uuid":
+			schema.Format = "uuid"
+		case "datetime":
+			schema.Format = "date-time"
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				if schema.Type == "integer" {
+					if number, err := strconv.Atoi(value); err == nil {
+						schema.Enum = append(schema.Enum, number)
+						continue
+					}
+				}
+				schema.Enum = append(schema.Enum, value)
+			}
+		case "min", "gte", "max", "lte", "len":
+			limit, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			setLimit(schema, name, limit)
+		}
+	}
+	return required
+}
+
+func setLimit(schema *Schema, rule string, limit int) {
+	isMin := rule == "min" || rule == "gte" || rule == "len"
+	isMax := rule == "max" || rule == "lte" || rule == "len"
+	switch schema.Type {
+	case "string":
+		if isMin {
+			schema.MinLength = intPtr(limit)
+		}
+		if isMax {
+			schema.MaxLength = intPtr(limit)
+		}
+	case "array":
+		if isMin {
+			schema.MinItems = intPtr(limit)
+		}
+		if isMax {
+			schema.MaxItems = intPtr(limit)
+		}
+	case "integer", "number":
+		value := float64(limit)
+		if isMin {
+			schema.Minimum = &value
+		}
+		if isMax {
+			schema.Maximum = &value
+		}
+	}
+}
+
+// Exported fields, with embedded structs flattened like encoding/json does.
+func fields(t reflect.Type) iter.Seq[reflect.StructField] {
+	return func(yield func(reflect.StructField) bool) {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if field.Anonymous && field.Tag.Get("json") == "" && field.Type.Kind() == reflect.Struct {
+				for embedded := range fields(field.Type) {
+					if !yield(embedded) {
+						return
+					}
+				}
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if !yield(field) {
+				return
+			}
+		}
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    id              UUID PRIMARY KEY,
+    tenant_id       UUID NOT NULL,
+    email           TEXT NOT NULL,
+    hashed_password TEXT NOT NULL,
+    roles           TEXT[] NOT NULL DEFAULT '{}',
+    is_active       BOOLEAN NOT NULL DEFAULT TRUE,
+    is_verified     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT users_tenant_email_key UNIQUE (tenant_id, email)
+);
+
+CREATE INDEX users_tenant_created_idx ON users (tenant_id, created_at, id);
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN updated_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN last_login_at       TIMESTAMPTZ,
+    ADD COLUMN password_changed_at TIMESTAMPTZ;
+
+UPDATE users SET updated_at = created_at;
+
+CREATE INDEX users_tenant_last_login_idx ON users (tenant_id, last_login_at);
@@ -0,0 +1,7 @@
+-- Existing rows get a lowercased key; it fails on accounts that only differ by case, which need merging by hand first.
+ALTER TABLE users ADD COLUMN email_key TEXT;
+UPDATE users SET email_key = lower(email);
+ALTER TABLE users ALTER COLUMN email_key SET NOT NULL;
+
+ALTER TABLE users DROP CONSTRAINT users_tenant_email_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_email_key_key UNIQUE (tenant_id, email_key);
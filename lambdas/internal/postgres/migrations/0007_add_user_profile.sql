@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN profile JSONB NOT NULL DEFAULT '{}';
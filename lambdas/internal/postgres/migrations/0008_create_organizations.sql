@@ -0,0 +1,4 @@
+CREATE TABLE organizations (
+    id   UUID PRIMARY KEY,
+    name TEXT NOT NULL
+);
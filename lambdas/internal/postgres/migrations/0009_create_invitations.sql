@@ -0,0 +1,11 @@
+CREATE TABLE invitations (
+    id         UUID PRIMARY KEY,
+    tenant_id  UUID NOT NULL,
+    email      TEXT NOT NULL,
+    roles      TEXT[] NOT NULL DEFAULT '{}',
+    status     TEXT NOT NULL,
+    invited_by TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX invitations_tenant_idx ON invitations (tenant_id, expires_at, id);
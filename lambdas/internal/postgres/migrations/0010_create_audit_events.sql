@@ -0,0 +1,16 @@
+CREATE TABLE audit_events (
+    id            UUID PRIMARY KEY,
+    tenant_id     UUID NOT NULL,
+    occurred_at   TIMESTAMPTZ NOT NULL,
+    action        TEXT NOT NULL,
+    actor_id      UUID NOT NULL,
+    actor_email   TEXT NOT NULL DEFAULT '',
+    subject_id    UUID NOT NULL,
+    subject_email TEXT NOT NULL DEFAULT '',
+    impersonated  BOOLEAN NOT NULL DEFAULT FALSE,
+    detail        TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX audit_events_subject_idx ON audit_events (subject_id, occurred_at);
+-- Erasure anonymizes events by actor too
+CREATE INDEX audit_events_actor_idx ON audit_events (actor_id);
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Opens the pool and brings the schema up to date before the app starts serving.
+func InitPostgres(dsn string) *sql.DB {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		log.Fatalf("unable to open postgres connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		log.Fatalf("unable to reach postgres: %v", err)
+	}
+	if err := Migrate(ctx, db); err != nil {
+		log.Fatalf("unable to migrate postgres schema: %v", err)
+	}
+
+	return db
+}
@@ -1,42 +1,185 @@
 package routes
 
 import (
+	_ "embed"
 	"encoding/json"
 	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"unicode"
 
 	"github.com/danilobml/user-manager/internal/httpx/middleware"
+	"github.com/danilobml/user-manager/internal/openapi"
+	"github.com/danilobml/user-manager/internal/user/dtos"
 	"github.com/danilobml/user-manager/internal/user/handler"
 )
 
-func NewRouter(userHandler *handler.UserHandler, authMiddleware middleware.Middleware) http.Handler {
-	mux := http.NewServeMux()
+// Route is one entry of the route table, which both the router and the OpenAPI document are built from.
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	Doc     openapi.Operation
+	// Account changes stay with the real owner, so impersonation tokens are rejected
+	BlockImpersonation bool
+}
 
-	// Public
-	mux.HandleFunc("GET /health", health)
-	mux.HandleFunc("POST /register", userHandler.Register)
-	mux.HandleFunc("POST /login", userHandler.Login)
-	mux.HandleFunc("POST /request-password", userHandler.RequestPasswordReset)
-	mux.HandleFunc("PUT /users/reset-password", userHandler.ResetPassword)
+var apiInfo = openapi.Info{Title: "User Manager API", Version: "1.0.0"}
 
-	mux.HandleFunc("POST /check-user", userHandler.CheckUser)
+//go:embed docs.html
+var docsPage []byte
 
-	// Protected
-	mux.Handle("GET /users/data",
-		authMiddleware(http.HandlerFunc(userHandler.GetUserData)),
-	)
-	mux.Handle("DELETE /users/{id}",
-		authMiddleware(http.HandlerFunc(userHandler.UnregisterUser)),
-	)
-	mux.Handle("PUT /users/{id}",
-		authMiddleware(http.HandlerFunc(userHandler.UpdateUser)),
-	)
-	// Admin
-	mux.Handle("GET /users",
-		authMiddleware(http.HandlerFunc(userHandler.GetAllUsers)),
-	)
-	mux.Handle("DELETE /users/{id}/remove",
-		authMiddleware(http.HandlerFunc(userHandler.RemoveUser)),
-	)
+// Table lists every route. Handlers may be nil when only the documentation is needed.
+func Table(userHandler *handler.UserHandler, organizationHandler *handler.OrganizationHandler, invitationHandler *handler.InvitationHandler, bulkHandler *handler.BulkHandler) []Route {
+	ifMatch := func(op openapi.Operation) openapi.Operation {
+		op.IfMatch = true
+		return op
+	}
+
+	table := []Route{
+		// Public
+		{Method: "GET", Path: "/health", Handler: health, Doc: openapi.Operation{
+			Summary: "Health check", Tag: "system", Response: map[string]string{},
+		}},
+		{Method: "POST", Path: "/register", Handler: userHandler.Register, Doc: openapi.Operation{
+			Summary: "Register a user", Tag: "auth", Body: dtos.RegisterRequest{}, Response: dtos.RegisterResponse{}, Status: http.StatusCreated, Idempotent: true,
+		}},
+		{Method: "POST", Path: "/login", Handler: userHandler.Login, Doc: openapi.Operation{
+			Summary: "Log in", Tag: "auth", Body: dtos.LoginRequest{}, Response: dtos.LoginResponse{},
+		}},
+		{Method: "POST", Path: "/request-password", Handler: userHandler.RequestPasswordReset, Doc: openapi.Operation{
+			Summary: "Email a password reset link", Tag: "auth", Body: dtos.RequestPasswordResetRequest{}, Status: http.StatusNoContent, Idempotent: true,
+		}},
+		{Method: "PUT", Path: "/users/reset-password", Handler: userHandler.ResetPassword, Doc: openapi.Operation{
+			Summary: "Reset the password with the emailed token", Tag: "auth", Body: dtos.ResetPasswordRequest{}, Status: http.StatusNoContent,
+		}},
+		{Method: "POST", Path: "/users/erase/confirm", Handler: userHandler.ConfirmErasure, Doc: openapi.Operation{
+			Summary: "Confirm an erasure request", Tag: "users", Body: dtos.ConfirmErasureRequest{}, Status: http.StatusNoContent,
+		}},
+		{Method: "POST", Path: "/invitations/accept", Handler: invitationHandler.AcceptInvitation, Doc: openapi.Operation{
+			Summary: "Accept an invitation", Tag: "invitations", Body: dtos.AcceptInvitationRequest{}, Response: dtos.AcceptInvitationResponse{}, Status: http.StatusCreated,
+		}},
+		{Method: "POST", Path: "/check-user", Handler: userHandler.CheckUser, Doc: openapi.Operation{
+			Summary: "Check a user token (for other services)", Tag: "auth", Auth: openapi.AuthAPIKey, Body: dtos.CheckUserRequest{}, Response: dtos.CheckUserResponse{},
+		}},
+
+		// Protected
+		{Method: "GET", Path: "/users/data", Handler: userHandler.GetUserData, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Get the current user", Tag: "users", Response: dtos.ResponseUser{},
+		}},
+		{Method: "DELETE", Path: "/users/{id}", Handler: userHandler.UnregisterUser, BlockImpersonation: true, Doc: ifMatch(openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Delete your account", Tag: "users", Status: http.StatusNoContent,
+		})},
+		{Method: "PUT", Path: "/users/{id}", Handler: userHandler.UpdateUser, BlockImpersonation: true, Doc: ifMatch(openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Replace a user", Tag: "users", Body: dtos.UpdateUserRequest{}, Response: "",
+		})},
+		{Method: "PATCH", Path: "/users/{id}", Handler: userHandler.PatchUser, BlockImpersonation: true, Doc: ifMatch(openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Update a user with a merge patch", Tag: "users", Body: dtos.PatchUserRequest{}, BodyTypes: []string{"application/merge-patch+json", "application/json"}, Response: dtos.ResponseUser{},
+		})},
+		{Method: "PATCH", Path: "/users/{id}/profile", Handler: userHandler.UpdateProfile, BlockImpersonation: true, Doc: ifMatch(openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Update a user's profile", Tag: "users", Body: dtos.UpdateProfileRequest{}, Response: dtos.ResponseUser{},
+		})},
+		{Method: "GET", Path: "/users/{id}/export", Handler: userHandler.ExportUser, BlockImpersonation: true, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Export everything stored about a user", Tag: "users", Response: dtos.UserExport{},
+		}},
+		{Method: "POST", Path: "/users/{id}/erase", Handler: userHandler.RequestErasure, BlockImpersonation: true, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Request erasure of your account", Tag: "users", Response: "", Status: http.StatusAccepted,
+		}},
+
+		// Admin
+		{Method: "GET", Path: "/users", Handler: userHandler.GetAllUsers, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "List users", Tag: "admin", Query: dtos.ListUsersRequest{}, Response: dtos.GetAllUsersResponse{},
+		}},
+		{Method: "DELETE", Path: "/users/{id}/remove", Handler: userHandler.RemoveUser, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Deactivate a user", Tag: "admin", Status: http.StatusNoContent,
+		}},
+		{Method: "POST", Path: "/admin/users/{id}/restore", Handler: userHandler.RestoreUser, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Restore a deactivated user", Tag: "admin", Response: "",
+		}},
+		{Method: "POST", Path: "/admin/users/{id}/erase", Handler: userHandler.EraseUser, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Erase a user", Tag: "admin", Status: http.StatusNoContent,
+		}},
+		{Method: "PUT", Path: "/admin/users/{id}/roles", Handler: userHandler.AssignRoles, Doc: ifMatch(openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Replace a user's roles", Tag: "admin", Body: dtos.AssignRolesRequest{}, Response: "",
+		})},
+		{Method: "POST", Path: "/admin/users/{id}/impersonate", Handler: userHandler.ImpersonateUser, BlockImpersonation: true, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Get a token acting as a user", Tag: "admin", Response: dtos.ImpersonateResponse{},
+		}},
+		{Method: "POST", Path: "/admin/users/import", Handler: bulkHandler.ImportUsers, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Import users from a file", Tag: "admin",
+			Query: struct {
+				Format string `query:"format" validate:"omitempty,oneof=csv jsonl"`
+				DryRun bool   `query:"dry_run"`
+				Invite bool   `query:"invite"`
+			}{},
+			Body: "", BodyTypes: []string{"text/csv", "application/x-ndjson"}, Response: dtos.ImportReport{},
+		}},
+		{Method: "GET", Path: "/admin/users/export", Handler: bulkHandler.ExportUsers, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Export users to a file", Tag: "admin",
+			Query: struct {
+				Format string `query:"format" validate:"omitempty,oneof=csv jsonl"`
+			}{},
+			Response: "", ResponseTypes: []string{"text/csv", "application/x-ndjson"},
+		}},
+		{Method: "POST", Path: "/invitations", Handler: invitationHandler.CreateInvitation, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Invite a user", Tag: "invitations", Body: dtos.CreateInvitationRequest{}, Response: dtos.ResponseInvitation{}, Status: http.StatusCreated,
+		}},
+		{Method: "GET", Path: "/invitations", Handler: invitationHandler.GetAllInvitations, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "List invitations", Tag: "invitations", Response: dtos.GetAllInvitationsResponse{},
+		}},
+		{Method: "DELETE", Path: "/invitations/{id}", Handler: invitationHandler.RevokeInvitation, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Revoke an invitation", Tag: "invitations", Status: http.StatusNoContent,
+		}},
+
+		// Platform admin
+		{Method: "POST", Path: "/organizations", Handler: organizationHandler.CreateOrganization, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "Create an organization", Tag: "organizations", Body: dtos.CreateOrganizationRequest{}, Response: dtos.CreateOrganizationResponse{}, Status: http.StatusCreated,
+		}},
+		{Method: "GET", Path: "/organizations", Handler: organizationHandler.GetAllOrganizations, Doc: openapi.Operation{
+			Auth: openapi.AuthBearer, Summary: "List organizations", Tag: "organizations", Response: dtos.GetAllOrganizationsResponse{},
+		}},
+	}
+
+	// Retried writes sent with an Idempotency-Key get the first response again
+	for i := range table {
+		if table[i].Doc.Auth == openapi.AuthBearer && table[i].Method != "GET" {
+			table[i].Doc.Idempotent = true
+		}
+	}
+	return table
+}
+
+func NewRouter(userHandler *handler.UserHandler, organizationHandler *handler.OrganizationHandler, invitationHandler *handler.InvitationHandler, bulkHandler *handler.BulkHandler, authMiddleware middleware.Middleware, idempotencyMiddleware middleware.Middleware) http.Handler {
+	mux := http.NewServeMux()
+
+	for _, route := range Table(userHandler, organizationHandler, invitationHandler, bulkHandler) {
+		var h http.Handler = route.Handler
+		if route.BlockImpersonation {
+			h = middleware.BlockImpersonation(h)
+		}
+		if route.Doc.Idempotent {
+			h = idempotencyMiddleware(h)
+		}
+		if route.Doc.Auth == openapi.AuthBearer {
+			h = authMiddleware(h)
+		}
+		mux.Handle(route.Method+" "+route.Path, h)
+	}
+
+	// Docs
+	spec, err := OpenAPI()
+	if err != nil {
+		panic(err)
+	}
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	mux.HandleFunc("GET /docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsPage)
+	})
 
 	// Global middlewares
 	use := middleware.ApplyMiddlewares(
@@ -49,6 +192,34 @@ func NewRouter(userHandler *handler.UserHandler, authMiddleware middleware.Middl
 	return use(mux)
 }
 
+// OpenAPI renders the document for the route table, indented and newline-terminated.
+func OpenAPI() ([]byte, error) {
+	endpoints := []openapi.Endpoint{}
+	for _, route := range Table(nil, nil, nil, nil) {
+		endpoints = append(endpoints, openapi.Endpoint{
+			Method:      route.Method,
+			Path:        route.Path,
+			OperationID: operationID(route.Handler),
+			Operation:   route.Doc,
+		})
+	}
+	spec, err := json.MarshalIndent(openapi.Generate(apiInfo, endpoints), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(spec, '\n'), nil
+}
+
+// Helpers
+// The handler's method name in lower camel case: userHandler.GetAllUsers is getAllUsers.
+func operationID(h http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
 func health(w http.ResponseWriter, r *http.Request) {
 	resp := map[string]string{"health": "ok"}
 	jsonResp, _ := json.Marshal(resp)
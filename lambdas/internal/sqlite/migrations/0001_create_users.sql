@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    id              TEXT PRIMARY KEY,
+    tenant_id       TEXT NOT NULL,
+    email           TEXT NOT NULL,
+    hashed_password TEXT NOT NULL,
+    roles           TEXT NOT NULL DEFAULT '[]',
+    is_active       INTEGER NOT NULL DEFAULT 1,
+    is_verified     INTEGER NOT NULL DEFAULT 0,
+    created_at      TEXT NOT NULL,
+    CONSTRAINT users_tenant_email_key UNIQUE (tenant_id, email)
+);
+
+CREATE INDEX users_tenant_created_idx ON users (tenant_id, created_at, id);
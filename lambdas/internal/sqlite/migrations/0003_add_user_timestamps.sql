@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN last_login_at TEXT;
+ALTER TABLE users ADD COLUMN password_changed_at TEXT;
+
+UPDATE users SET updated_at = created_at;
+
+CREATE INDEX users_tenant_last_login_idx ON users (tenant_id, last_login_at);
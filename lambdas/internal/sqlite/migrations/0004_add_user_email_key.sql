@@ -0,0 +1,28 @@
+-- SQLite can't drop a constraint, so the table is rebuilt with uniqueness on the key.
+-- Existing rows get a lowercased key; it fails on accounts that only differ by case, which need merging by hand first.
+CREATE TABLE users_new (
+    id                  TEXT PRIMARY KEY,
+    tenant_id           TEXT NOT NULL,
+    email               TEXT NOT NULL,
+    email_key           TEXT NOT NULL,
+    hashed_password     TEXT NOT NULL,
+    roles               TEXT NOT NULL DEFAULT '[]',
+    is_active           INTEGER NOT NULL DEFAULT 1,
+    is_verified         INTEGER NOT NULL DEFAULT 0,
+    created_at          TEXT NOT NULL,
+    version             INTEGER NOT NULL DEFAULT 1,
+    updated_at          TEXT NOT NULL DEFAULT '',
+    last_login_at       TEXT,
+    password_changed_at TEXT,
+    CONSTRAINT users_tenant_email_key_key UNIQUE (tenant_id, email_key)
+);
+
+INSERT INTO users_new (id, tenant_id, email, email_key, hashed_password, roles, is_active, is_verified, created_at, version, updated_at, last_login_at, password_changed_at)
+SELECT id, tenant_id, email, lower(email), hashed_password, roles, is_active, is_verified, created_at, version, updated_at, last_login_at, password_changed_at
+FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE INDEX users_tenant_created_idx ON users (tenant_id, created_at, id);
+CREATE INDEX users_tenant_last_login_idx ON users (tenant_id, last_login_at);
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN deactivated_at TEXT;
+
+-- Users deactivated before this column existed start their retention window now
+UPDATE users SET deactivated_at = strftime('%Y-%m-%dT%H:%M:%S', 'now') || '.000000Z' WHERE NOT is_active;
+
+CREATE INDEX users_deactivated_idx ON users (deactivated_at) WHERE NOT is_active;
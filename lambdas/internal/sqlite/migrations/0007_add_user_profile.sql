@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN profile TEXT NOT NULL DEFAULT '{}';
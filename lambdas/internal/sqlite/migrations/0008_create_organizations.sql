@@ -0,0 +1,4 @@
+CREATE TABLE organizations (
+    id   TEXT PRIMARY KEY,
+    name TEXT NOT NULL
+);
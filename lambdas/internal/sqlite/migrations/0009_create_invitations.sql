@@ -0,0 +1,11 @@
+CREATE TABLE invitations (
+    id         TEXT PRIMARY KEY,
+    tenant_id  TEXT NOT NULL,
+    email      TEXT NOT NULL,
+    roles      TEXT NOT NULL DEFAULT '[]',
+    status     TEXT NOT NULL,
+    invited_by TEXT NOT NULL DEFAULT '',
+    expires_at TEXT NOT NULL
+);
+
+CREATE INDEX invitations_tenant_idx ON invitations (tenant_id, expires_at, id);
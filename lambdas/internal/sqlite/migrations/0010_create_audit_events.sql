@@ -0,0 +1,16 @@
+CREATE TABLE audit_events (
+    id            TEXT PRIMARY KEY,
+    tenant_id     TEXT NOT NULL,
+    occurred_at   TEXT NOT NULL,
+    action        TEXT NOT NULL,
+    actor_id      TEXT NOT NULL,
+    actor_email   TEXT NOT NULL DEFAULT '',
+    subject_id    TEXT NOT NULL,
+    subject_email TEXT NOT NULL DEFAULT '',
+    impersonated  INTEGER NOT NULL DEFAULT 0,
+    detail        TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX audit_events_subject_idx ON audit_events (subject_id, occurred_at);
+-- Erasure anonymizes events by actor too
+CREATE INDEX audit_events_actor_idx ON audit_events (actor_id);
@@ -0,0 +1,12 @@
+-- status_code 0 marks a request still running
+CREATE TABLE idempotency_keys (
+    key          TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code  INTEGER NOT NULL DEFAULT 0,
+    header       TEXT NOT NULL DEFAULT '{}',
+    body         BLOB,
+    locked_until TEXT NOT NULL,
+    expires_at   TEXT NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Opens (or creates) the database file in WAL mode and brings the schema up to date.
+func InitSQLite(path string) *sql.DB {
+	db, err := Open(path)
+	if err != nil {
+		log.Fatalf("unable to open sqlite database %q: %v", path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := Migrate(ctx, db); err != nil {
+		log.Fatalf("unable to migrate sqlite schema: %v", err)
+	}
+
+	return db
+}
+
+// Open sets the pragmas on every pooled connection: WAL lets readers run alongside the single writer,
+// and busy_timeout makes writers wait for the lock instead of failing with SQLITE_BUSY.
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,265 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/routes"
+	"github.com/danilobml/user-manager/pkg/client"
+	"github.com/danilobml/user-manager/pkg/client/clienttest"
+)
+
+// Every operation of the OpenAPI document has a client method of the same name.
+func TestClient_CoversEveryOperation(t *testing.T) {
+	spec, err := routes.OpenAPI()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	clientType := reflect.TypeFor[*client.Client]()
+	for path, operations := range doc.Paths {
+		for method, operation := range operations {
+			name := strings.ToUpper(operation.OperationID[:1]) + operation.OperationID[1:]
+			if _, ok := clientType.MethodByName(name); !ok {
+				t.Errorf("%s %s: client has no method %s", strings.ToUpper(method), path, name)
+			}
+		}
+	}
+}
+
+func TestClient_AgainstFakeServer(t *testing.T) {
+	ctx := context.Background()
+	server := clienttest.NewServer(t)
+	admin := server.AdminClient(t)
+	user := server.UserClient(t, "sdk@example.com", strongPass)
+
+	me, err := user.GetUserData(ctx)
+	if err != nil || me.Email != "sdk@example.com" {
+		t.Fatalf("GetUserData expected the user, got %+v, %v", me, err)
+	}
+	check, err := server.Client().CheckUser(ctx, client.CheckUserRequest{Token: loginToken(t, server, "sdk@example.com")})
+	if err != nil || !check.IsValid || check.User.ID != me.ID {
+		t.Fatalf("CheckUser expected a valid user, got %+v, %v", check, err)
+	}
+
+	// Typed errors, matched by code
+	_, err = server.Client().Register(ctx, client.RegisterRequest{Email: "not-an-email", Password: "x"})
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrValidation) || !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || len(apiErr.Fields) != 2 {
+		t.Fatalf("Register expected validation errors for both fields, got %v", err)
+	}
+	if _, err := user.GetAllUsers(ctx, client.ListUsersRequest{}); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("GetAllUsers as a user expected ErrUnauthorized, got %v", err)
+	}
+	if _, err := server.Client().GetUserData(ctx); !errors.Is(err, client.ErrInvalidToken) && !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("GetUserData without a token expected an auth error, got %v", err)
+	}
+
+	// If-Match comes from ExpectedVersion
+	stale := me.Version - 1
+	email := "renamed@example.com"
+	if _, err := admin.PatchUser(ctx, client.PatchUserRequest{ID: me.ID, ExpectedVersion: &stale, Email: &email}); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("PatchUser with a stale version expected ErrPreconditionFailed, got %v", err)
+	}
+	patched, err := admin.PatchUser(ctx, client.PatchUserRequest{ID: me.ID, ExpectedVersion: &me.Version, Email: &email})
+	if err != nil || patched.Email != email || len(patched.Roles) != len(me.Roles) {
+		t.Fatalf("PatchUser expected only the email changed, got %+v, %v", patched, err)
+	}
+
+	// Query parameters come from the query tags
+	page, err := admin.GetAllUsers(ctx, client.ListUsersRequest{EmailPrefix: "renamed", Limit: 10})
+	if err != nil || len(page.Users) != 1 || page.Users[0].ID != me.ID {
+		t.Fatalf("GetAllUsers expected the renamed user, got %+v, %v", page, err)
+	}
+
+	report, err := admin.ImportUsers(ctx, client.CSV, strings.NewReader("email,password\nbulk@example.com,"+strongPass+"\n"), client.ImportOptions{})
+	if err != nil || report.Created != 1 {
+		t.Fatalf("ImportUsers expected one user created, got %+v, %v", report, err)
+	}
+	export, err := admin.ExportUsers(ctx, client.JSONL)
+	if err != nil {
+		t.Fatalf("ExportUsers: %v", err)
+	}
+	defer export.Close()
+	var lines int
+	for decoder := json.NewDecoder(export); decoder.More(); lines++ {
+		var exported client.User
+		if err := decoder.Decode(&exported); err != nil {
+			t.Fatalf("export line %d: %v", lines+1, err)
+		}
+	}
+	if lines != 3 {
+		t.Fatalf("ExportUsers expected 3 users, got %d", lines)
+	}
+}
+
+func TestClient_RetriesWritesWithTheSameIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":"t"}`))
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL, client.WithRetries(2, time.Millisecond))
+	resp, err := c.Register(context.Background(), client.RegisterRequest{Email: "retry@example.com", Password: strongPass})
+	if err != nil || resp.Token != "t" {
+		t.Fatalf("Register expected success on the third attempt, got %+v, %v", resp, err)
+	}
+	if len(keys) != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] != keys[0] {
+		t.Fatalf("expected 3 attempts with one key, got %q", keys)
+	}
+
+	// Writes without a key, like login, are sent once
+	keys = nil
+	_, err = c.Login(context.Background(), client.LoginRequest{Email: "retry@example.com", Password: strongPass})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable || apiErr.Code != "" || len(keys) != 1 {
+		t.Fatalf("Login expected one attempt and a 503, got %v after %d attempts", err, len(keys))
+	}
+}
+
+// The API's own 503s are configuration errors; only ones with a Retry-After are worth another attempt.
+func TestClient_RetriesProblem503OnlyWithRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	retryAfter, code := "", "mail_unavailable"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"title":"Unavailable","status":503,"code":"` + code + `"}`))
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL, client.WithRetries(2, time.Millisecond))
+	err := c.RequestPasswordReset(context.Background(), client.RequestPasswordResetRequest{Email: "retry@example.com"})
+	if !errors.Is(err, client.ErrMailUnavailable) || attempts != 1 {
+		t.Fatalf("mail_unavailable expected once, got %v after %d attempts", err, attempts)
+	}
+
+	// Even with a Retry-After, missing mail settings won't fix themselves
+	attempts, retryAfter = 0, "0"
+	err = c.RequestPasswordReset(context.Background(), client.RequestPasswordResetRequest{Email: "retry@example.com"})
+	if !errors.Is(err, client.ErrMailUnavailable) || attempts != 1 {
+		t.Fatalf("mail_unavailable with Retry-After expected once, got %v after %d attempts", err, attempts)
+	}
+
+	// Other problems are retried only when the API asks for it
+	attempts, retryAfter, code = 0, "", "internal_error"
+	c.RequestPasswordReset(context.Background(), client.RequestPasswordResetRequest{Email: "retry@example.com"})
+	if attempts != 1 {
+		t.Fatalf("a 503 problem without Retry-After expected once, got %d attempts", attempts)
+	}
+	attempts, retryAfter = 0, "0"
+	c.RequestPasswordReset(context.Background(), client.RequestPasswordResetRequest{Email: "retry@example.com"})
+	if attempts != 3 {
+		t.Fatalf("a 503 problem with Retry-After expected 3 attempts, got %d", attempts)
+	}
+}
+
+// The client's codes and sentinels are its own, so they must agree with the API's.
+func TestClient_ErrorCodesMatchTheAPI(t *testing.T) {
+	// Every code the API sends has a constant
+	file, err := parser.ParseFile(token.NewFileSet(), "../../pkg/client/errors.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	clientCodes := map[string]bool{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if spec, ok := node.(*ast.ValueSpec); ok && len(spec.Values) == 1 {
+			if ident, ok := spec.Type.(*ast.Ident); ok && ident.Name == "Code" {
+				value, _ := strconv.Unquote(spec.Values[0].(*ast.BasicLit).Value)
+				clientCodes[value] = true
+			}
+		}
+		return true
+	})
+	apiCodes := map[string]bool{}
+	for _, kind := range errs.Kinds() {
+		apiCodes[string(kind.Code)] = true
+		if !clientCodes[string(kind.Code)] {
+			t.Errorf("the client has no constant for code %s", kind.Code)
+		}
+	}
+	for code := range clientCodes {
+		if !apiCodes[code] {
+			t.Errorf("the API never sends code %s", code)
+		}
+	}
+
+	sentinels := map[error]error{
+		errs.ErrInvalidJSON:             client.ErrInvalidJSON,
+		errs.ErrInvalidID:               client.ErrInvalidID,
+		errs.ErrValidation:              client.ErrValidation,
+		errs.ErrParsingRoles:            client.ErrInvalidRole,
+		errs.ErrInvalidCursor:           client.ErrInvalidCursor,
+		errs.ErrInvalidFormat:           client.ErrInvalidFormat,
+		errs.ErrInvalidInvitation:       client.ErrInvalidInvitation,
+		errs.ErrInvalidProfile:          client.ErrInvalidProfile,
+		errs.ErrAlreadyExists:           client.ErrAlreadyExists,
+		errs.ErrInvalidCredentials:      client.ErrInvalidCredentials,
+		errs.ErrInvalidToken:            client.ErrInvalidToken,
+		errs.ErrUnauthorized:            client.ErrUnauthorized,
+		errs.ErrImpersonationNotAllowed: client.ErrImpersonationNotAllowed,
+		errs.ErrNotFound:                client.ErrNotFound,
+		errs.ErrConflict:                client.ErrConflict,
+		errs.ErrIdempotencyKeyInUse:     client.ErrIdempotencyKeyInUse,
+		errs.ErrIdempotencyKeyReused:    client.ErrIdempotencyKeyReused,
+		errs.ErrRestoreWindowExpired:    client.ErrRestoreWindowExpired,
+		errs.ErrUserErased:              client.ErrUserErased,
+		errs.ErrPreconditionFailed:      client.ErrPreconditionFailed,
+		errs.ErrRequestTooLarge:         client.ErrRequestTooLarge,
+		errs.ErrMailServiceDisabled:     client.ErrMailUnavailable,
+	}
+	for apiErr, sentinel := range sentinels {
+		kind, _ := errs.KindOf(apiErr)
+		if !errors.Is(&client.Error{Code: client.Code(kind.Code)}, sentinel) {
+			t.Errorf("code %s doesn't match %v", kind.Code, sentinel)
+		}
+	}
+}
+
+// Helpers
+func loginToken(t *testing.T, server *clienttest.Server, email string) string {
+	t.Helper()
+	resp, err := server.Client().Login(context.Background(), client.LoginRequest{Email: email, Password: strongPass})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return resp.Token
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+)
+
+func TestIdempotencyRepository(t *testing.T) {
+	stores := map[string]func(t *testing.T) repository.IdempotencyRepository{
+		"InMemory": func(t *testing.T) repository.IdempotencyRepository {
+			return repository.NewIdempotencyRepositoryInMemory()
+		},
+		"DynamoDB": func(t *testing.T) repository.IdempotencyRepository {
+			return repository.NewIdempotencyRepositoryDdb(newFakeDynamo(t))
+		},
+		"SQLite": func(t *testing.T) repository.IdempotencyRepository {
+			return repository.NewIdempotencyRepositorySQLite(openTestSQLite(t))
+		},
+		"Postgres": func(t *testing.T) repository.IdempotencyRepository {
+			return repository.NewIdempotencyRepositoryPostgres(openTestPostgres(t, "idempotency_keys"))
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			now := time.Now().UTC()
+			record := model.IdempotencyRecord{Key: "k1", RequestHash: "h1", LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}
+
+			if existing, err := store.Reserve(ctx, record); err != nil || existing != nil {
+				t.Fatalf("first reserve expected the key, got %+v, %v", existing, err)
+			}
+			existing, err := store.Reserve(ctx, record)
+			if err != nil || existing == nil || existing.IsCompleted() || existing.RequestHash != "h1" {
+				t.Fatalf("second reserve expected the running record, got %+v, %v", existing, err)
+			}
+
+			// Released keys can be taken again
+			if err := store.Release(ctx, "k1"); err != nil {
+				t.Fatalf("release: %v", err)
+			}
+			if existing, err := store.Reserve(ctx, record); err != nil || existing != nil {
+				t.Fatalf("reserve after release expected the key, got %+v, %v", existing, err)
+			}
+
+			record.StatusCode = 201
+			record.Header = map[string]string{"Content-Type": "application/json"}
+			record.Body = []byte(`{"ok":true}`)
+			if err := store.Complete(ctx, record); err != nil {
+				t.Fatalf("complete: %v", err)
+			}
+			// Completed responses survive a release and the end of the lock
+			if err := store.Release(ctx, "k1"); err != nil {
+				t.Fatalf("release: %v", err)
+			}
+			existing, err = store.Reserve(ctx, model.IdempotencyRecord{Key: "k1", RequestHash: "h2", LockedUntil: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)})
+			if err != nil || existing == nil || existing.StatusCode != 201 || string(existing.Body) != `{"ok":true}` || existing.Header["Content-Type"] != "application/json" {
+				t.Fatalf("expected the completed response, got %+v, %v", existing, err)
+			}
+
+			// Abandoned and expired keys are taken over
+			if _, err := store.Reserve(ctx, model.IdempotencyRecord{Key: "k2", LockedUntil: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)}); err != nil {
+				t.Fatalf("reserve: %v", err)
+			}
+			if existing, err := store.Reserve(ctx, model.IdempotencyRecord{Key: "k2", LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}); err != nil || existing != nil {
+				t.Fatalf("abandoned key expected to be taken over, got %+v, %v", existing, err)
+			}
+			expired := model.IdempotencyRecord{Key: "k3", StatusCode: 200, ExpiresAt: now.Add(-time.Minute)}
+			if err := store.Complete(ctx, expired); err != nil {
+				t.Fatalf("complete: %v", err)
+			}
+			if existing, err := store.Reserve(ctx, model.IdempotencyRecord{Key: "k3", LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}); err != nil || existing != nil {
+				t.Fatalf("expired key expected to be taken over, got %+v, %v", existing, err)
+			}
+		})
+	}
+}
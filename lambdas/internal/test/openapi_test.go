@@ -0,0 +1,60 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/danilobml/user-manager/internal/routes"
+	"github.com/google/uuid"
+)
+
+// Fails when the route table and api/openapi.json drift apart; run `make openapi` to regenerate it.
+func TestOpenAPI_MatchesRoutesAndCommittedDocument(t *testing.T) {
+	spec, err := routes.OpenAPI()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	committed, err := os.ReadFile("../../api/openapi.json")
+	if err != nil {
+		t.Fatalf("read committed document: %v", err)
+	}
+	if !bytes.Equal(spec, committed) {
+		t.Fatal("api/openapi.json is out of date, run make openapi")
+	}
+
+	deps := buildTestServer(t)
+	rr := httptest.NewRecorder()
+	deps.router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), spec) {
+		t.Fatalf("GET /openapi.json expected the document, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	deps.router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "openapi.json") {
+		t.Fatalf("GET /docs expected the docs page, got %d", rr.Code)
+	}
+
+	// Every documented operation is routed: the mux answers unknown ones with a plain-text 404 or 405
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	for path, operations := range doc.Paths {
+		target := strings.ReplaceAll(path, "{id}", uuid.NewString())
+		for method := range operations {
+			method = strings.ToUpper(method)
+			rr := httptest.NewRecorder()
+			deps.router.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+			if strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") && (rr.Code == http.StatusNotFound || rr.Code == http.StatusMethodNotAllowed) {
+				t.Errorf("%s %s is documented but not routed (%d)", method, path, rr.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+)
+
+// The persistent backends behave like the in-memory repositories the services are tested with.
+
+func TestOrganizationRepository(t *testing.T) {
+	stores := map[string]func(t *testing.T) repository.OrganizationRepository{
+		"InMemory": func(t *testing.T) repository.OrganizationRepository {
+			return repository.NewOrganizationRepositoryInMemory()
+		},
+		"SQLite": func(t *testing.T) repository.OrganizationRepository {
+			return repository.NewOrganizationRepositorySQLite(openTestSQLite(t))
+		},
+		"Postgres": func(t *testing.T) repository.OrganizationRepository {
+			return repository.NewOrganizationRepositoryPostgres(openTestPostgres(t, "organizations"))
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			acme := model.Organization{ID: uuid.New(), Name: "Acme"}
+			globex := model.Organization{ID: uuid.New(), Name: "Globex"}
+			for _, organization := range []model.Organization{acme, globex} {
+				if err := store.Create(ctx, organization); err != nil {
+					t.Fatalf("create %s: %v", organization.Name, err)
+				}
+			}
+
+			found, err := store.FindById(ctx, acme.ID)
+			if err != nil || found == nil || *found != acme {
+				t.Fatalf("FindById expected %+v, got %+v, %v", acme, found, err)
+			}
+			// Not found is nil or ErrNotFound, depending on the backend
+			if found, err := store.FindById(ctx, uuid.New()); found != nil || (err != nil && !errors.Is(err, errs.ErrNotFound)) {
+				t.Fatalf("FindById of an unknown id expected nothing, got %+v, %v", found, err)
+			}
+			organizations, err := store.List(ctx)
+			if err != nil || len(organizations) != 2 {
+				t.Fatalf("List expected both organizations, got %+v, %v", organizations, err)
+			}
+		})
+	}
+}
+
+func TestInvitationRepository(t *testing.T) {
+	stores := map[string]func(t *testing.T) repository.InvitationRepository{
+		"InMemory": func(t *testing.T) repository.InvitationRepository {
+			return repository.NewInvitationRepositoryInMemory()
+		},
+		"SQLite": func(t *testing.T) repository.InvitationRepository {
+			return repository.NewInvitationRepositorySQLite(openTestSQLite(t))
+		},
+		"Postgres": func(t *testing.T) repository.InvitationRepository {
+			return repository.NewInvitationRepositoryPostgres(openTestPostgres(t, "invitations"))
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			tenantID := uuid.New()
+			invitation := model.Invitation{
+				ID:        uuid.New(),
+				TenantID:  tenantID,
+				Email:     "Invitee@Example.com",
+				Roles:     []model.Role{model.AppUser},
+				Status:    model.InvitationPending,
+				InvitedBy: "admin@example.com",
+				ExpiresAt: time.Now().UTC().Add(time.Hour).Truncate(time.Microsecond),
+			}
+			if err := store.Create(ctx, invitation); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if err := store.Create(ctx, model.Invitation{ID: uuid.New(), TenantID: uuid.New(), Email: "other@example.com", Status: model.InvitationPending, ExpiresAt: invitation.ExpiresAt}); err != nil {
+				t.Fatalf("create in another tenant: %v", err)
+			}
+
+			found, err := store.FindById(ctx, invitation.ID)
+			if err != nil || found == nil || found.Email != invitation.Email || found.InvitedBy != invitation.InvitedBy ||
+				!found.ExpiresAt.Equal(invitation.ExpiresAt) || len(found.Roles) != 1 || found.Roles[0] != model.AppUser {
+				t.Fatalf("FindById expected %+v, got %+v, %v", invitation, found, err)
+			}
+			if found, err := store.FindById(ctx, uuid.New()); found != nil || (err != nil && !errors.Is(err, errs.ErrNotFound)) {
+				t.Fatalf("FindById of an unknown id expected nothing, got %+v, %v", found, err)
+			}
+
+			invitation.Status = model.InvitationRevoked
+			invitation.Roles = []model.Role{model.AppUser, model.Admin}
+			if err := store.Update(ctx, invitation); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			invitations, err := store.List(ctx, tenantID)
+			if err != nil || len(invitations) != 1 || invitations[0].Status != model.InvitationRevoked || len(invitations[0].Roles) != 2 {
+				t.Fatalf("List expected the updated invitation only, got %+v, %v", invitations, err)
+			}
+		})
+	}
+}
+
+func TestAuditRepository(t *testing.T) {
+	stores := map[string]func(t *testing.T) repository.AuditRepository{
+		"InMemory": func(t *testing.T) repository.AuditRepository {
+			return repository.NewAuditRepositoryInMemory()
+		},
+		"SQLite": func(t *testing.T) repository.AuditRepository {
+			return repository.NewAuditRepositorySQLite(openTestSQLite(t))
+		},
+		"Postgres": func(t *testing.T) repository.AuditRepository {
+			return repository.NewAuditRepositoryPostgres(openTestPostgres(t, "audit_events"))
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			admin, user := uuid.New(), uuid.New()
+			now := time.Now().UTC().Truncate(time.Microsecond)
+			events := []model.AuditEvent{
+				{ID: uuid.New(), OccurredAt: now, Action: model.AuditImpersonationStarted, ActorID: admin, ActorEmail: "admin@example.com", SubjectID: user, SubjectEmail: "user@example.com"},
+				{ID: uuid.New(), OccurredAt: now.Add(time.Second), Action: model.AuditImpersonatedRequest, ActorID: admin, ActorEmail: "admin@example.com", SubjectID: user, SubjectEmail: "user@example.com", Impersonated: true, Detail: "GET /users/data"},
+				{ID: uuid.New(), OccurredAt: now, Action: model.AuditUserExported, ActorID: user, ActorEmail: "user@example.com", SubjectID: admin, SubjectEmail: "admin@example.com"},
+			}
+			for _, event := range events {
+				if err := store.Record(ctx, event); err != nil {
+					t.Fatalf("record: %v", err)
+				}
+			}
+
+			listed, err := store.ListBySubject(ctx, user)
+			if err != nil || len(listed) != 2 || !listed[1].Impersonated || listed[1].Detail != "GET /users/data" || !listed[0].OccurredAt.Equal(now) {
+				t.Fatalf("ListBySubject expected the two events about the user, got %+v, %v", listed, err)
+			}
+
+			changed, err := store.AnonymizeUser(ctx, user, "erased")
+			if err != nil || changed != 3 {
+				t.Fatalf("AnonymizeUser expected 3 events changed, got %d, %v", changed, err)
+			}
+			listed, _ = store.ListBySubject(ctx, user)
+			if listed[0].SubjectEmail != "erased" || listed[0].ActorEmail != "admin@example.com" {
+				t.Fatalf("expected only the user's email replaced, got %+v", listed[0])
+			}
+			listed, _ = store.ListBySubject(ctx, admin)
+			if listed[0].ActorEmail != "erased" || listed[0].SubjectEmail != "admin@example.com" {
+				t.Fatalf("expected only the user's email replaced, got %+v", listed[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+	"github.com/google/uuid"
+)
+
+// Meant to be run with -race
+func TestOrganizationRepositoryInMemory_ConcurrentAccessAndCopies(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewOrganizationRepositoryInMemory()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			organization := model.Organization{ID: uuid.New(), Name: fmt.Sprintf("org %d", i)}
+			if err := repo.Create(ctx, organization); err != nil {
+				t.Errorf("create: %v", err)
+				return
+			}
+			_, _ = repo.FindById(ctx, organization.ID)
+			_, _ = repo.List(ctx)
+		}()
+	}
+	wg.Wait()
+
+	organizations, err := repo.List(ctx)
+	if err != nil || len(organizations) != 50 {
+		t.Fatalf("expected 50 organizations, got %d (%v)", len(organizations), err)
+	}
+	found, _ := repo.FindById(ctx, organizations[0].ID)
+	found.Name = "changed"
+	if stored, _ := repo.FindById(ctx, found.ID); stored.Name == "changed" {
+		t.Fatal("changing a returned organization changed the stored one")
+	}
+}
+
+// Meant to be run with -race
+func TestInvitationRepositoryInMemory_ConcurrentAccessAndCopies(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInvitationRepositoryInMemory()
+	tenantID := uuid.New()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			invitation := model.Invitation{ID: uuid.New(), TenantID: tenantID, Email: fmt.Sprintf("invitee%d@example.com", i), Roles: []model.Role{model.AppUser}, Status: model.InvitationPending}
+			if err := repo.Create(ctx, invitation); err != nil {
+				t.Errorf("create: %v", err)
+				return
+			}
+			invitation.Status = model.InvitationRevoked
+			_ = repo.Update(ctx, invitation)
+			_, _ = repo.FindById(ctx, invitation.ID)
+			_, _ = repo.List(ctx, tenantID)
+		}()
+	}
+	wg.Wait()
+
+	invitations, err := repo.List(ctx, tenantID)
+	if err != nil || len(invitations) != 50 {
+		t.Fatalf("expected 50 invitations, got %d (%v)", len(invitations), err)
+	}
+	found, _ := repo.FindById(ctx, invitations[0].ID)
+	found.Status = model.InvitationAccepted
+	found.Roles[0] = model.Admin
+	if stored, _ := repo.FindById(ctx, found.ID); stored.Status != model.InvitationRevoked || stored.Roles[0] != model.AppUser {
+		t.Fatalf("changing a returned invitation changed the stored one: %+v", stored)
+	}
+}
+
+// Meant to be run with -race
+func TestAuditRepositoryInMemory_ConcurrentAccessAndCopies(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewAuditRepositoryInMemory()
+	subjectID := uuid.New()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event := model.AuditEvent{ID: uuid.New(), Action: model.AuditImpersonatedRequest, SubjectID: subjectID, SubjectEmail: "subject@example.com"}
+			if err := repo.Record(ctx, event); err != nil {
+				t.Errorf("record: %v", err)
+				return
+			}
+			_, _ = repo.ListBySubject(ctx, subjectID)
+		}()
+	}
+	wg.Wait()
+
+	events, err := repo.ListBySubject(ctx, subjectID)
+	if err != nil || len(events) != 50 {
+		t.Fatalf("expected 50 events, got %d (%v)", len(events), err)
+	}
+	if _, err := repo.AnonymizeUser(ctx, subjectID, "erased"); err != nil {
+		t.Fatalf("anonymize: %v", err)
+	}
+	if events[0].SubjectEmail != "subject@example.com" {
+		t.Fatal("anonymizing changed an event returned earlier")
+	}
+	events[0].Action = "changed"
+	if stored, _ := repo.ListBySubject(ctx, subjectID); stored[0].Action == "changed" || stored[0].SubjectEmail != "erased" {
+		t.Fatalf("expected stored events anonymized and unchanged by callers, got %+v", stored[0])
+	}
+}
@@ -2,30 +2,51 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
 	"github.com/danilobml/user-manager/internal/httpx/middleware"
 	"github.com/danilobml/user-manager/internal/mocks"
 	"github.com/danilobml/user-manager/internal/routes"
 	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
 	"github.com/danilobml/user-manager/internal/user/handler"
 	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/profile"
 	"github.com/danilobml/user-manager/internal/user/repository"
 	"github.com/danilobml/user-manager/internal/user/service"
+	"github.com/google/uuid"
 )
 
 const strongPass = "StrongP@ssw0rd12345"
 
+var testLifecycle = service.Lifecycle{RestoreGracePeriod: 14 * 24 * time.Hour, PurgeRetention: 30 * 24 * time.Hour}
+
+const testProfileSchema = `{"attributes": [
+	{"name": "department", "type": "string", "visibility": "admin"},
+	{"name": "employee_no", "type": "string", "pattern": "E[0-9]{4}"},
+	{"name": "pronouns", "type": "string", "visibility": "public"},
+	{"name": "newsletter", "type": "boolean"}
+]}`
+
 type testDeps struct {
 	router http.Handler
 	apiKey string
 	mailer *mocks.MockMailer
 	jwt    *jwt.JwtManager
 	repo   repository.UserRepository
+	users  *service.UserServiceImpl
+	audit  repository.AuditRepository
 }
 
 func buildTestServer(t *testing.T) testDeps {
@@ -34,15 +55,41 @@ func buildTestServer(t *testing.T) testDeps {
 	jm := jwt.NewJwtManager(secret)
 
 	repo := repository.NewUserRepositoryInMemory()
+	orgRepo := repository.NewOrganizationRepositoryInMemory()
+	invRepo := repository.NewInvitationRepositoryInMemory()
+	auditRepo := repository.NewAuditRepositoryInMemory()
 	mailer := &mocks.MockMailer{}
-	userSvc := service.NewUserserviceImpl(repo, jm, mailer, "http://localhost")
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{})
+	profileSchemas, err := profile.ParseSchemas(testProfileSchema)
+	if err != nil {
+		t.Fatalf("profile schema: %v", err)
+	}
+	userSvc := service.NewUserserviceImpl(repo, orgRepo, auditRepo, jm, mailer, "http://localhost", emailNormalizer, testLifecycle, profileSchemas)
+	orgSvc := service.NewOrganizationServiceImpl(orgRepo, repo, emailNormalizer)
+	invSvc := service.NewInvitationServiceImpl(invRepo, orgRepo, repo, jm, mailer, "http://localhost", emailNormalizer)
 	apiKey := "test-api-key"
 
 	uh := handler.NewUserHandler(userSvc, apiKey)
-	auth := middleware.Authenticate(jm)
-	router := routes.NewRouter(uh, auth)
+	oh := handler.NewOrganizationHandler(orgSvc)
+	ih := handler.NewInvitationHandler(invSvc)
+	bh := handler.NewBulkHandler(service.NewBulkServiceImpl(repo, invSvc, emailNormalizer, profileSchemas))
+	auth := middleware.ApplyMiddlewares(middleware.Authenticate(jm), middleware.AuditImpersonation(auditRepo))
+	idempotency := middleware.Idempotency(repository.NewIdempotencyRepositoryInMemory(), 24*time.Hour)
+	router := routes.NewRouter(uh, oh, ih, bh, auth, idempotency)
 
-	return testDeps{router: router, apiKey: apiKey, mailer: mailer, jwt: jm, repo: repo}
+	return testDeps{router: router, apiKey: apiKey, mailer: mailer, jwt: jm, repo: repo, users: userSvc, audit: auditRepo}
+}
+
+// Admins can't self-register, so tests create them through the bootstrap path and log in.
+func bootstrapAdmin(t *testing.T, deps testDeps, email string) string {
+	t.Helper()
+	if err := deps.users.BootstrapAdmin(context.Background(), email, strongPass); err != nil {
+		t.Fatalf("bootstrap admin: %v", err)
+	}
+	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: email, Password: strongPass})
+	var loginResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(lr.Body.Bytes(), &loginResp)
+	return loginResp.Token
 }
 
 func doJSON(t *testing.T, h http.Handler, method, path string, headers map[string]string, body any) *httptest.ResponseRecorder {
@@ -65,7 +112,7 @@ func doJSON(t *testing.T, h http.Handler, method, path string, headers map[strin
 func TestRegisterAndLogin(t *testing.T) {
 	deps := buildTestServer(t)
 
-	reg := dtos.RegisterRequest{Email: "user1@example.com", Password: strongPass, Roles: []string{"user"}}
+	reg := dtos.RegisterRequest{Email: "user1@example.com", Password: strongPass}
 	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, reg)
 	if rr.Code != http.StatusCreated {
 		t.Fatalf("register expected 201, got %d (%s)", rr.Code, rr.Body.String())
@@ -86,7 +133,7 @@ func TestGetUserData_Authorized(t *testing.T) {
 	deps := buildTestServer(t)
 
 	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
-		Email: "me@example.com", Password: strongPass, Roles: []string{"user"},
+		Email: "me@example.com", Password: strongPass,
 	})
 	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{
 		Email: "me@example.com", Password: strongPass,
@@ -111,7 +158,7 @@ func TestCheckUser_WithApiKey(t *testing.T) {
 	deps := buildTestServer(t)
 
 	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
-		Email: "check@example.com", Password: strongPass, Roles: []string{"user"},
+		Email: "check@example.com", Password: strongPass,
 	})
 	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{
 		Email: "check@example.com", Password: strongPass,
@@ -134,18 +181,11 @@ func TestGetUsers_AdminOnly(t *testing.T) {
 	deps := buildTestServer(t)
 
 	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
-		Email: "a@example.com", Password: strongPass, Roles: []string{"user"},
-	})
-	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
-		Email: "admin@example.com", Password: strongPass, Roles: []string{"admin"},
+		Email: "a@example.com", Password: strongPass,
 	})
-	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{
-		Email: "admin@example.com", Password: strongPass,
-	})
-	var loginResp struct{ Token string `json:"token"` }
-	_ = json.Unmarshal(lr.Body.Bytes(), &loginResp)
+	adminToken := bootstrapAdmin(t, deps, "admin@example.com")
 
-	h := map[string]string{"Authorization": "Bearer " + loginResp.Token}
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
 	rr := doJSON(t, deps.router, http.MethodGet, "/users", h, nil)
 	if rr.Code != http.StatusOK {
 		t.Fatalf("GET /users expected 200 for admin, got %d (%s)", rr.Code, rr.Body.String())
@@ -156,7 +196,7 @@ func TestRequestPasswordReset_SendsEmail(t *testing.T) {
 	deps := buildTestServer(t)
 
 	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
-		Email: "user@example.com", Password: strongPass, Roles: []string{"user"},
+		Email: "user@example.com", Password: strongPass,
 	})
 
 	rr := doJSON(t, deps.router, http.MethodPost, "/request-password", nil, dtos.RequestPasswordResetRequest{
@@ -180,7 +220,7 @@ func TestRequestPasswordReset_SendsEmail(t *testing.T) {
 func TestRegister_InvalidPasswordTooShort(t *testing.T) {
 	deps := buildTestServer(t)
 
-	reg := dtos.RegisterRequest{Email: "short@example.com", Password: "x", Roles: []string{"user"}}
+	reg := dtos.RegisterRequest{Email: "short@example.com", Password: "x"}
 	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, reg)
 	if rr.Code == http.StatusCreated {
 		t.Fatalf("expected validation error, got 201")
@@ -193,7 +233,7 @@ func TestRegister_InvalidPasswordTooShort(t *testing.T) {
 func TestRegister_DuplicateEmail(t *testing.T) {
 	deps := buildTestServer(t)
 
-	body := dtos.RegisterRequest{Email: "dup@example.com", Password: strongPass, Roles: []string{"user"}}
+	body := dtos.RegisterRequest{Email: "dup@example.com", Password: strongPass}
 	r1 := doJSON(t, deps.router, http.MethodPost, "/register", nil, body)
 	if r1.Code != http.StatusCreated {
 		t.Fatalf("first register expected 201, got %d", r1.Code)
@@ -212,7 +252,7 @@ func TestLogin_WrongPassword_Unauthorized(t *testing.T) {
 	deps := buildTestServer(t)
 
 	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
-		Email: "login@example.com", Password: strongPass, Roles: []string{"user"},
+		Email: "login@example.com", Password: strongPass,
 	})
 	rr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{
 		Email: "login@example.com", Password: "WrongPass!!",
@@ -243,7 +283,7 @@ func TestCheckUser_MissingApiKey(t *testing.T) {
 
 	// Need a token to fail on API key step (so create a valid user+token)
 	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
-		Email: "chk@example.com", Password: strongPass, Roles: []string{"user"},
+		Email: "chk@example.com", Password: strongPass,
 	})
 	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{
 		Email: "chk@example.com", Password: strongPass,
@@ -288,3 +328,1139 @@ func TestUpdateUser_BadID_BadRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestTenantIsolation_AdminsOnlySeeOwnOrganization(t *testing.T) {
+	deps := buildTestServer(t)
+
+	platformToken := bootstrapAdmin(t, deps, "platform@example.com")
+
+	h := map[string]string{"Authorization": "Bearer " + platformToken}
+	rr := doJSON(t, deps.router, http.MethodPost, "/organizations", h, dtos.CreateOrganizationRequest{Name: "Acme"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create organization expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var org struct {
+		ID uuid.UUID `json:"id"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &org)
+
+	// Public registration only joins the default organization
+	rr = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
+		TenantID: org.ID, Email: "intruder@example.com", Password: strongPass,
+	})
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("register into another organization expected 401, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	unknownOrg := uuid.New()
+	if rr := doJSON(t, deps.router, http.MethodPost, "/invitations", h, dtos.CreateInvitationRequest{
+		TenantID: &unknownOrg, Email: "nowhere@example.com",
+	}); rr.Code != http.StatusNotFound {
+		t.Fatalf("invite into an unknown organization expected 404, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	// The platform admin invites into the new organization; the same email may exist once per tenant
+	join := func(email string) string {
+		t.Helper()
+		rr := doJSON(t, deps.router, http.MethodPost, "/invitations", h, dtos.CreateInvitationRequest{
+			TenantID: &org.ID, Email: email,
+		})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("invite %s expected 201, got %d (%s)", email, rr.Code, rr.Body.String())
+		}
+		_, inviteToken, _ := strings.Cut(deps.mailer.Message, "token=")
+		ar := doJSON(t, deps.router, http.MethodPost, "/invitations/accept", nil, dtos.AcceptInvitationRequest{
+			Token: strings.Fields(inviteToken)[0], Password: strongPass,
+		})
+		if ar.Code != http.StatusCreated {
+			t.Fatalf("accept %s expected 201, got %d (%s)", email, ar.Code, ar.Body.String())
+		}
+		var acceptResp struct{ Token string `json:"token"` }
+		_ = json.Unmarshal(ar.Body.Bytes(), &acceptResp)
+		return acceptResp.Token
+	}
+	join("platform@example.com")
+	var tenantAdminResp struct{ Token string `json:"token"` }
+	tenantAdminResp.Token = join("acme-admin@example.com")
+
+	// The platform admin promotes the first admin of the new organization
+	th := map[string]string{"Authorization": "Bearer " + tenantAdminResp.Token}
+	dr := doJSON(t, deps.router, http.MethodGet, "/users/data", th, nil)
+	var tenantAdmin dtos.ResponseUser
+	_ = json.Unmarshal(dr.Body.Bytes(), &tenantAdmin)
+	pr := doJSON(t, deps.router, http.MethodPut, "/admin/users/"+tenantAdmin.ID.String()+"/roles", h, dtos.AssignRolesRequest{
+		Roles: []string{"admin"},
+	})
+	if pr.Code != http.StatusOK {
+		t.Fatalf("assign roles expected 200, got %d (%s)", pr.Code, pr.Body.String())
+	}
+	lr2 := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{
+		TenantID: org.ID, Email: "acme-admin@example.com", Password: strongPass,
+	})
+	_ = json.Unmarshal(lr2.Body.Bytes(), &tenantAdminResp)
+
+	th = map[string]string{"Authorization": "Bearer " + tenantAdminResp.Token}
+	lr := doJSON(t, deps.router, http.MethodGet, "/users", th, nil)
+	if lr.Code != http.StatusOK {
+		t.Fatalf("GET /users expected 200, got %d (%s)", lr.Code, lr.Body.String())
+	}
+	var listResp dtos.GetAllUsersResponse
+	_ = json.Unmarshal(lr.Body.Bytes(), &listResp)
+	if len(listResp.Users) != 2 {
+		t.Fatalf("expected 2 users in tenant, got %d (%s)", len(listResp.Users), lr.Body.String())
+	}
+	for _, u := range listResp.Users {
+		if u.TenantID != org.ID {
+			t.Fatalf("tenant admin saw user of another tenant: %+v", u)
+		}
+	}
+
+	// Tenant admins can't manage organizations
+	or := doJSON(t, deps.router, http.MethodGet, "/organizations", th, nil)
+	if or.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /organizations expected 401 for tenant admin, got %d", or.Code)
+	}
+	// ...or invite into other organizations
+	defaultTenant := model.DefaultTenantID
+	if ir := doJSON(t, deps.router, http.MethodPost, "/invitations", th, dtos.CreateInvitationRequest{
+		TenantID: &defaultTenant, Email: "elsewhere@example.com",
+	}); ir.Code != http.StatusUnauthorized {
+		t.Fatalf("tenant admin inviting into another organization expected 401, got %d (%s)", ir.Code, ir.Body.String())
+	}
+}
+
+func TestInvitation_AcceptCreatesVerifiedUser(t *testing.T) {
+	deps := buildTestServer(t)
+
+	adminToken := bootstrapAdmin(t, deps, "inviter@example.com")
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/invitations", h, dtos.CreateInvitationRequest{
+		Email: "invitee@example.com", Roles: []string{"admin"},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create invitation expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if len(deps.mailer.To) != 1 || deps.mailer.To[0] != "invitee@example.com" {
+		t.Fatalf("expected invitation sent to invitee@example.com, got %+v", deps.mailer.To)
+	}
+	_, inviteToken, found := strings.Cut(deps.mailer.Message, "token=")
+	if !found {
+		t.Fatalf("expected invite link in message, got %q", deps.mailer.Message)
+	}
+	inviteToken = strings.Fields(inviteToken)[0]
+
+	ar := doJSON(t, deps.router, http.MethodPost, "/invitations/accept", nil, dtos.AcceptInvitationRequest{
+		Token: inviteToken, Password: strongPass,
+	})
+	if ar.Code != http.StatusCreated {
+		t.Fatalf("accept invitation expected 201, got %d (%s)", ar.Code, ar.Body.String())
+	}
+	var acceptResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(ar.Body.Bytes(), &acceptResp)
+
+	ih := map[string]string{"Authorization": "Bearer " + acceptResp.Token}
+	dr := doJSON(t, deps.router, http.MethodGet, "/users/data", ih, nil)
+	var me dtos.ResponseUser
+	_ = json.Unmarshal(dr.Body.Bytes(), &me)
+	if !me.IsVerified || len(me.Roles) != 1 || me.Roles[0] != "admin" {
+		t.Fatalf("expected verified admin from invitation, got %+v", me)
+	}
+
+	// An accepted invitation can't be used twice
+	again := doJSON(t, deps.router, http.MethodPost, "/invitations/accept", nil, dtos.AcceptInvitationRequest{
+		Token: inviteToken, Password: strongPass,
+	})
+	if again.Code != http.StatusBadRequest {
+		t.Fatalf("second accept expected 400, got %d (%s)", again.Code, again.Body.String())
+	}
+}
+
+func TestInvitation_RevokedCannotBeAccepted(t *testing.T) {
+	deps := buildTestServer(t)
+
+	adminToken := bootstrapAdmin(t, deps, "inviter@example.com")
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/invitations", h, dtos.CreateInvitationRequest{
+		Email: "revoked@example.com",
+	})
+	var invitation dtos.ResponseInvitation
+	_ = json.Unmarshal(rr.Body.Bytes(), &invitation)
+	_, inviteToken, _ := strings.Cut(deps.mailer.Message, "token=")
+	inviteToken = strings.Fields(inviteToken)[0]
+
+	dr := doJSON(t, deps.router, http.MethodDelete, "/invitations/"+invitation.ID.String(), h, nil)
+	if dr.Code != http.StatusNoContent {
+		t.Fatalf("revoke expected 204, got %d (%s)", dr.Code, dr.Body.String())
+	}
+
+	lr := doJSON(t, deps.router, http.MethodGet, "/invitations", h, nil)
+	if !strings.Contains(lr.Body.String(), `"status":"revoked"`) {
+		t.Fatalf("expected revoked invitation in list, got %s", lr.Body.String())
+	}
+
+	ar := doJSON(t, deps.router, http.MethodPost, "/invitations/accept", nil, dtos.AcceptInvitationRequest{
+		Token: inviteToken, Password: strongPass,
+	})
+	if ar.Code != http.StatusBadRequest {
+		t.Fatalf("accepting revoked invitation expected 400, got %d (%s)", ar.Code, ar.Body.String())
+	}
+}
+
+func TestRegister_IgnoresRequestedAdminRole(t *testing.T) {
+	deps := buildTestServer(t)
+
+	body := map[string]any{"email": "sneaky@example.com", "password": strongPass, "roles": []string{"admin"}}
+	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("register expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var regResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &regResp)
+	h := map[string]string{"Authorization": "Bearer " + regResp.Token}
+
+	lr := doJSON(t, deps.router, http.MethodGet, "/users", h, nil)
+	if lr.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /users expected 401 for self-registered user, got %d (%s)", lr.Code, lr.Body.String())
+	}
+
+	dr := doJSON(t, deps.router, http.MethodGet, "/users/data", h, nil)
+	var me dtos.ResponseUser
+	_ = json.Unmarshal(dr.Body.Bytes(), &me)
+	if len(me.Roles) != 1 || me.Roles[0] != "user" {
+		t.Fatalf("expected default role only, got %+v", me.Roles)
+	}
+
+	// Owners can't grant themselves roles through the update endpoint either
+	ur := doJSON(t, deps.router, http.MethodPut, "/users/"+me.ID.String(), h, dtos.UpdateUserRequest{
+		Email: me.Email, Roles: []string{"admin"},
+	})
+	if ur.Code != http.StatusUnauthorized {
+		t.Fatalf("self role update expected 401, got %d (%s)", ur.Code, ur.Body.String())
+	}
+	ar := doJSON(t, deps.router, http.MethodPut, "/admin/users/"+me.ID.String()+"/roles", h, dtos.AssignRolesRequest{
+		Roles: []string{"admin"},
+	})
+	if ar.Code != http.StatusUnauthorized {
+		t.Fatalf("admin endpoint expected 401 for non-admin, got %d (%s)", ar.Code, ar.Body.String())
+	}
+}
+
+func TestBootstrapAdmin_OnlyOnce(t *testing.T) {
+	deps := buildTestServer(t)
+
+	_ = bootstrapAdmin(t, deps, "first@example.com")
+	err := deps.users.BootstrapAdmin(context.Background(), "second@example.com", strongPass)
+	if !errors.Is(err, errs.ErrAlreadyBootstrapped) {
+		t.Fatalf("expected ErrAlreadyBootstrapped, got %v", err)
+	}
+}
+
+func TestImpersonation_ActsAsUserAndIsAudited(t *testing.T) {
+	deps := buildTestServer(t)
+
+	adminToken := bootstrapAdmin(t, deps, "support@example.com")
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	reg := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{
+		Email: "customer@example.com", Password: strongPass,
+	})
+	var regResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(reg.Body.Bytes(), &regResp)
+	dr := doJSON(t, deps.router, http.MethodGet, "/users/data", map[string]string{"Authorization": "Bearer " + regResp.Token}, nil)
+	var customer dtos.ResponseUser
+	_ = json.Unmarshal(dr.Body.Bytes(), &customer)
+
+	ir := doJSON(t, deps.router, http.MethodPost, "/admin/users/"+customer.ID.String()+"/impersonate", h, nil)
+	if ir.Code != http.StatusOK {
+		t.Fatalf("impersonate expected 200, got %d (%s)", ir.Code, ir.Body.String())
+	}
+	var impResp dtos.ImpersonateResponse
+	_ = json.Unmarshal(ir.Body.Bytes(), &impResp)
+
+	ih := map[string]string{"Authorization": "Bearer " + impResp.Token}
+	rr := doJSON(t, deps.router, http.MethodGet, "/users/data", ih, nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "customer@example.com") {
+		t.Fatalf("expected to act as customer, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	ur := doJSON(t, deps.router, http.MethodPut, "/users/"+customer.ID.String(), ih, dtos.UpdateUserRequest{
+		Email: "hijacked@example.com",
+	})
+	if ur.Code != http.StatusForbidden {
+		t.Fatalf("update while impersonating expected 403, got %d (%s)", ur.Code, ur.Body.String())
+	}
+
+	cr := doJSON(t, deps.router, http.MethodPost, "/check-user", map[string]string{"User-Api-Key": deps.apiKey}, dtos.CheckUserRequest{
+		Token: impResp.Token,
+	})
+	if !strings.Contains(cr.Body.String(), `"impersonated_by":"support@example.com"`) {
+		t.Fatalf("expected check-user to expose the actor, got %s", cr.Body.String())
+	}
+
+	events, _ := deps.audit.ListBySubject(context.Background(), customer.ID)
+	if len(events) != 3 {
+		t.Fatalf("expected start + 2 impersonated request events, got %d", len(events))
+	}
+	for _, e := range events {
+		if !e.Impersonated || e.ActorEmail != "support@example.com" {
+			t.Fatalf("expected impersonation flagged with actor, got %+v", e)
+		}
+	}
+}
+
+func TestRoleHierarchy_InheritsAndDetectsCycles(t *testing.T) {
+	perms := model.DefaultRoleHierarchy.EffectivePermissions([]model.Role{model.SuperAdmin})
+	for _, p := range []model.Permission{model.PermManageOrganizations, model.PermManageUsers, model.PermReadUsers, model.PermManageOwnAccount} {
+		if !perms.Has(p) {
+			t.Fatalf("super-admin should inherit %s", p)
+		}
+	}
+	if model.DefaultRoleHierarchy.EffectivePermissions([]model.Role{model.Support}).Has(model.PermManageUsers) {
+		t.Fatalf("support must not inherit admin permissions")
+	}
+
+	_, err := model.NewRoleHierarchy(map[model.Role][]model.Role{
+		model.Admin:   {model.Support},
+		model.Support: {model.AppUser},
+		model.AppUser: {model.Admin},
+	}, nil)
+	if !errors.Is(err, errs.ErrRoleCycle) {
+		t.Fatalf("expected ErrRoleCycle, got %v", err)
+	}
+}
+
+func TestRoleHierarchy_SupportReadsAndAdminsCannotEscalate(t *testing.T) {
+	deps := buildTestServer(t)
+
+	superToken := bootstrapAdmin(t, deps, "super@example.com")
+	sh := map[string]string{"Authorization": "Bearer " + superToken}
+
+	register := func(email string) (string, dtos.ResponseUser) {
+		reg := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: email, Password: strongPass})
+		var regResp struct{ Token string `json:"token"` }
+		_ = json.Unmarshal(reg.Body.Bytes(), &regResp)
+		dr := doJSON(t, deps.router, http.MethodGet, "/users/data", map[string]string{"Authorization": "Bearer " + regResp.Token}, nil)
+		var u dtos.ResponseUser
+		_ = json.Unmarshal(dr.Body.Bytes(), &u)
+		return regResp.Token, u
+	}
+	relogin := func(email string) map[string]string {
+		lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: email, Password: strongPass})
+		var loginResp struct{ Token string `json:"token"` }
+		_ = json.Unmarshal(lr.Body.Bytes(), &loginResp)
+		return map[string]string{"Authorization": "Bearer " + loginResp.Token}
+	}
+
+	_, supportUser := register("support@example.com")
+	_, adminUser := register("admin@example.com")
+	for id, role := range map[string]string{supportUser.ID.String(): "support", adminUser.ID.String(): "admin"} {
+		rr := doJSON(t, deps.router, http.MethodPut, "/admin/users/"+id+"/roles", sh, dtos.AssignRolesRequest{Roles: []string{role}})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("assign %s expected 200, got %d (%s)", role, rr.Code, rr.Body.String())
+		}
+	}
+
+	supportH := relogin("support@example.com")
+	if rr := doJSON(t, deps.router, http.MethodGet, "/users", supportH, nil); rr.Code != http.StatusOK {
+		t.Fatalf("support GET /users expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, deps.router, http.MethodDelete, "/users/"+adminUser.ID.String()+"/remove", supportH, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("support remove expected 401, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	adminH := relogin("admin@example.com")
+	rr := doJSON(t, deps.router, http.MethodPut, "/admin/users/"+adminUser.ID.String()+"/roles", adminH, dtos.AssignRolesRequest{
+		Roles: []string{"super-admin"},
+	})
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("admin granting super-admin expected 401, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGetUsers_PaginatesAndFilters(t *testing.T) {
+	deps := buildTestServer(t)
+
+	adminToken := bootstrapAdmin(t, deps, "admin@example.com")
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	for _, email := range []string{"carol@example.com", "alice@example.com", "bob@example.com", "alan@other.com"} {
+		rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: email, Password: strongPass})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("register %s expected 201, got %d", email, rr.Code)
+		}
+	}
+
+	// Walk all pages of two, sorted by email
+	var seen []string
+	cursor := ""
+	for range 5 {
+		path := "/users?limit=2"
+		if cursor != "" {
+			path += "&cursor=" + cursor
+		}
+		lr := doJSON(t, deps.router, http.MethodGet, path, h, nil)
+		if lr.Code != http.StatusOK {
+			t.Fatalf("GET %s expected 200, got %d (%s)", path, lr.Code, lr.Body.String())
+		}
+		var page dtos.GetAllUsersResponse
+		_ = json.Unmarshal(lr.Body.Bytes(), &page)
+		for _, u := range page.Users {
+			seen = append(seen, u.Email)
+		}
+		cursor = page.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	want := []string{"admin@example.com", "alan@other.com", "alice@example.com", "bob@example.com", "carol@example.com"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected paging order: got %v, want %v", seen, want)
+	}
+
+	lr := doJSON(t, deps.router, http.MethodGet, "/users?email_prefix=al&role=user&sort=email&order=desc", h, nil)
+	var filtered dtos.GetAllUsersResponse
+	_ = json.Unmarshal(lr.Body.Bytes(), &filtered)
+	if len(filtered.Users) != 2 || filtered.Users[0].Email != "alice@example.com" || filtered.Users[1].Email != "alan@other.com" {
+		t.Fatalf("unexpected filtered result: %s", lr.Body.String())
+	}
+
+	for _, bad := range []string{"/users?limit=0", "/users?limit=abc", "/users?sort=password", "/users?cursor=!!!", "/users?active=maybe", "/users?created_from=yesterday"} {
+		br := doJSON(t, deps.router, http.MethodGet, bad, h, nil)
+		if br.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s expected 400, got %d (%s)", bad, br.Code, br.Body.String())
+		}
+	}
+}
+
+func TestUpdateUser_IfMatchVersion(t *testing.T) {
+	deps := buildTestServer(t)
+
+	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "etag@example.com", Password: strongPass})
+	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: "etag@example.com", Password: strongPass})
+	var loginResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(lr.Body.Bytes(), &loginResp)
+	h := map[string]string{"Authorization": "Bearer " + loginResp.Token}
+
+	dr := doJSON(t, deps.router, http.MethodGet, "/users/data", h, nil)
+	if etag := dr.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf(`expected ETag "1", got %q`, etag)
+	}
+	var me dtos.ResponseUser
+	_ = json.Unmarshal(dr.Body.Bytes(), &me)
+	path := "/users/" + me.ID.String()
+
+	// PUT replaces the whole user, so it needs the full representation
+	replacement := dtos.UpdateUserRequest{Email: me.Email, Roles: me.Roles}
+	h["If-Match"] = `"5"`
+	rr := doJSON(t, deps.router, http.MethodPut, path, h, replacement)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match expected 412, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	h["If-Match"] = `"1"`
+	rr = doJSON(t, deps.router, http.MethodPut, path, h, replacement)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("matching If-Match expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	delete(h, "If-Match")
+	dr = doJSON(t, deps.router, http.MethodGet, "/users/data", h, nil)
+	if etag := dr.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf(`expected ETag "2" after the update, got %q`, etag)
+	}
+
+	// The old ETag no longer matches
+	h["If-Match"] = `"1"`
+	rr = doJSON(t, deps.router, http.MethodDelete, path, h, nil)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match on delete expected 412, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGetUsers_FiltersInactiveUsers(t *testing.T) {
+	deps := buildTestServer(t)
+
+	adminToken := bootstrapAdmin(t, deps, "admin@example.com")
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
+	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "idle@example.com", Password: strongPass})
+
+	dr := doJSON(t, deps.router, http.MethodGet, "/users/data", h, nil)
+	var me dtos.ResponseUser
+	_ = json.Unmarshal(dr.Body.Bytes(), &me)
+	if me.LastLoginAt.IsZero() || me.PasswordChangedAt.IsZero() || me.UpdatedAt.IsZero() {
+		t.Fatalf("expected login, password and update times, got %s", dr.Body.String())
+	}
+
+	lr := doJSON(t, deps.router, http.MethodGet, "/users?inactive_days=90", h, nil)
+	var page dtos.GetAllUsersResponse
+	_ = json.Unmarshal(lr.Body.Bytes(), &page)
+	if len(page.Users) != 1 || page.Users[0].Email != "idle@example.com" {
+		t.Fatalf("expected only the user that never logged in, got %s", lr.Body.String())
+	}
+	if strings.Contains(lr.Body.String(), "last_login_at") {
+		t.Fatalf("expected last_login_at to be omitted for a user that never logged in, got %s", lr.Body.String())
+	}
+
+	for _, bad := range []string{"/users?inactive_days=0", "/users?inactive_days=90&last_login_before=2025-01-01T00:00:00Z", "/users?updated_from=2025-02-01T00:00:00Z&updated_to=2025-01-01T00:00:00Z"} {
+		br := doJSON(t, deps.router, http.MethodGet, bad, h, nil)
+		if br.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s expected 400, got %d (%s)", bad, br.Code, br.Body.String())
+		}
+	}
+	// The error names the range that's reversed
+	br := doJSON(t, deps.router, http.MethodGet, "/users?updated_from=2025-02-01T00:00:00Z&updated_to=2025-01-01T00:00:00Z", h, nil)
+	if !strings.Contains(br.Body.String(), "updated_from must not be after updated_to") {
+		t.Fatalf("expected the updated range named in the error, got %s", br.Body.String())
+	}
+}
+
+func TestRegisterAndLogin_EmailIsCaseInsensitive(t *testing.T) {
+	deps := buildTestServer(t)
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "Alice@Example.com", Password: strongPass})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("register expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	dup := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "ALICE@example.com", Password: strongPass})
+	if dup.Code == http.StatusCreated {
+		t.Fatalf("register with different casing should be a duplicate")
+	}
+
+	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: "alice@example.com", Password: strongPass})
+	if lr.Code != http.StatusOK {
+		t.Fatalf("login expected 200, got %d (%s)", lr.Code, lr.Body.String())
+	}
+	var loginResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(lr.Body.Bytes(), &loginResp)
+
+	// The address is shown as registered
+	dr := doJSON(t, deps.router, http.MethodGet, "/users/data", map[string]string{"Authorization": "Bearer " + loginResp.Token}, nil)
+	var me dtos.ResponseUser
+	_ = json.Unmarshal(dr.Body.Bytes(), &me)
+	if me.Email != "Alice@Example.com" {
+		t.Fatalf("expected display email Alice@Example.com, got %q", me.Email)
+	}
+
+	pr := doJSON(t, deps.router, http.MethodPost, "/request-password", nil, dtos.RequestPasswordResetRequest{Email: "ALICE@EXAMPLE.COM"})
+	if pr.Code != http.StatusNoContent || len(deps.mailer.To) != 1 || deps.mailer.To[0] != "Alice@Example.com" {
+		t.Fatalf("expected reset mail to Alice@Example.com, got %d %+v", pr.Code, deps.mailer.To)
+	}
+}
+
+// Updates that don't touch the email, like a password reset or unregistering, keep the normalized key.
+func TestResetPasswordAndUnregister_KeepEmailKey(t *testing.T) {
+	deps := buildTestServer(t)
+	const newPass = "An0ther$trongPass"
+
+	if rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "Mixed.Case@Example.com", Password: strongPass}); rr.Code != http.StatusCreated {
+		t.Fatalf("register expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, deps.router, http.MethodPost, "/request-password", nil, dtos.RequestPasswordResetRequest{Email: "mixed.case@example.com"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("request reset expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	_, token, _ := strings.Cut(deps.mailer.Message, "token=")
+	token, _, _ = strings.Cut(token, "\r\n")
+	reset := dtos.ResetPasswordRequest{Email: "mixed.case@example.com", Password: newPass, ResetToken: token}
+	if rr := doJSON(t, deps.router, http.MethodPut, "/users/reset-password", nil, reset); rr.Code != http.StatusNoContent {
+		t.Fatalf("reset expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: "mixed.case@example.com", Password: newPass})
+	if lr.Code != http.StatusOK {
+		t.Fatalf("login with a lowercase email after the reset expected 200, got %d (%s)", lr.Code, lr.Body.String())
+	}
+	var loginResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(lr.Body.Bytes(), &loginResp)
+	h := map[string]string{"Authorization": "Bearer " + loginResp.Token}
+	var me dtos.ResponseUser
+	_ = json.Unmarshal(doJSON(t, deps.router, http.MethodGet, "/users/data", h, nil).Body.Bytes(), &me)
+
+	if rr := doJSON(t, deps.router, http.MethodDelete, "/users/"+me.ID.String(), h, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("unregister expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	found, err := deps.repo.FindByEmail(context.Background(), me.TenantID, "mixed.case@example.com")
+	if err != nil || found == nil || found.ID != me.ID || found.IsActive || found.Email != "Mixed.Case@Example.com" {
+		t.Fatalf("unregistered user expected under the lowercase key, got %+v, %v", found, err)
+	}
+}
+
+func TestRemoveUser_SoftDeletesUntilPurged(t *testing.T) {
+	deps := buildTestServer(t)
+	ctx := context.Background()
+	adminToken := bootstrapAdmin(t, deps, "admin@example.com")
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "leaving@example.com", Password: strongPass})
+	user, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "leaving@example.com")
+
+	if rr := doJSON(t, deps.router, http.MethodDelete, "/users/"+user.ID.String()+"/remove", h, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("remove expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	login := dtos.LoginRequest{Email: "leaving@example.com", Password: strongPass}
+	if lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, login); lr.Code != http.StatusUnauthorized {
+		t.Fatalf("login of removed user expected 401, got %d", lr.Code)
+	}
+
+	if rr := doJSON(t, deps.router, http.MethodPost, "/admin/users/"+user.ID.String()+"/restore", h, nil); rr.Code != http.StatusOK {
+		t.Fatalf("restore expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, login); lr.Code != http.StatusOK {
+		t.Fatalf("login of restored user expected 200, got %d (%s)", lr.Code, lr.Body.String())
+	}
+
+	// Past the grace period the user can't be restored, and past the retention window it's purged
+	restored, _ := deps.repo.FindById(ctx, user.ID)
+	restored.IsActive = false
+	restored.DeactivatedAt = time.Now().Add(-testLifecycle.PurgeRetention - time.Hour)
+	if err := deps.repo.Update(ctx, *restored); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if rr := doJSON(t, deps.router, http.MethodPost, "/admin/users/"+user.ID.String()+"/restore", h, nil); rr.Code != http.StatusGone {
+		t.Fatalf("late restore expected 410, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	purged, err := deps.users.PurgeDeactivatedUsers(ctx, time.Now())
+	if err != nil || purged != 1 {
+		t.Fatalf("expected 1 purged user, got %d (%v)", purged, err)
+	}
+	if gone, _ := deps.repo.FindById(ctx, user.ID); gone != nil {
+		t.Fatalf("expected purged user to be deleted, got %+v", gone)
+	}
+	events, _ := deps.audit.ListBySubject(ctx, user.ID)
+	if len(events) != 1 || events[0].Action != model.AuditUserPurged {
+		t.Fatalf("expected a purge audit event, got %+v", events)
+	}
+}
+
+func TestExportUser_OwnerAndAdminOnly(t *testing.T) {
+	deps := buildTestServer(t)
+	adminToken := bootstrapAdmin(t, deps, "admin@example.com")
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "subject@example.com", Password: strongPass})
+	var subjectResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &subjectResp)
+	rr = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "other@example.com", Password: strongPass})
+	var otherResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &otherResp)
+
+	subject, _ := deps.repo.FindByEmail(context.Background(), model.DefaultTenantID, "subject@example.com")
+	path := "/users/" + subject.ID.String() + "/export"
+
+	if rr := doJSON(t, deps.router, http.MethodGet, path, map[string]string{"Authorization": "Bearer " + otherResp.Token}, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("export by another user expected 401, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	own := doJSON(t, deps.router, http.MethodGet, path, map[string]string{"Authorization": "Bearer " + subjectResp.Token}, nil)
+	if own.Code != http.StatusOK {
+		t.Fatalf("own export expected 200, got %d (%s)", own.Code, own.Body.String())
+	}
+	if !strings.Contains(own.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("expected a download, got Content-Disposition %q", own.Header().Get("Content-Disposition"))
+	}
+	var export dtos.UserExport
+	_ = json.Unmarshal(own.Body.Bytes(), &export)
+	if export.User.Email != "subject@example.com" || len(export.User.Roles) != 1 || len(export.AuditEvents) != 0 {
+		t.Fatalf("unexpected first export: %+v", export)
+	}
+
+	// Exports are audited, so the next one includes the first
+	byAdmin := doJSON(t, deps.router, http.MethodGet, path, map[string]string{"Authorization": "Bearer " + adminToken}, nil)
+	if byAdmin.Code != http.StatusOK {
+		t.Fatalf("admin export expected 200, got %d (%s)", byAdmin.Code, byAdmin.Body.String())
+	}
+	_ = json.Unmarshal(byAdmin.Body.Bytes(), &export)
+	if len(export.AuditEvents) != 1 || export.AuditEvents[0].Action != model.AuditUserExported || export.AuditEvents[0].ActorID != subject.ID {
+		t.Fatalf("expected the first export in the audit trail, got %+v", export.AuditEvents)
+	}
+}
+
+func TestEraseUser_AnonymizesAfterConfirmation(t *testing.T) {
+	deps := buildTestServer(t)
+	ctx := context.Background()
+	adminToken := bootstrapAdmin(t, deps, "admin@example.com")
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "subject@example.com", Password: strongPass})
+	var subjectResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &subjectResp)
+	subject, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "subject@example.com")
+	h := map[string]string{"Authorization": "Bearer " + subjectResp.Token}
+
+	// Leaves an audit entry naming the user
+	_ = doJSON(t, deps.router, http.MethodGet, "/users/"+subject.ID.String()+"/export", h, nil)
+
+	if rr := doJSON(t, deps.router, http.MethodPost, "/users/"+subject.ID.String()+"/erase", h, nil); rr.Code != http.StatusAccepted {
+		t.Fatalf("erasure request expected 202, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if len(deps.mailer.To) != 1 || deps.mailer.To[0] != "subject@example.com" {
+		t.Fatalf("expected a confirmation email to subject@example.com, got %+v", deps.mailer.To)
+	}
+	_, token, _ := strings.Cut(deps.mailer.Message, "token=")
+	token, _, _ = strings.Cut(token, "\r\n")
+
+	if rr := doJSON(t, deps.router, http.MethodPost, "/users/erase/confirm", nil, dtos.ConfirmErasureRequest{Token: "not-a-token"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("confirmation with a bad token expected 401, got %d", rr.Code)
+	}
+	if rr := doJSON(t, deps.router, http.MethodPost, "/users/erase/confirm", nil, dtos.ConfirmErasureRequest{Token: token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("confirmation expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	erased, _ := deps.repo.FindById(ctx, subject.ID)
+	if erased.ErasedAt.IsZero() || erased.IsActive || erased.HashedPassword != "" || len(erased.Roles) != 0 || strings.Contains(erased.Email, "subject") {
+		t.Fatalf("expected an anonymized tombstone, got %+v", erased)
+	}
+	events, _ := deps.audit.ListBySubject(ctx, subject.ID)
+	for _, event := range events {
+		if event.SubjectEmail == "subject@example.com" || event.ActorEmail == "subject@example.com" {
+			t.Fatalf("audit event still names the user: %+v", event)
+		}
+	}
+	if len(events) != 2 || events[1].Action != model.AuditUserErased {
+		t.Fatalf("expected the export and an erasure certificate, got %+v", events)
+	}
+
+	// The old token is revoked, even once the email is registered again
+	if rr := doJSON(t, deps.router, http.MethodGet, "/users/data", h, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("old token expected 404, got %d", rr.Code)
+	}
+	_ = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "subject@example.com", Password: strongPass})
+	newcomer, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "subject@example.com")
+	update := dtos.UpdateUserRequest{Email: "hijacked@example.com", Roles: []string{"user"}}
+	if rr := doJSON(t, deps.router, http.MethodPut, "/users/"+newcomer.ID.String(), h, update); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("old token on the new account expected 401, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	// Admins erase directly, and erased users can't be restored
+	adminHeaders := map[string]string{"Authorization": "Bearer " + adminToken}
+	if rr := doJSON(t, deps.router, http.MethodPost, "/admin/users/"+newcomer.ID.String()+"/erase", adminHeaders, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("admin erase expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, deps.router, http.MethodPost, "/admin/users/"+newcomer.ID.String()+"/restore", adminHeaders, nil); rr.Code != http.StatusGone {
+		t.Fatalf("restoring an erased user expected 410, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	// ...or overwritten
+	if rr := doJSON(t, deps.router, http.MethodPut, "/users/"+newcomer.ID.String(), adminHeaders, update); rr.Code != http.StatusGone {
+		t.Fatalf("updating an erased user expected 410, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, deps.router, http.MethodPut, "/admin/users/"+newcomer.ID.String()+"/roles", adminHeaders, dtos.AssignRolesRequest{Roles: []string{"admin"}}); rr.Code != http.StatusGone {
+		t.Fatalf("assigning roles to an erased user expected 410, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBulkImport_DryRunIdempotentAndExportRoundTrip(t *testing.T) {
+	deps := buildTestServer(t)
+	ctx := context.Background()
+	adminToken := bootstrapAdmin(t, deps, "admin@example.com")
+	h := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	file := "email,password,roles\n" +
+		"alice@example.com,StrongP@ss1,user\n" +
+		"bob@example.com,short,\n" +
+		"carol@example.com,,admin\n" +
+		"ALICE@example.com,StrongP@ss1,\n"
+	importFile := func(query string, body string) dtos.ImportReport {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/admin/users/import?"+query, strings.NewReader(body))
+		req.Header.Set("Authorization", h["Authorization"])
+		rr := httptest.NewRecorder()
+		deps.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("import expected 200, got %d (%s)", rr.Code, rr.Body.String())
+		}
+		var report dtos.ImportReport
+		_ = json.Unmarshal(rr.Body.Bytes(), &report)
+		return report
+	}
+
+	dryRun := importFile("invite=true&dry_run=true", file)
+	if !dryRun.DryRun || dryRun.Created != 1 || dryRun.Invited != 1 || dryRun.Invalid != 1 || dryRun.Skipped != 1 {
+		t.Fatalf("unexpected dry-run report: %+v", dryRun)
+	}
+	if alice, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "alice@example.com"); alice != nil || len(deps.mailer.To) != 0 {
+		t.Fatalf("dry run wrote data: %+v, mail to %v", alice, deps.mailer.To)
+	}
+
+	imported := importFile("invite=true", file)
+	if imported.Created != 1 || imported.Invited != 1 || imported.Rows[1].Status != dtos.ImportInvalid || imported.Rows[1].Line != 3 {
+		t.Fatalf("unexpected import report: %+v", imported)
+	}
+	if alice, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "alice@example.com"); alice == nil {
+		t.Fatalf("expected alice to be created")
+	}
+	// Row errors name the fields like a validation_failed response
+	if fields := imported.Rows[1].Errors; len(fields) != 1 || fields[0].Field != "password" || fields[0].Rule != "min" ||
+		imported.Rows[1].Error != "validation failed: password must be at least 6 characters" {
+		t.Fatalf("expected the short password reported by field, got %+v", imported.Rows[1])
+	}
+	if len(deps.mailer.To) != 1 || deps.mailer.To[0] != "carol@example.com" {
+		t.Fatalf("expected an invitation to carol, got %v", deps.mailer.To)
+	}
+
+	// Running the same file again changes nothing
+	again := importFile("invite=true", file)
+	if again.Created != 0 || again.Invited != 0 || again.Skipped != 3 {
+		t.Fatalf("expected a repeated import to skip everything, got %+v", again)
+	}
+
+	export := doJSON(t, deps.router, http.MethodGet, "/admin/users/export?format=jsonl", h, nil)
+	if export.Code != http.StatusOK || export.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("export expected 200 JSON Lines, got %d %q", export.Code, export.Header().Get("Content-Type"))
+	}
+	if lines := strings.Split(strings.TrimSpace(export.Body.String()), "\n"); len(lines) != 2 {
+		t.Fatalf("expected the admin and alice, got %v", lines)
+	}
+
+	// An export can be imported again, and every user in it already exists
+	csvExport := doJSON(t, deps.router, http.MethodGet, "/admin/users/export", h, nil)
+	if roundTrip := importFile("dry_run=true&invite=true", csvExport.Body.String()); roundTrip.Skipped != 2 || len(roundTrip.Rows) != 2 {
+		t.Fatalf("expected the exported users to be skipped, got %+v", roundTrip)
+	}
+
+	// Hashing is slow, so a request creates only so many users with passwords
+	var many strings.Builder
+	many.WriteString("email,password\n")
+	for i := range 12 {
+		fmt.Fprintf(&many, "user%d@example.com,StrongP@ss1\n", i)
+	}
+	if capped := importFile("dry_run=true", many.String()); capped.Created != 10 || capped.Skipped != 2 ||
+		!strings.Contains(capped.Rows[11].Error, "import the file again") {
+		t.Fatalf("expected 10 users created and the rest skipped, got %+v", capped)
+	}
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: "alice@example.com", Password: "StrongP@ss1"})
+	var aliceResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &aliceResp)
+	if rr := doJSON(t, deps.router, http.MethodGet, "/admin/users/export", map[string]string{"Authorization": "Bearer " + aliceResp.Token}, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("export by a regular user expected 401, got %d", rr.Code)
+	}
+}
+
+func TestUpdateProfile_SchemaAndVisibility(t *testing.T) {
+	deps := buildTestServer(t)
+	ctx := context.Background()
+	adminHeaders := map[string]string{"Authorization": "Bearer " + bootstrapAdmin(t, deps, "admin@example.com")}
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "subject@example.com", Password: strongPass})
+	var subjectResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &subjectResp)
+	rr = doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "other@example.com", Password: strongPass})
+	var otherResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &otherResp)
+	subject, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "subject@example.com")
+	path := "/users/" + subject.ID.String() + "/profile"
+	h := map[string]string{"Authorization": "Bearer " + subjectResp.Token}
+	str := func(s string) *string { return &s }
+
+	own := doJSON(t, deps.router, http.MethodPatch, path, h, dtos.UpdateProfileRequest{
+		DisplayName: str(" Sam "),
+		Locale:      str("en-us"),
+		Timezone:    str("Europe/Berlin"),
+		Attributes:  map[string]any{"employee_no": "E1234", "pronouns": "they/them", "newsletter": true},
+	})
+	if own.Code != http.StatusOK {
+		t.Fatalf("own profile update expected 200, got %d (%s)", own.Code, own.Body.String())
+	}
+	var updated dtos.ResponseUser
+	_ = json.Unmarshal(own.Body.Bytes(), &updated)
+	if updated.Profile.DisplayName != "Sam" || updated.Profile.Locale != "en-US" || updated.Profile.Attributes["newsletter"] != true {
+		t.Fatalf("expected a canonical profile, got %+v", updated.Profile)
+	}
+
+	rejected := []struct {
+		name    string
+		headers map[string]string
+		req     dtos.UpdateProfileRequest
+		code    int
+	}{
+		{"admin attribute by owner", h, dtos.UpdateProfileRequest{Attributes: map[string]any{"department": "Sales"}}, http.StatusUnauthorized},
+		{"pattern mismatch", h, dtos.UpdateProfileRequest{Attributes: map[string]any{"employee_no": "X1"}}, http.StatusBadRequest},
+		{"wrong type", h, dtos.UpdateProfileRequest{Attributes: map[string]any{"newsletter": "yes"}}, http.StatusBadRequest},
+		{"unknown attribute", h, dtos.UpdateProfileRequest{Attributes: map[string]any{"shoe_size": "44"}}, http.StatusBadRequest},
+		{"unknown timezone", h, dtos.UpdateProfileRequest{Timezone: str("Mars/Olympus")}, http.StatusBadRequest},
+		{"another user", map[string]string{"Authorization": "Bearer " + otherResp.Token}, dtos.UpdateProfileRequest{DisplayName: str("Mallory")}, http.StatusUnauthorized},
+	}
+	for _, tc := range rejected {
+		if rr := doJSON(t, deps.router, http.MethodPatch, path, tc.headers, tc.req); rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d (%s)", tc.name, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := doJSON(t, deps.router, http.MethodPatch, path, adminHeaders, dtos.UpdateProfileRequest{Attributes: map[string]any{"department": "Sales"}}); rr.Code != http.StatusOK {
+		t.Fatalf("admin attribute by admin expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	// Owners don't see admin attributes; admins see everything
+	var self dtos.ResponseUser
+	_ = json.Unmarshal(doJSON(t, deps.router, http.MethodGet, "/users/data", h, nil).Body.Bytes(), &self)
+	if _, ok := self.Profile.Attributes["department"]; ok || self.Profile.Attributes["employee_no"] != "E1234" || self.Profile.Timezone != "Europe/Berlin" {
+		t.Fatalf("unexpected own profile: %+v", self.Profile)
+	}
+	var list dtos.GetAllUsersResponse
+	_ = json.Unmarshal(doJSON(t, deps.router, http.MethodGet, "/users", adminHeaders, nil).Body.Bytes(), &list)
+	for _, user := range list.Users {
+		if user.ID == subject.ID && user.Profile.Attributes["department"] != "Sales" {
+			t.Fatalf("admin expected the department, got %+v", user.Profile)
+		}
+	}
+
+	// Empty strings and nulls clear values
+	cleared := doJSON(t, deps.router, http.MethodPatch, path, h, map[string]any{"display_name": "", "attributes": map[string]any{"pronouns": nil}})
+	var afterClear dtos.ResponseUser
+	_ = json.Unmarshal(cleared.Body.Bytes(), &afterClear)
+	if _, ok := afterClear.Profile.Attributes["pronouns"]; ok || afterClear.Profile.DisplayName != "" || afterClear.Profile.Locale != "en-US" {
+		t.Fatalf("expected display name and pronouns cleared, got %+v", afterClear.Profile)
+	}
+
+	// Erasure wipes the profile
+	if rr := doJSON(t, deps.router, http.MethodPost, "/admin/users/"+subject.ID.String()+"/erase", adminHeaders, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("admin erase expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	erased, _ := deps.repo.FindById(ctx, subject.ID)
+	if erased.Profile.Locale != "" || len(erased.Profile.Attributes) != 0 {
+		t.Fatalf("expected the profile erased, got %+v", erased.Profile)
+	}
+}
+
+// Support may export users, but like listing them only sees public profile attributes of others.
+func TestExportUsers_ProfilesFollowVisibility(t *testing.T) {
+	deps := buildTestServer(t)
+	ctx := context.Background()
+	adminHeaders := map[string]string{"Authorization": "Bearer " + bootstrapAdmin(t, deps, "admin@example.com")}
+
+	for _, email := range []string{"subject@example.com", "support@example.com"} {
+		if rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: email, Password: strongPass}); rr.Code != http.StatusCreated {
+			t.Fatalf("register %s expected 201, got %d (%s)", email, rr.Code, rr.Body.String())
+		}
+	}
+	subject, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "subject@example.com")
+	support, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "support@example.com")
+	if rr := doJSON(t, deps.router, http.MethodPatch, "/users/"+subject.ID.String()+"/profile", adminHeaders, dtos.UpdateProfileRequest{
+		Attributes: map[string]any{"department": "Sales", "employee_no": "E1234", "pronouns": "they/them"},
+	}); rr.Code != http.StatusOK {
+		t.Fatalf("profile update expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, deps.router, http.MethodPut, "/admin/users/"+support.ID.String()+"/roles", adminHeaders, dtos.AssignRolesRequest{Roles: []string{"support"}}); rr.Code != http.StatusOK {
+		t.Fatalf("assign support expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: "support@example.com", Password: strongPass})
+	var supportResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(lr.Body.Bytes(), &supportResp)
+
+	exported := func(headers map[string]string) map[string]any {
+		t.Helper()
+		rr := doJSON(t, deps.router, http.MethodGet, "/admin/users/export?format=jsonl", headers, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("export expected 200, got %d (%s)", rr.Code, rr.Body.String())
+		}
+		for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+			var user dtos.ResponseUser
+			if err := json.Unmarshal([]byte(line), &user); err != nil {
+				t.Fatalf("decode %q: %v", line, err)
+			}
+			if user.ID == subject.ID {
+				return user.Profile.Attributes
+			}
+		}
+		t.Fatalf("subject missing from the export")
+		return nil
+	}
+
+	if attributes := exported(map[string]string{"Authorization": "Bearer " + supportResp.Token}); len(attributes) != 1 || attributes["pronouns"] != "they/them" {
+		t.Fatalf("support expected only the public attribute, got %+v", attributes)
+	}
+	if attributes := exported(adminHeaders); len(attributes) != 3 {
+		t.Fatalf("admin expected every attribute, got %+v", attributes)
+	}
+}
+
+func TestPatchUser_MergePatchKeepsOmittedFields(t *testing.T) {
+	deps := buildTestServer(t)
+	ctx := context.Background()
+	adminHeaders := map[string]string{"Authorization": "Bearer " + bootstrapAdmin(t, deps, "admin@example.com")}
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/register", nil, dtos.RegisterRequest{Email: "patch@example.com", Password: strongPass})
+	var regResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(rr.Body.Bytes(), &regResp)
+	user, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "patch@example.com")
+	path := "/users/" + user.ID.String()
+	h := map[string]string{"Authorization": "Bearer " + regResp.Token, "Content-Type": "application/merge-patch+json"}
+
+	// PUT without roles is rejected instead of stripping them
+	if rr := doJSON(t, deps.router, http.MethodPut, path, h, map[string]any{"email": "patch@example.com"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("PUT without roles expected 400, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	// Changing only the email keeps the roles
+	rr = doJSON(t, deps.router, http.MethodPatch, path, h, map[string]any{"email": "Patched@example.com"})
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("email patch expected 200 with ETag \"2\", got %d %q (%s)", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	var patched dtos.ResponseUser
+	_ = json.Unmarshal(rr.Body.Bytes(), &patched)
+	if patched.Email != "Patched@example.com" || len(patched.Roles) != 1 || patched.Roles[0] != "user" {
+		t.Fatalf("expected the new email and unchanged roles, got %+v", patched)
+	}
+
+	// Tokens carry the old email, so the owner logs in again
+	lr := doJSON(t, deps.router, http.MethodPost, "/login", nil, dtos.LoginRequest{Email: "patched@example.com", Password: strongPass})
+	_ = json.Unmarshal(lr.Body.Bytes(), &regResp)
+	h["Authorization"] = "Bearer " + regResp.Token
+
+	rejected := []struct {
+		name string
+		body any
+		code int
+	}{
+		{"own roles", map[string]any{"roles": []string{"admin"}}, http.StatusUnauthorized},
+		{"removing own roles", map[string]any{"roles": nil}, http.StatusUnauthorized},
+		{"removing the email", map[string]any{"email": nil}, http.StatusBadRequest},
+		{"read-only field", map[string]any{"is_active": false}, http.StatusBadRequest},
+		{"invalid email", map[string]any{"email": "not-an-email"}, http.StatusBadRequest},
+		{"not an object", []string{"email"}, http.StatusBadRequest},
+	}
+	for _, tc := range rejected {
+		if rr := doJSON(t, deps.router, http.MethodPatch, path, h, tc.body); rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d (%s)", tc.name, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := doJSON(t, deps.router, http.MethodPatch, path, h, map[string]any{"roles": []string{"user"}}); rr.Code != http.StatusOK {
+		t.Fatalf("sending own roles back unchanged expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	h["Content-Type"] = "text/plain"
+	if rr := doJSON(t, deps.router, http.MethodPatch, path, h, map[string]any{"email": "x@example.com"}); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("wrong content type expected 415, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	// Admins change roles, and the email stays
+	adminHeaders["If-Match"] = `"3"`
+	rr = doJSON(t, deps.router, http.MethodPatch, path, adminHeaders, map[string]any{"roles": []string{"support"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("admin role patch expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	stored, _ := deps.repo.FindById(ctx, user.ID)
+	if stored.Email != "Patched@example.com" || len(stored.Roles) != 1 || stored.Roles[0] != model.Support || stored.Version != 4 {
+		t.Fatalf("expected only the roles changed, got %+v", stored)
+	}
+	if rr := doJSON(t, deps.router, http.MethodPatch, path, adminHeaders, map[string]any{"roles": []string{"user"}}); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match expected 412, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}
+
+func TestIdempotencyKey_ReplaysRetriesAndRejectsOtherBodies(t *testing.T) {
+	deps := buildTestServer(t)
+	ctx := context.Background()
+	h := map[string]string{"Idempotency-Key": "3f1c1f0e-register"}
+	register := dtos.RegisterRequest{Email: "retry@example.com", Password: strongPass}
+
+	first := doJSON(t, deps.router, http.MethodPost, "/register", h, register)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("register expected 201, got %d (%s)", first.Code, first.Body.String())
+	}
+	retry := doJSON(t, deps.router, http.MethodPost, "/register", h, register)
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry expected the first response replayed, got %d %q (%s)", retry.Code, retry.Header().Get("Idempotent-Replayed"), retry.Body.String())
+	}
+
+	register.Email = "other@example.com"
+	if rr := doJSON(t, deps.router, http.MethodPost, "/register", h, register); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key with another body expected 422, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	// Keys are per route
+	if rr := doJSON(t, deps.router, http.MethodPost, "/request-password", h, dtos.RequestPasswordResetRequest{Email: "retry@example.com"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("same key on another route expected 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	deps.mailer.To = nil
+	if rr := doJSON(t, deps.router, http.MethodPost, "/request-password", h, dtos.RequestPasswordResetRequest{Email: "retry@example.com"}); rr.Code != http.StatusNoContent || rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("password reset retry expected the replayed 204, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if deps.mailer.To != nil {
+		t.Fatalf("expected the retry not to send another email, got one to %v", deps.mailer.To)
+	}
+
+	// Keys are per caller: another user's token with the same key runs the request
+	var regResp struct{ Token string `json:"token"` }
+	_ = json.Unmarshal(first.Body.Bytes(), &regResp)
+	user, _ := deps.repo.FindByEmail(ctx, model.DefaultTenantID, "retry@example.com")
+	path := "/users/" + user.ID.String()
+	patch := map[string]string{"Authorization": "Bearer " + regResp.Token, "Idempotency-Key": "patch-1"}
+	if rr := doJSON(t, deps.router, http.MethodPatch, path, patch, map[string]any{"email": "retried@example.com"}); rr.Code != http.StatusOK {
+		t.Fatalf("patch expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	rr := doJSON(t, deps.router, http.MethodPatch, path, patch, map[string]any{"email": "retried@example.com"})
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` || rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("patch retry expected the replayed 200 with ETag \"2\", got %d %q (%s)", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	admin := map[string]string{"Authorization": "Bearer " + bootstrapAdmin(t, deps, "admin@example.com"), "Idempotency-Key": "patch-1"}
+	if rr := doJSON(t, deps.router, http.MethodPatch, path, admin, map[string]any{"email": "retried@example.com"}); rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("another caller's key expected to run the request, got a replay (%s)", rr.Body.String())
+	}
+
+	h["Idempotency-Key"] = "bad\x7fkey"
+	if rr := doJSON(t, deps.router, http.MethodPost, "/register", h, register); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid key expected 400, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}
+
+func TestErrorResponses_ProblemJSONWithFieldErrors(t *testing.T) {
+	deps := buildTestServer(t)
+
+	rr := doJSON(t, deps.router, http.MethodPost, "/register", map[string]string{"X-Request-ID": "req-123"}, map[string]string{"email": "not-an-email", "password": "x"})
+	var problem helpers.Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode problem: %v (%s)", err, rr.Body.String())
+	}
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/problem+json" ||
+		problem.Status != http.StatusBadRequest || problem.Code != errs.CodeValidationFailed || problem.RequestID != "req-123" {
+		t.Fatalf("expected a 400 validation problem with the request ID, got %d %q %+v", rr.Code, rr.Header().Get("Content-Type"), problem)
+	}
+	rules := map[string]string{}
+	for _, fieldErr := range problem.Errors {
+		rules[fieldErr.Field] = fieldErr.Rule
+	}
+	if len(rules) != 2 || rules["email"] != "email" || rules["password"] != "min" {
+		t.Fatalf("expected email and password field errors, got %+v", problem.Errors)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("{"))
+	rr = httptest.NewRecorder()
+	deps.router.ServeHTTP(rr, req)
+	problem = helpers.Problem{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &problem)
+	if rr.Code != http.StatusBadRequest || problem.Code != errs.CodeInvalidJSON || problem.RequestID == "" || problem.RequestID != rr.Header().Get("X-Request-ID") {
+		t.Fatalf("expected an invalid_json problem with a generated request ID, got %d %+v", rr.Code, problem)
+	}
+
+	// Unknown errors don't reach the client
+	rr = httptest.NewRecorder()
+	helpers.WriteErrorsResponse(rr, errors.New("operation error DynamoDB: PutItem, ResourceNotFoundException: users"))
+	problem = helpers.Problem{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &problem)
+	if rr.Code != http.StatusInternalServerError || problem.Code != errs.CodeInternal || problem.Detail != "" || strings.Contains(rr.Body.String(), "DynamoDB") {
+		t.Fatalf("expected a bare internal error, got %d %s", rr.Code, rr.Body.String())
+	}
+	if kind, _ := errs.KindOf(errs.ErrParsingRoles); kind.Status != http.StatusBadRequest || errs.ErrParsingRoles.Error() == errs.ErrAlreadyExists.Error() {
+		t.Fatalf("expected ErrParsingRoles to be its own 400, got %+v %q", kind, errs.ErrParsingRoles)
+	}
+}
+
+// Browsers preflight PATCH and If-Match, and may only read ETag when it's exposed.
+func TestCors_AllowsConditionalUpdates(t *testing.T) {
+	deps := buildTestServer(t)
+
+	req := httptest.NewRequest(http.MethodOptions, "/users/"+uuid.NewString(), nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	// Lowercased and sorted, as browsers send them
+	req.Header.Set("Access-Control-Request-Headers", "idempotency-key,if-match")
+	rr := httptest.NewRecorder()
+	deps.router.ServeHTTP(rr, req)
+	if rr.Header().Get("Access-Control-Allow-Methods") != http.MethodPatch || rr.Header().Get("Access-Control-Allow-Headers") == "" {
+		t.Fatalf("expected PATCH with If-Match allowed, got %d %v", rr.Code, rr.Header())
+	}
+
+	token := bootstrapAdmin(t, deps, "admin@example.com")
+	rr = doJSON(t, deps.router, http.MethodGet, "/users/data", map[string]string{"Authorization": "Bearer " + token, "Origin": "https://app.example.com"}, nil)
+	if rr.Header().Get("ETag") == "" || rr.Header().Get("Access-Control-Expose-Headers") != "Etag" {
+		t.Fatalf("expected ETag exposed, got %v", rr.Header())
+	}
+}
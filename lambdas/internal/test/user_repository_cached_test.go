@@ -0,0 +1,89 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+	"github.com/danilobml/user-manager/internal/user/repository/repositorytest"
+	"github.com/google/uuid"
+)
+
+func TestUserRepositoryConformance_Cached(t *testing.T) {
+	repositorytest.RunUserRepository(t, func(t *testing.T) repository.UserRepository {
+		return repository.NewUserRepositoryCached(repository.NewUserRepositoryInMemory(), time.Minute, 100)
+	})
+}
+
+func TestUserRepositoryCached_HitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	inner := repository.NewUserRepositoryInMemory()
+	cache := repository.NewUserRepositoryCached(inner, time.Minute, 1)
+
+	user := model.User{ID: uuid.New(), Email: "cached@example.com", Roles: []model.Role{model.AppUser}}
+	if err := cache.Create(ctx, user); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for range 3 {
+		if found, err := cache.FindByEmail(ctx, user.TenantID, user.Email); err != nil || found == nil {
+			t.Fatalf("find: %+v (%v)", found, err)
+		}
+	}
+	// Entries are shared between the id and email lookups
+	found, _ := cache.FindById(ctx, user.ID)
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Hits != 3 || stats.Size != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Callers can't change what's cached
+	found.Roles[0] = model.Admin
+	if again, _ := cache.FindById(ctx, user.ID); again.Roles[0] != model.AppUser {
+		t.Fatalf("cached user was modified through a returned copy")
+	}
+
+	found.Roles[0] = model.AppUser
+	found.IsActive = true
+	if err := cache.Update(ctx, *found); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if again, _ := cache.FindByEmail(ctx, user.TenantID, user.Email); !again.IsActive || again.Version != 2 {
+		t.Fatalf("expected the updated user after invalidation, got %+v", again)
+	}
+
+	other := model.User{ID: uuid.New(), Email: "other@example.com"}
+	_ = cache.Create(ctx, other)
+	_, _ = cache.FindById(ctx, other.ID)
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Size != 1 {
+		t.Fatalf("expected the LRU to evict down to 1, got %+v", stats)
+	}
+
+	_ = cache.Delete(ctx, other.ID)
+	if gone, _ := cache.FindById(ctx, other.ID); gone != nil {
+		t.Fatalf("expected deleted user to be gone, got %+v", gone)
+	}
+}
+
+func TestUserRepositoryCached_ExpiresWritesMadeElsewhere(t *testing.T) {
+	ctx := context.Background()
+	inner := repository.NewUserRepositoryInMemory()
+	cache := repository.NewUserRepositoryCached(inner, 50*time.Millisecond, 10)
+
+	user := model.User{ID: uuid.New(), Email: "elsewhere@example.com"}
+	_ = cache.Create(ctx, user)
+	found, _ := cache.FindById(ctx, user.ID)
+
+	// Another Lambda writing directly isn't seen until the entry expires
+	found.IsActive = true
+	if err := inner.Update(ctx, *found); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if stale, _ := cache.FindById(ctx, user.ID); stale.IsActive {
+		t.Fatalf("expected the cached copy before the TTL runs out")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if fresh, _ := cache.FindById(ctx, user.ID); !fresh.IsActive {
+		t.Fatalf("expected the stored user after the TTL")
+	}
+}
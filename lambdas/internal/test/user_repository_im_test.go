@@ -0,0 +1,41 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+	"github.com/google/uuid"
+)
+
+// Meant to be run with -race
+func TestUserRepositoryInMemory_ConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewUserRepositoryInMemory()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := model.User{ID: uuid.New(), Email: fmt.Sprintf("user%d@example.com", i), Roles: []model.Role{model.AppUser}}
+			if err := repo.Create(ctx, user); err != nil {
+				t.Errorf("create: %v", err)
+				return
+			}
+			user.IsVerified = true
+			_ = repo.Update(ctx, user)
+			_, _ = repo.FindByEmail(ctx, user.TenantID, user.Email)
+			_, _ = repo.List(ctx, repository.UserListOptions{Limit: 10})
+		}()
+	}
+	wg.Wait()
+
+	page, err := repo.List(ctx, repository.UserListOptions{})
+	if err != nil || len(page.Users) != 50 {
+		t.Fatalf("expected 50 users, got %d (%v)", len(page.Users), err)
+	}
+}
@@ -0,0 +1,258 @@
+package bulkio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+)
+
+// Reads import rows from and writes users to CSV or JSON Lines files. Exports use the same column names as
+// imports, and imports ignore columns they don't know, so an export can be imported again.
+type Format string
+
+const (
+	CSV   Format = "csv"
+	JSONL Format = "jsonl"
+)
+
+// An empty format means CSV.
+func ParseFormat(format string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", string(CSV):
+		return CSV, nil
+	case string(JSONL), "ndjson":
+		return JSONL, nil
+	default:
+		return "", errs.ErrInvalidFormat
+	}
+}
+
+func (f Format) ContentType() string {
+	if f == JSONL {
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+// Next returns io.EOF after the last row. A *RowError only affects that row, and reading can go on.
+type RowReader interface {
+	Next() (dtos.ImportUserRow, error)
+}
+
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func NewRowReader(r io.Reader, format Format) (RowReader, error) {
+	if format == JSONL {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		return &jsonlReader{scanner: scanner}, nil
+	}
+	return newCSVReader(r)
+}
+
+// Roles share one CSV cell, separated by semicolons.
+const roleSeparator = ";"
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fileError(errors.New("missing header"))
+	}
+	if err != nil {
+		return nil, fileError(err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fileError(errors.New("header has no email column"))
+	}
+
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (cr *csvReader) Next() (dtos.ImportUserRow, error) {
+	record, err := cr.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return dtos.ImportUserRow{}, io.EOF
+	}
+	if err != nil {
+		return dtos.ImportUserRow{}, fileError(err)
+	}
+	line, _ := cr.reader.FieldPos(0)
+
+	row := dtos.ImportUserRow{
+		Line:     line,
+		Email:    strings.TrimSpace(cr.field(record, "email")),
+		Password: strings.TrimSpace(cr.field(record, "password")),
+	}
+	for _, role := range strings.Split(cr.field(record, "roles"), roleSeparator) {
+		if role = strings.TrimSpace(role); role != "" {
+			row.Roles = append(row.Roles, role)
+		}
+	}
+	return row, nil
+}
+
+func (cr *csvReader) field(record []string, column string) string {
+	i, ok := cr.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (jr *jsonlReader) Next() (dtos.ImportUserRow, error) {
+	for jr.scanner.Scan() {
+		jr.line++
+		text := strings.TrimSpace(jr.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var row dtos.ImportUserRow
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return dtos.ImportUserRow{}, &RowError{Line: jr.line, Err: err}
+		}
+		row.Line = jr.line
+		row.Email = strings.TrimSpace(row.Email)
+		row.Password = strings.TrimSpace(row.Password)
+		return row, nil
+	}
+	if err := jr.scanner.Err(); err != nil {
+		return dtos.ImportUserRow{}, fileError(err)
+	}
+	return dtos.ImportUserRow{}, io.EOF
+}
+
+// Flush must be called after the last Write; a CSV export always has its header, even with no users.
+type UserWriter interface {
+	Write(user dtos.ResponseUser) error
+	Flush() error
+}
+
+func NewUserWriter(w io.Writer, format Format) UserWriter {
+	if format == JSONL {
+		return &jsonlWriter{encoder: json.NewEncoder(w)}
+	}
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+// Custom profile attributes share one cell as a JSON object.
+var csvColumns = []string{
+	"id", "tenant_id", "email", "roles", "is_active", "is_verified", "created_at", "updated_at",
+	"last_login_at", "password_changed_at", "deactivated_at", "erased_at", "version",
+	"display_name", "locale", "timezone", "avatar_url", "attributes",
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (cw *csvWriter) Write(user dtos.ResponseUser) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	attributes := ""
+	if len(user.Profile.Attributes) > 0 {
+		encoded, err := json.Marshal(user.Profile.Attributes)
+		if err != nil {
+			return err
+		}
+		attributes = string(encoded)
+	}
+	return cw.writer.Write([]string{
+		user.ID.String(),
+		user.TenantID.String(),
+		user.Email,
+		strings.Join(user.Roles, roleSeparator),
+		strconv.FormatBool(user.IsActive),
+		strconv.FormatBool(user.IsVerified),
+		formatTime(user.CreatedAt),
+		formatTime(user.UpdatedAt),
+		formatTime(user.LastLoginAt),
+		formatTime(user.PasswordChangedAt),
+		formatTime(user.DeactivatedAt),
+		formatTime(user.ErasedAt),
+		strconv.FormatInt(user.Version, 10),
+		user.Profile.DisplayName,
+		user.Profile.Locale,
+		user.Profile.Timezone,
+		user.Profile.AvatarURL,
+		attributes,
+	})
+}
+
+func (cw *csvWriter) Flush() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+func (cw *csvWriter) writeHeader() error {
+	if cw.headerWritten {
+		return nil
+	}
+	cw.headerWritten = true
+	return cw.writer.Write(csvColumns)
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (jw *jsonlWriter) Write(user dtos.ResponseUser) error {
+	return jw.encoder.Encode(user)
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return nil
+}
+
+// Helpers
+// Errors that stop the whole file from being read, unlike a RowError.
+func fileError(err error) error {
+	return fmt.Errorf("%w: %w", errs.ErrInvalidImportFile, err)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
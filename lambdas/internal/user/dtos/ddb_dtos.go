@@ -1,16 +1,46 @@
 package dtos
 
 import (
+	"time"
+
 	"github.com/danilobml/user-manager/internal/user/model"
 	"github.com/google/uuid"
 )
 
 type UserDDB struct {
-	ID             string   `dynamodbav:"id"`
-	Email          string   `dynamodbav:"email"`
-	HashedPassword string   `dynamodbav:"hashed_password"`
-	Roles          []string `dynamodbav:"roles"`
-	IsActive       bool     `dynamodbav:"is_active"`
+	ID                string        `dynamodbav:"id"`
+	TenantID          string        `dynamodbav:"tenant_id"`
+	Email             string        `dynamodbav:"email"`
+	EmailKey          string        `dynamodbav:"email_key,omitempty"`
+	HashedPassword    string        `dynamodbav:"hashed_password"`
+	Roles             []string      `dynamodbav:"roles"`
+	IsActive          bool          `dynamodbav:"is_active"`
+	IsVerified        bool          `dynamodbav:"is_verified"`
+	CreatedAt         string        `dynamodbav:"created_at,omitempty"`
+	UpdatedAt         string        `dynamodbav:"updated_at,omitempty"`
+	LastLoginAt       string        `dynamodbav:"last_login_at,omitempty"`
+	PasswordChangedAt string        `dynamodbav:"password_changed_at,omitempty"`
+	DeactivatedAt     string        `dynamodbav:"deactivated_at,omitempty"`
+	ErasedAt          string        `dynamodbav:"erased_at,omitempty"`
+	Profile           model.Profile `dynamodbav:"profile"`
+	Version           int64         `dynamodbav:"version"`
+}
+
+// Timestamps used as index sort keys are stored in a fixed-width UTC layout so they sort lexicographically.
+const DDBTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+func FormatDDBTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(DDBTimeLayout)
+}
+
+func ParseDDBTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(DDBTimeLayout, s)
 }
 
 func ToDDB(u model.User) UserDDB {
@@ -19,11 +49,22 @@ func ToDDB(u model.User) UserDDB {
 		roleNames = append(roleNames, r.GetName())
 	}
 	return UserDDB{
-		ID:             u.ID.String(),
-		Email:          u.Email,
-		HashedPassword: u.HashedPassword,
-		Roles:          roleNames,
-		IsActive:       u.IsActive,
+		ID:                u.ID.String(),
+		TenantID:          u.TenantID.String(),
+		Email:             u.Email,
+		EmailKey:          u.EmailKey,
+		HashedPassword:    u.HashedPassword,
+		Roles:             roleNames,
+		IsActive:          u.IsActive,
+		IsVerified:        u.IsVerified,
+		CreatedAt:         FormatDDBTime(u.CreatedAt),
+		UpdatedAt:         FormatDDBTime(u.UpdatedAt),
+		LastLoginAt:       FormatDDBTime(u.LastLoginAt),
+		PasswordChangedAt: FormatDDBTime(u.PasswordChangedAt),
+		DeactivatedAt:     FormatDDBTime(u.DeactivatedAt),
+		ErasedAt:          FormatDDBTime(u.ErasedAt),
+		Profile:           u.Profile,
+		Version:           u.Version,
 	}
 }
 
@@ -32,6 +73,14 @@ func FromDDB(d UserDDB) (model.User, error) {
 	if err != nil {
 		return model.User{}, err
 	}
+	// Items written before multi-tenancy have no tenant and belong to the default one.
+	tenantID := model.DefaultTenantID
+	if d.TenantID != "" {
+		tenantID, err = uuid.Parse(d.TenantID)
+		if err != nil {
+			return model.User{}, err
+		}
+	}
 	roles := make([]model.Role, 0, len(d.Roles))
 	for _, name := range d.Roles {
 		r, err := model.ParseRole(name)
@@ -40,11 +89,217 @@ func FromDDB(d UserDDB) (model.User, error) {
 		}
 		roles = append(roles, r)
 	}
+	createdAt, err := ParseDDBTime(d.CreatedAt)
+	if err != nil {
+		return model.User{}, err
+	}
+	updatedAt, err := ParseDDBTime(d.UpdatedAt)
+	if err != nil {
+		return model.User{}, err
+	}
+	lastLoginAt, err := ParseDDBTime(d.LastLoginAt)
+	if err != nil {
+		return model.User{}, err
+	}
+	passwordChangedAt, err := ParseDDBTime(d.PasswordChangedAt)
+	if err != nil {
+		return model.User{}, err
+	}
+	deactivatedAt, err := ParseDDBTime(d.DeactivatedAt)
+	if err != nil {
+		return model.User{}, err
+	}
+	erasedAt, err := ParseDDBTime(d.ErasedAt)
+	if err != nil {
+		return model.User{}, err
+	}
 	return model.User{
-		ID:             id,
-		Email:          d.Email,
-		HashedPassword: d.HashedPassword,
-		Roles:          roles,
-		IsActive:       d.IsActive,
+		ID:                id,
+		TenantID:          tenantID,
+		Email:             d.Email,
+		EmailKey:          d.EmailKey,
+		HashedPassword:    d.HashedPassword,
+		Roles:             roles,
+		IsActive:          d.IsActive,
+		IsVerified:        d.IsVerified,
+		CreatedAt:         createdAt,
+		UpdatedAt:         updatedAt,
+		LastLoginAt:       lastLoginAt,
+		PasswordChangedAt: passwordChangedAt,
+		DeactivatedAt:     deactivatedAt,
+		ErasedAt:          erasedAt,
+		Profile:           d.Profile,
+		Version:           d.Version,
+	}, nil
+}
+
+type OrganizationDDB struct {
+	ID   string `dynamodbav:"id"`
+	Name string `dynamodbav:"name"`
+}
+
+func OrganizationToDDB(o model.Organization) OrganizationDDB {
+	return OrganizationDDB{
+		ID:   o.ID.String(),
+		Name: o.Name,
+	}
+}
+
+func OrganizationFromDDB(d OrganizationDDB) (model.Organization, error) {
+	id, err := uuid.Parse(d.ID)
+	if err != nil {
+		return model.Organization{}, err
+	}
+	return model.Organization{
+		ID:   id,
+		Name: d.Name,
+	}, nil
+}
+
+type InvitationDDB struct {
+	ID        string    `dynamodbav:"id"`
+	TenantID  string    `dynamodbav:"tenant_id"`
+	Email     string    `dynamodbav:"email"`
+	Roles     []string  `dynamodbav:"roles"`
+	Status    string    `dynamodbav:"status"`
+	InvitedBy string    `dynamodbav:"invited_by"`
+	ExpiresAt time.Time `dynamodbav:"expires_at"`
+}
+
+func InvitationToDDB(i model.Invitation) InvitationDDB {
+	roleNames := make([]string, 0, len(i.Roles))
+	for _, r := range i.Roles {
+		roleNames = append(roleNames, r.GetName())
+	}
+	return InvitationDDB{
+		ID:        i.ID.String(),
+		TenantID:  i.TenantID.String(),
+		Email:     i.Email,
+		Roles:     roleNames,
+		Status:    string(i.Status),
+		InvitedBy: i.InvitedBy,
+		ExpiresAt: i.ExpiresAt,
+	}
+}
+
+func InvitationFromDDB(d InvitationDDB) (model.Invitation, error) {
+	id, err := uuid.Parse(d.ID)
+	if err != nil {
+		return model.Invitation{}, err
+	}
+	tenantID, err := uuid.Parse(d.TenantID)
+	if err != nil {
+		return model.Invitation{}, err
+	}
+	roles := make([]model.Role, 0, len(d.Roles))
+	for _, name := range d.Roles {
+		r, err := model.ParseRole(name)
+		if err != nil {
+			return model.Invitation{}, err
+		}
+		roles = append(roles, r)
+	}
+	return model.Invitation{
+		ID:        id,
+		TenantID:  tenantID,
+		Email:     d.Email,
+		Roles:     roles,
+		Status:    model.InvitationStatus(d.Status),
+		InvitedBy: d.InvitedBy,
+		ExpiresAt: d.ExpiresAt,
+	}, nil
+}
+
+type AuditEventDDB struct {
+	ID           string    `dynamodbav:"id"`
+	TenantID     string    `dynamodbav:"tenant_id"`
+	OccurredAt   time.Time `dynamodbav:"occurred_at"`
+	Action       string    `dynamodbav:"action"`
+	ActorID      string    `dynamodbav:"actor_id"`
+	ActorEmail   string    `dynamodbav:"actor_email"`
+	SubjectID    string    `dynamodbav:"subject_id"`
+	SubjectEmail string    `dynamodbav:"subject_email"`
+	Impersonated bool      `dynamodbav:"impersonated"`
+	Detail       string    `dynamodbav:"detail"`
+}
+
+func AuditEventToDDB(e model.AuditEvent) AuditEventDDB {
+	return AuditEventDDB{
+		ID:           e.ID.String(),
+		TenantID:     e.TenantID.String(),
+		OccurredAt:   e.OccurredAt,
+		Action:       e.Action,
+		ActorID:      e.ActorID.String(),
+		ActorEmail:   e.ActorEmail,
+		SubjectID:    e.SubjectID.String(),
+		SubjectEmail: e.SubjectEmail,
+		Impersonated: e.Impersonated,
+		Detail:       e.Detail,
+	}
+}
+
+func AuditEventFromDDB(d AuditEventDDB) (model.AuditEvent, error) {
+	id, err := uuid.Parse(d.ID)
+	if err != nil {
+		return model.AuditEvent{}, err
+	}
+	tenantID, err := uuid.Parse(d.TenantID)
+	if err != nil {
+		return model.AuditEvent{}, err
+	}
+	actorID, err := uuid.Parse(d.ActorID)
+	if err != nil {
+		return model.AuditEvent{}, err
+	}
+	subjectID, err := uuid.Parse(d.SubjectID)
+	if err != nil {
+		return model.AuditEvent{}, err
+	}
+	return model.AuditEvent{
+		ID:           id,
+		TenantID:     tenantID,
+		OccurredAt:   d.OccurredAt,
+		Action:       d.Action,
+		ActorID:      actorID,
+		ActorEmail:   d.ActorEmail,
+		SubjectID:    subjectID,
+		SubjectEmail: d.SubjectEmail,
+		Impersonated: d.Impersonated,
+		Detail:       d.Detail,
 	}, nil
 }
+
+// Times are epoch seconds: expires_at is the table's TTL attribute, and both are compared in conditions.
+type IdempotencyRecordDDB struct {
+	Key         string            `dynamodbav:"key"`
+	RequestHash string            `dynamodbav:"request_hash"`
+	StatusCode  int               `dynamodbav:"status_code"`
+	Header      map[string]string `dynamodbav:"header,omitempty"`
+	Body        []byte            `dynamodbav:"body,omitempty"`
+	LockedUntil int64             `dynamodbav:"locked_until"`
+	ExpiresAt   int64             `dynamodbav:"expires_at"`
+}
+
+func IdempotencyRecordToDDB(r model.IdempotencyRecord) IdempotencyRecordDDB {
+	return IdempotencyRecordDDB{
+		Key:         r.Key,
+		RequestHash: r.RequestHash,
+		StatusCode:  r.StatusCode,
+		Header:      r.Header,
+		Body:        r.Body,
+		LockedUntil: r.LockedUntil.Unix(),
+		ExpiresAt:   r.ExpiresAt.Unix(),
+	}
+}
+
+func IdempotencyRecordFromDDB(d IdempotencyRecordDDB) model.IdempotencyRecord {
+	return model.IdempotencyRecord{
+		Key:         d.Key,
+		RequestHash: d.RequestHash,
+		StatusCode:  d.StatusCode,
+		Header:      d.Header,
+		Body:        d.Body,
+		LockedUntil: time.Unix(d.LockedUntil, 0).UTC(),
+		ExpiresAt:   time.Unix(d.ExpiresAt, 0).UTC(),
+	}
+}
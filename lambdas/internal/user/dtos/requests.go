@@ -5,32 +5,64 @@ import (
 )
 
 type RegisterRequest struct {
-	Email    string   `json:"email" validate:"required,email"`
-	Password string   `json:"password" validate:"required,min=6,max=20"`
-	Roles    []string `json:"roles" validate:"omitempty,dive,oneof=user admin"`
+	TenantID uuid.UUID `json:"tenant_id"`
+	Email    string    `json:"email" validate:"required,email"`
+	Password string    `json:"password" validate:"required,min=6,max=20"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6,max=20"`
+	TenantID uuid.UUID `json:"tenant_id"`
+	Email    string    `json:"email" validate:"required,email"`
+	Password string    `json:"password" validate:"required,min=6,max=20"`
 }
 
 type UnregisterRequest struct {
-	Email string `json:"email" validate:"required,email"`
+	Email           string `json:"email" validate:"required,email"`
+	ExpectedVersion *int64 `json:"-"`
 }
 
 type CheckUserRequest struct {
 	Token  string `json:"token" validate:"required"`
 }
 
+// ExpectedVersion comes from If-Match; nil means no precondition.
+// PUT replaces the whole user, so email and roles are both required; an empty roles list is allowed.
 type UpdateUserRequest struct {
-	ID    uuid.UUID `json:"-"`
-	Email string    `json:"email" validate:"omitempty,email"`
-	Roles []string  `json:"roles" validate:"omitempty,dive,oneof=user admin"`
+	ID              uuid.UUID `json:"-"`
+	ExpectedVersion *int64    `json:"-"`
+	Email           string    `json:"email" validate:"required,email"`
+	Roles           []string  `json:"roles" validate:"required,dive,oneof=user support admin super-admin"`
+}
+
+// An RFC 7396 merge patch of a user; nil fields were left out of the patch, and a null roles member
+// removes every role.
+type PatchUserRequest struct {
+	ID              uuid.UUID `json:"-"`
+	ExpectedVersion *int64    `json:"-"`
+	Email           *string   `json:"email" validate:"omitempty,email"`
+	Roles           *[]string `json:"roles" validate:"omitempty,dive,oneof=user support admin super-admin"`
+}
+
+// Fields left out keep their value; an empty string, or null for an attribute, clears one.
+type UpdateProfileRequest struct {
+	ID              uuid.UUID      `json:"-"`
+	ExpectedVersion *int64         `json:"-"`
+	DisplayName     *string        `json:"display_name"`
+	Locale          *string        `json:"locale"`
+	Timezone        *string        `json:"timezone"`
+	AvatarURL       *string        `json:"avatar_url"`
+	Attributes      map[string]any `json:"attributes"`
+}
+
+type AssignRolesRequest struct {
+	ID              uuid.UUID `json:"-"`
+	ExpectedVersion *int64    `json:"-"`
+	Roles           []string  `json:"roles" validate:"required,min=1,dive,oneof=user support admin super-admin"`
 }
 
 type RequestPasswordResetRequest struct {
-	Email string `json:"email" validate:"required,email"`
+	TenantID uuid.UUID `json:"tenant_id"`
+	Email    string    `json:"email" validate:"required,email"`
 }
 
 type ResetPasswordRequest struct {
@@ -38,3 +70,60 @@ type ResetPasswordRequest struct {
 	Password   string `json:"password" validate:"required,min=6,max=20"`
 	ResetToken string `json:"reset_token,omitempty"`
 }
+
+type ConfirmErasureRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// One row of a bulk import. Rows are validated as a RegisterRequest, or as a CreateInvitationRequest when
+// they have no password and invitations are on.
+type ImportUserRow struct {
+	Line     int      `json:"-"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+// DryRun validates and reports without writing; Invite invites rows that have no password.
+type ImportOptions struct {
+	DryRun bool
+	Invite bool
+	// Rows with a password are hashed one by one; 0 means no limit
+	MaxPasswords int
+}
+
+type CreateInvitationRequest struct {
+	// Platform admins only; defaults to the caller's organization
+	TenantID *uuid.UUID `json:"tenant_id,omitempty"`
+	Email    string     `json:"email" validate:"required,email"`
+	Roles    []string   `json:"roles" validate:"omitempty,dive,oneof=user support admin super-admin"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,max=20"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
+
+// Built from query params. Times are RFC3339.
+type ListUsersRequest struct {
+	Limit       int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Cursor      string `query:"cursor" validate:"omitempty,max=1024"`
+	Active      *bool  `query:"active"`
+	Role        string `query:"role" validate:"omitempty,oneof=user support admin super-admin"`
+	EmailPrefix string `query:"email_prefix" validate:"omitempty,max=254"`
+	CreatedFrom string `query:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedTo   string `query:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	UpdatedFrom string `query:"updated_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	UpdatedTo   string `query:"updated_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	// Users that never logged in count as inactive
+	LastLoginBefore       string `query:"last_login_before" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	LastLoginAfter        string `query:"last_login_after" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	InactiveDays          int    `query:"inactive_days" validate:"omitempty,min=1,max=36500,excluded_with=LastLoginBefore"`
+	PasswordChangedBefore string `query:"password_changed_before" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Sort                  string `query:"sort" validate:"omitempty,oneof=email created_at"`
+	Order                 string `query:"order" validate:"omitempty,oneof=asc desc"`
+}
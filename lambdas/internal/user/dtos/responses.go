@@ -1,6 +1,11 @@
 package dtos
 
-import "github.com/danilobml/user-manager/internal/user/model"
+import (
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
 
 type RegisterResponse struct {
 	Token string `json:"token,omitempty"`
@@ -11,8 +16,63 @@ type LoginResponse struct {
 }
 
 type CheckUserResponse struct {
-	IsValid bool       `json:"is_valid"`
-	User    model.User `json:"user"`
+	IsValid        bool       `json:"is_valid"`
+	User           model.User `json:"user"`
+	ImpersonatedBy string     `json:"impersonated_by,omitempty"`
+}
+
+type ImpersonateResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type GetAllUsersResponse struct {
+	Users      []ResponseUser `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
-type GetAllUsersResponse = []ResponseUser
+// Everything stored about one user, for subject access requests. Roles and timestamps are part of User.
+type UserExport struct {
+	ExportedAt   time.Time           `json:"exported_at"`
+	User         ResponseUser        `json:"user"`
+	Organization *model.Organization `json:"organization,omitempty"`
+	AuditEvents  []*model.AuditEvent `json:"audit_events"`
+}
+
+type AcceptInvitationResponse struct {
+	Token string `json:"token,omitempty"`
+}
+
+type GetAllInvitationsResponse = []ResponseInvitation
+
+type CreateOrganizationResponse = model.Organization
+
+type GetAllOrganizationsResponse = []model.Organization
+
+const (
+	ImportCreated = "created"
+	ImportInvited = "invited"
+	ImportSkipped = "skipped"
+	ImportInvalid = "invalid"
+	ImportFailed  = "failed"
+)
+
+// On a dry run the counts and statuses say what an import would do.
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Created int               `json:"created"`
+	Invited int               `json:"invited"`
+	Skipped int               `json:"skipped"`
+	Invalid int               `json:"invalid"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+type ImportRowResult struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Invalid fields of the row, like the errors of a validation_failed response
+	Errors []errs.FieldError `json:"errors,omitempty"`
+}
@@ -1,10 +1,38 @@
 package dtos
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/google/uuid"
+)
 
 type ResponseUser struct {
-	ID       uuid.UUID `json:"id"`
-	Email    string    `json:"email"`
-	Roles    []string  `json:"roles"`
-	IsActive bool      `json:"is_active"`
+	ID         uuid.UUID `json:"id"`
+	TenantID   uuid.UUID `json:"tenant_id"`
+	Email      string    `json:"email"`
+	Roles      []string  `json:"roles"`
+	IsActive   bool      `json:"is_active"`
+	IsVerified bool      `json:"is_verified"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Omitted while unknown: never logged in, or registered before password changes were tracked.
+	LastLoginAt       time.Time `json:"last_login_at,omitzero"`
+	PasswordChangedAt time.Time `json:"password_changed_at,omitzero"`
+	// Only set on inactive users.
+	DeactivatedAt time.Time `json:"deactivated_at,omitzero"`
+	ErasedAt      time.Time `json:"erased_at,omitzero"`
+	// Only the parts the caller may see.
+	Profile model.Profile `json:"profile"`
+	Version int64         `json:"version"`
+}
+
+type ResponseInvitation struct {
+	ID        uuid.UUID `json:"id"`
+	TenantID  uuid.UUID `json:"tenant_id"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	Status    string    `json:"status"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
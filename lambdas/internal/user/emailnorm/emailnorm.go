@@ -0,0 +1,88 @@
+// Package emailnorm turns the addresses users type into the keys used to look them up,
+// so "Alice@Example.com" and "alice@example.com" are the same account.
+package emailnorm
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rules are the optional, provider-specific rewrites. Both change which addresses count as the same
+// account, so turning one on for existing data needs the keys rebuilt.
+type Rules struct {
+	// Drops "+tag" from the local part for every domain.
+	StripPlusTags bool
+	// Applies the rules of known providers, e.g. Gmail ignores dots and "+tag" and googlemail.com is gmail.com.
+	ProviderRules bool
+}
+
+type Normalizer struct {
+	rules Rules
+}
+
+func NewNormalizer(rules Rules) *Normalizer {
+	return &Normalizer{rules: rules}
+}
+
+// Display is the address as shown back to the user: trimmed and in canonical Unicode form, case kept.
+func (n *Normalizer) Display(email string) string {
+	return norm.NFC.String(strings.TrimSpace(email))
+}
+
+// Key is the form used for uniqueness and lookups.
+func (n *Normalizer) Key(email string) string {
+	key := Fold(email)
+
+	at := strings.LastIndex(key, "@")
+	if at < 0 {
+		return key
+	}
+	local, domain := key[:at], key[at+1:]
+
+	if n.rules.ProviderRules {
+		if provider, ok := providers[domain]; ok {
+			domain = provider.domain
+			if provider.ignoreDots {
+				local = strings.ReplaceAll(local, ".", "")
+			}
+			if provider.plusTags {
+				local = stripPlusTag(local)
+			}
+		}
+	}
+	if n.rules.StripPlusTags {
+		local = stripPlusTag(local)
+	}
+
+	return local + "@" + domain
+}
+
+// Fold applies only the rule-independent part of Key, so it also works on partial addresses such as search prefixes.
+func Fold(s string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimSpace(s)))
+}
+
+type provider struct {
+	domain     string
+	ignoreDots bool
+	plusTags   bool
+}
+
+var providers = map[string]provider{
+	"gmail.com":      {domain: "gmail.com", ignoreDots: true, plusTags: true},
+	"googlemail.com": {domain: "gmail.com", ignoreDots: true, plusTags: true},
+	"outlook.com":    {domain: "outlook.com", plusTags: true},
+	"hotmail.com":    {domain: "hotmail.com", plusTags: true},
+	"icloud.com":     {domain: "icloud.com", plusTags: true},
+	"fastmail.com":   {domain: "fastmail.com", plusTags: true},
+	"protonmail.com": {domain: "protonmail.com", plusTags: true},
+	"proton.me":      {domain: "proton.me", plusTags: true},
+}
+
+func stripPlusTag(local string) string {
+	if plus := strings.Index(local, "+"); plus > 0 {
+		return local[:plus]
+	}
+	return local
+}
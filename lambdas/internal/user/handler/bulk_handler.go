@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/bulkio"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/service"
+)
+
+// API Gateway rejects larger payloads anyway; bigger files go through the bulk CLI.
+const maxImportBytes = 10 << 20
+
+// bcrypt takes over a second per password, and API Gateway gives up after 29 seconds.
+const maxImportPasswords = 10
+
+type BulkHandler struct {
+	bulkService service.BulkService
+}
+
+func NewBulkHandler(bulkService service.BulkService) *BulkHandler {
+	return &BulkHandler{
+		bulkService: bulkService,
+	}
+}
+
+// The request body is the file itself, in the format given by ?format=csv|jsonl.
+func (bh *BulkHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	format, err := bulkio.ParseFormat(query.Get("format"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+	opts := dtos.ImportOptions{MaxPasswords: maxImportPasswords}
+	for name, target := range map[string]*bool{"dry_run": &opts.DryRun, "invite": &opts.Invite} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				helpers.WriteErrorsResponse(w, errs.NewValidationError(errs.FieldError{Field: name, Rule: "boolean", Message: "must be true or false"}))
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	rows, err := bulkio.NewRowReader(r.Body, format)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	report, err := bh.bulkService.ImportUsers(ctx, rows, opts)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusOK, report)
+}
+
+// Streams the file: once the first user is written the status is sent, so a later failure cuts the file short.
+func (bh *BulkHandler) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	format, err := bulkio.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	writer := bulkio.NewUserWriter(w, format)
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+		started = true
+	}
+
+	err = bh.bulkService.ExportUsers(ctx, func(user dtos.ResponseUser) error {
+		if !started {
+			start()
+		}
+		return writer.Write(user)
+	})
+	if err != nil && !started {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+	if err != nil {
+		log.Println("Error exporting users: ", err)
+		return
+	}
+
+	if !started {
+		start()
+	}
+	if err := writer.Flush(); err != nil {
+		log.Println("Error exporting users: ", err)
+	}
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/service"
+	"github.com/google/uuid"
+)
+
+type InvitationHandler struct {
+	invitationService service.InvitationService
+}
+
+func NewInvitationHandler(invitationService service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+	}
+}
+
+func (ih *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	createInvitationReq := dtos.CreateInvitationRequest{}
+	err := json.NewDecoder(r.Body).Decode(&createInvitationReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
+		return
+	}
+
+	if !isInputValid(w, createInvitationReq) {
+		return
+	}
+
+	createInvitationReq.Email = strings.TrimSpace(createInvitationReq.Email)
+
+	resp, err := ih.invitationService.CreateInvitation(ctx, createInvitationReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusCreated, resp)
+}
+
+func (ih *InvitationHandler) GetAllInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	invitations, err := ih.invitationService.ListInvitations(ctx)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusOK, invitations)
+}
+
+func (ih *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	invitationId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	err = ih.invitationService.RevokeInvitation(ctx, invitationId)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusNoContent, "revoked")
+}
+
+func (ih *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	acceptInvitationReq := dtos.AcceptInvitationRequest{}
+	err := json.NewDecoder(r.Body).Decode(&acceptInvitationReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
+		return
+	}
+
+	if !isInputValid(w, acceptInvitationReq) {
+		return
+	}
+
+	acceptInvitationReq.Token = strings.TrimSpace(acceptInvitationReq.Token)
+	acceptInvitationReq.Password = strings.TrimSpace(acceptInvitationReq.Password)
+
+	resp, err := ih.invitationService.AcceptInvitation(ctx, acceptInvitationReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusCreated, resp)
+}
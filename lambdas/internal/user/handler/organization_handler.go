@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/service"
+)
+
+type OrganizationHandler struct {
+	organizationService service.OrganizationService
+}
+
+func NewOrganizationHandler(organizationService service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationService: organizationService,
+	}
+}
+
+func (oh *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	createOrgReq := dtos.CreateOrganizationRequest{}
+	err := json.NewDecoder(r.Body).Decode(&createOrgReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
+		return
+	}
+
+	if !isInputValid(w, createOrgReq) {
+		return
+	}
+
+	createOrgReq.Name = strings.TrimSpace(createOrgReq.Name)
+
+	resp, err := oh.organizationService.CreateOrganization(ctx, createOrgReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusCreated, resp)
+}
+
+func (oh *OrganizationHandler) GetAllOrganizations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgs, err := oh.organizationService.ListAllOrganizations(ctx)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusOK, orgs)
+}
@@ -3,13 +3,16 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/danilobml/user-manager/internal/errs"
 	"github.com/danilobml/user-manager/internal/helpers"
 	"github.com/danilobml/user-manager/internal/user/dtos"
 	"github.com/danilobml/user-manager/internal/user/service"
-	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 )
 
@@ -33,11 +36,11 @@ func (uh *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	registerReq := dtos.RegisterRequest{}
 	err := json.NewDecoder(r.Body).Decode(&registerReq)
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
 		return
 	}
 
-	if !uh.isInputValid(w, registerReq) {
+	if !isInputValid(w, registerReq) {
 		return
 	}
 
@@ -61,11 +64,11 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	loginReq := dtos.LoginRequest{}
 	err := json.NewDecoder(r.Body).Decode(&loginReq)
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
 		return
 	}
 
-	if !uh.isInputValid(w, loginReq) {
+	if !isInputValid(w, loginReq) {
 		return
 	}
 
@@ -90,6 +93,7 @@ func (uh *UserHandler) GetUserData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", helpers.FormatETag(resp.Version))
 	helpers.WriteJSONResponse(w, http.StatusOK, resp)
 }
 
@@ -98,7 +102,13 @@ func (uh *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	userId, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "no valid user id supplied")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	expectedVersion, err := helpers.ParseIfMatch(r)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
 		return
 	}
 
@@ -107,15 +117,16 @@ func (uh *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	updateReq := dtos.UpdateUserRequest{}
 	err = json.NewDecoder(r.Body).Decode(&updateReq)
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
 		return
 	}
 
-	if !uh.isInputValid(w, updateReq) {
+	if !isInputValid(w, updateReq) {
 		return
 	}
 
 	updateReq.ID = userId
+	updateReq.ExpectedVersion = expectedVersion
 	updateReq.Email = strings.TrimSpace(updateReq.Email)
 
 	err = uh.userService.UpdateUserData(ctx, updateReq)
@@ -127,12 +138,159 @@ func (uh *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSONResponse(w, http.StatusOK, "updated successfully")
 }
 
+// RFC 7396 merge patch; send application/merge-patch+json (plain application/json is accepted too).
+func (uh *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		helpers.WriteErrorsResponse(w, fmt.Errorf("%w: send application/merge-patch+json", errs.ErrUnsupportedMediaType))
+		return
+	}
+
+	expectedVersion, err := helpers.ParseIfMatch(r)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	patchUserReq, err := decodeUserPatch(r.Body)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	if !isInputValid(w, patchUserReq) {
+		return
+	}
+
+	patchUserReq.ID = userId
+	patchUserReq.ExpectedVersion = expectedVersion
+
+	resp, err := uh.userService.PatchUser(ctx, patchUserReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", helpers.FormatETag(resp.Version))
+	helpers.WriteJSONResponse(w, http.StatusOK, resp)
+}
+
+func (uh *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	expectedVersion, err := helpers.ParseIfMatch(r)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	updateProfileReq := dtos.UpdateProfileRequest{}
+	err = json.NewDecoder(r.Body).Decode(&updateProfileReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
+		return
+	}
+
+	updateProfileReq.ID = userId
+	updateProfileReq.ExpectedVersion = expectedVersion
+
+	resp, err := uh.userService.UpdateProfile(ctx, updateProfileReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", helpers.FormatETag(resp.Version))
+	helpers.WriteJSONResponse(w, http.StatusOK, resp)
+}
+
+func (uh *UserHandler) AssignRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	expectedVersion, err := helpers.ParseIfMatch(r)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	assignRolesReq := dtos.AssignRolesRequest{}
+	err = json.NewDecoder(r.Body).Decode(&assignRolesReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
+		return
+	}
+
+	if !isInputValid(w, assignRolesReq) {
+		return
+	}
+
+	assignRolesReq.ID = userId
+	assignRolesReq.ExpectedVersion = expectedVersion
+
+	err = uh.userService.AssignRoles(ctx, assignRolesReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusOK, "roles updated successfully")
+}
+
+func (uh *UserHandler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	resp, err := uh.userService.ImpersonateUser(ctx, userId)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusOK, resp)
+}
+
 func (uh *UserHandler) UnregisterUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	userId, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "no valid user id supplied")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	expectedVersion, err := helpers.ParseIfMatch(r)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
 		return
 	}
 
@@ -142,7 +300,7 @@ func (uh *UserHandler) UnregisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = uh.userService.Unregister(ctx, dtos.UnregisterRequest{Email: user.Email})
+	err = uh.userService.Unregister(ctx, dtos.UnregisterRequest{Email: user.Email, ExpectedVersion: expectedVersion})
 	if err != nil {
 		helpers.WriteErrorsResponse(w, err)
 		return
@@ -158,11 +316,11 @@ func (uh *UserHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Reque
 	requestPassResetReq := dtos.RequestPasswordResetRequest{}
 	err := json.NewDecoder(r.Body).Decode(&requestPassResetReq)
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
 		return
 	}
 
-	if !uh.isInputValid(w, requestPassResetReq) {
+	if !isInputValid(w, requestPassResetReq) {
 		return
 	}
 
@@ -184,11 +342,11 @@ func (uh *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	resetPassReq := dtos.ResetPasswordRequest{}
 	err := json.NewDecoder(r.Body).Decode(&resetPassReq)
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
 		return
 	}
 
-	if !uh.isInputValid(w, resetPassReq) {
+	if !isInputValid(w, resetPassReq) {
 		return
 	}
 
@@ -207,8 +365,56 @@ func (uh *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 
 func (uh *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	query := r.URL.Query()
+
+	listUsersReq := dtos.ListUsersRequest{
+		Cursor:                query.Get("cursor"),
+		Role:                  query.Get("role"),
+		EmailPrefix:           strings.TrimSpace(query.Get("email_prefix")),
+		CreatedFrom:           query.Get("created_from"),
+		CreatedTo:             query.Get("created_to"),
+		UpdatedFrom:           query.Get("updated_from"),
+		UpdatedTo:             query.Get("updated_to"),
+		LastLoginBefore:       query.Get("last_login_before"),
+		LastLoginAfter:        query.Get("last_login_after"),
+		PasswordChangedBefore: query.Get("password_changed_before"),
+		Sort:                  query.Get("sort"),
+		Order:                 query.Get("order"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			helpers.WriteErrorsResponse(w, errs.NewValidationError(errs.FieldError{Field: "limit", Rule: "number", Message: "must be a number"}))
+			return
+		}
+		listUsersReq.Limit = parsed
+		if parsed == 0 {
+			// 0 would otherwise read as "not set"
+			listUsersReq.Limit = -1
+		}
+	}
+	if inactiveDays := query.Get("inactive_days"); inactiveDays != "" {
+		parsed, err := strconv.Atoi(inactiveDays)
+		if err != nil || parsed < 1 {
+			helpers.WriteErrorsResponse(w, errs.NewValidationError(errs.FieldError{Field: "inactive_days", Rule: "min", Message: "must be a positive number"}))
+			return
+		}
+		listUsersReq.InactiveDays = parsed
+	}
+	if active := query.Get("active"); active != "" {
+		parsed, err := strconv.ParseBool(active)
+		if err != nil {
+			helpers.WriteErrorsResponse(w, errs.NewValidationError(errs.FieldError{Field: "active", Rule: "boolean", Message: "must be true or false"}))
+			return
+		}
+		listUsersReq.Active = &parsed
+	}
 
-	users, err := uh.userService.ListAllUsers(ctx)
+	if !isInputValid(w, listUsersReq) {
+		return
+	}
+
+	users, err := uh.userService.ListAllUsers(ctx, listUsersReq)
 	if err != nil {
 		helpers.WriteErrorsResponse(w, err)
 		return
@@ -223,7 +429,7 @@ func (uh *UserHandler) RemoveUser(w http.ResponseWriter, r *http.Request) {
 	idString := r.PathValue("id")
 	userId, err := uuid.Parse(idString)
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "no valid user id supplied")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
 		return
 	}
 
@@ -236,13 +442,113 @@ func (uh *UserHandler) RemoveUser(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSONResponse(w, http.StatusNoContent, "removed")
 }
 
+func (uh *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	idString := r.PathValue("id")
+	userId, err := uuid.Parse(idString)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	err = uh.userService.RestoreUser(ctx, userId)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusOK, "restored successfully")
+}
+
+func (uh *UserHandler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	export, err := uh.userService.ExportUser(ctx, userId)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s-export.json"`, userId))
+	helpers.WriteJSONResponse(w, http.StatusOK, export)
+}
+
+func (uh *UserHandler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	err = uh.userService.EraseUser(ctx, userId)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusNoContent, "erased")
+}
+
+func (uh *UserHandler) RequestErasure(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidID)
+		return
+	}
+
+	err = uh.userService.RequestErasure(ctx, userId)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusAccepted, "confirmation email sent")
+}
+
+func (uh *UserHandler) ConfirmErasure(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	confirmErasureReq := dtos.ConfirmErasureRequest{}
+	err := json.NewDecoder(r.Body).Decode(&confirmErasureReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
+		return
+	}
+
+	if !isInputValid(w, confirmErasureReq) {
+		return
+	}
+
+	confirmErasureReq.Token = strings.TrimSpace(confirmErasureReq.Token)
+
+	err = uh.userService.ConfirmErasure(ctx, confirmErasureReq)
+	if err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusNoContent, "")
+}
+
 func (uh *UserHandler) CheckUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	apiKey := strings.TrimSpace(r.Header.Get("User-Api-Key"))
 
 	if apiKey != uh.apiKey {
-		helpers.WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+		helpers.WriteErrorsResponse(w, errs.ErrUnauthorized)
 		return
 	}
 
@@ -251,11 +557,11 @@ func (uh *UserHandler) CheckUser(w http.ResponseWriter, r *http.Request) {
 	checkUserReq := dtos.CheckUserRequest{}
 	err := json.NewDecoder(r.Body).Decode(&checkUserReq)
 	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON")
+		helpers.WriteErrorsResponse(w, errs.ErrInvalidJSON)
 		return
 	}
 
-	if !uh.isInputValid(w, checkUserReq) {
+	if !isInputValid(w, checkUserReq) {
 		return
 	}
 
@@ -268,15 +574,48 @@ func (uh *UserHandler) CheckUser(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSONResponse(w, http.StatusOK, resp)
 }
 
-// Validation Helper:
-func (uh *UserHandler) isInputValid(w http.ResponseWriter, structToValidate any) bool {
-	validate := validator.New()
-	err := validate.Struct(structToValidate)
-	if err != nil {
-		errors := err.(validator.ValidationErrors)
-		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Sprintf("Validation error: %s", errors))
-		return false
+// Patch Helper:
+// The patch must be an object. Only email and roles can be changed; email can't be removed, and removing roles
+// leaves none.
+func decodeUserPatch(body io.Reader) (dtos.PatchUserRequest, error) {
+	var members map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&members); err != nil || members == nil {
+		return dtos.PatchUserRequest{}, fmt.Errorf("%w: a merge patch must be an object", errs.ErrInvalidJSON)
+	}
+
+	patchUserReq := dtos.PatchUserRequest{}
+	for name, value := range members {
+		isNull := string(value) == "null"
+		switch name {
+		case "email":
+			if isNull {
+				return dtos.PatchUserRequest{}, errs.NewValidationError(errs.FieldError{Field: "email", Rule: "required", Message: "can't be removed"})
+			}
+			if err := json.Unmarshal(value, &patchUserReq.Email); err != nil {
+				return dtos.PatchUserRequest{}, errs.NewValidationError(errs.FieldError{Field: "email", Rule: "string", Message: "must be a string"})
+			}
+			*patchUserReq.Email = strings.TrimSpace(*patchUserReq.Email)
+		case "roles":
+			roles := []string{}
+			if !isNull {
+				if err := json.Unmarshal(value, &roles); err != nil || roles == nil {
+					return dtos.PatchUserRequest{}, errs.NewValidationError(errs.FieldError{Field: "roles", Rule: "list", Message: "must be a list of role names"})
+				}
+			}
+			patchUserReq.Roles = &roles
+		default:
+			return dtos.PatchUserRequest{}, errs.NewValidationError(errs.FieldError{Field: name, Rule: "read_only", Message: "can't be changed with PATCH"})
+		}
 	}
 
+	return patchUserReq, nil
+}
+
+// Validation Helpers:
+func isInputValid(w http.ResponseWriter, structToValidate any) bool {
+	if err := helpers.ValidateStruct(structToValidate); err != nil {
+		helpers.WriteErrorsResponse(w, err)
+		return false
+	}
 	return true
 }
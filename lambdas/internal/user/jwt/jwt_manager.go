@@ -7,6 +7,7 @@ import (
 	"github.com/danilobml/user-manager/internal/errs"
 	"github.com/danilobml/user-manager/internal/user/model"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type JwtManager struct {
@@ -14,11 +15,24 @@ type JwtManager struct {
 }
 
 type Claims struct {
-	Email string
-	Roles []model.Role
+	TenantID uuid.UUID
+	Email    string
+	Roles    []model.Role
+	Act      *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the admin behind an impersonation token, carried in the "act" claim (RFC 8693).
+type Actor struct {
+	Sub      string    `json:"sub"`
+	Email    string    `json:"email"`
+	TenantID uuid.UUID `json:"tenant_id"`
+}
+
+func (c *Claims) IsImpersonated() bool {
+	return c.Act != nil
+}
+
 type ResetClaims struct {
 	Sub string `json:"sub"` // User.Id
 	Exp int64  `json:"exp"`
@@ -26,17 +40,24 @@ type ResetClaims struct {
 
 const resetTTL = 15 * time.Minute
 
+const impersonationTTL = 15 * time.Minute
+
+const erasureTTL = 1 * time.Hour
+
 func NewJwtManager(secretKey []byte) *JwtManager {
 	return &JwtManager{
 		SecretKey: secretKey,
 	}
 }
 
-func (j *JwtManager) CreateToken(email string, roles []model.Role) (string, error) {
+// The subject ties the token to one user, so it stops working if that user is erased, even if the email is reused.
+func (j *JwtManager) CreateToken(user model.User) (string, error) {
 	claims := Claims{
-		Email: email,
-		Roles: roles,
+		TenantID: user.TenantID,
+		Email:    user.Email,
+		Roles:    user.Roles,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.String(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -46,6 +67,25 @@ func (j *JwtManager) CreateToken(email string, roles []model.Role) (string, erro
 	return t.SignedString(j.SecretKey)
 }
 
+func (j *JwtManager) CreateImpersonationToken(user model.User, actor Actor) (string, time.Time, error) {
+	expiresAt := time.Now().Add(impersonationTTL)
+	claims := Claims{
+		TenantID: user.TenantID,
+		Email:    user.Email,
+		Roles:    user.Roles,
+		Act:      &actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token, err := t.SignedString(j.SecretKey)
+	return token, expiresAt, err
+}
+
 func (j *JwtManager) ParseAndValidateToken(tokenString string) (*Claims, error) {
 	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	token, err := parser.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (any, error) {
@@ -64,22 +104,47 @@ func (j *JwtManager) ParseAndValidateToken(tokenString string) (*Claims, error)
 }
 
 func (m *JwtManager) CreateResetToken(userID string) (string, error) {
+	return m.createPurposeToken(userID, "reset", time.Now().Add(resetTTL))
+}
+
+func (m *JwtManager) VerifyResetToken(tokenStr string) (string, error) {
+	return m.verifyPurposeToken(tokenStr, "reset")
+}
+
+func (m *JwtManager) CreateInviteToken(invitationID string, expiresAt time.Time) (string, error) {
+	return m.createPurposeToken(invitationID, "invite", expiresAt)
+}
+
+func (m *JwtManager) VerifyInviteToken(tokenStr string) (string, error) {
+	return m.verifyPurposeToken(tokenStr, "invite")
+}
+
+func (m *JwtManager) CreateErasureToken(userID string) (string, error) {
+	return m.createPurposeToken(userID, "erase", time.Now().Add(erasureTTL))
+}
+
+func (m *JwtManager) VerifyErasureToken(tokenStr string) (string, error) {
+	return m.verifyPurposeToken(tokenStr, "erase")
+}
+
+// Single-purpose tokens carry the subject ID and a "prp" claim, so one kind can't be replayed as another.
+func (m *JwtManager) createPurposeToken(sub string, purpose string, expiresAt time.Time) (string, error) {
 	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(resetTTL).Unix(),
-		"prp": "reset",
+		"sub": sub,
+		"exp": expiresAt.Unix(),
+		"prp": purpose,
 	}
 
 	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return tok.SignedString(m.SecretKey)
 }
 
-func (m *JwtManager) VerifyResetToken(tokenStr string) (string, error) {
+func (m *JwtManager) verifyPurposeToken(tokenStr string, purpose string) (string, error) {
 	tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
 		return m.SecretKey, nil
 	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
 	if err != nil || !tok.Valid {
-		log.Println("error parsing token: ", err.Error())
+		log.Println("error parsing token: ", err)
 		return "", errs.ErrInvalidToken
 	}
 
@@ -88,7 +153,7 @@ func (m *JwtManager) VerifyResetToken(tokenStr string) (string, error) {
 		return "", errs.ErrInvalidToken
 	}
 
-	if claims["prp"] != "reset" {
+	if claims["prp"] != purpose {
 		return "", errs.ErrInvalidToken
 	}
 
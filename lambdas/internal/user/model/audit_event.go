@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonatedRequest  = "impersonation.request"
+	AuditUserExported         = "user.exported"
+	// The erasure certificate: proves when and by whom a user was erased without naming them.
+	AuditUserErased = "user.erased"
+	// Recorded by the purge job, which has no actor.
+	AuditUserPurged = "user.purged"
+)
+
+// AuditEvent records who did what to which user. Actor and subject differ for admin actions
+// and during impersonation, where the actor is the admin behind the token.
+type AuditEvent struct {
+	ID           uuid.UUID `dynamodbav:"id" json:"id"`
+	TenantID     uuid.UUID `dynamodbav:"tenant_id" json:"tenant_id"`
+	OccurredAt   time.Time `dynamodbav:"occurred_at" json:"occurred_at"`
+	Action       string    `dynamodbav:"action" json:"action"`
+	ActorID      uuid.UUID `dynamodbav:"actor_id" json:"actor_id"`
+	ActorEmail   string    `dynamodbav:"actor_email" json:"actor_email"`
+	SubjectID    uuid.UUID `dynamodbav:"subject_id" json:"subject_id"`
+	SubjectEmail string    `dynamodbav:"subject_email" json:"subject_email"`
+	Impersonated bool      `dynamodbav:"impersonated" json:"impersonated"`
+	Detail       string    `dynamodbav:"detail" json:"detail,omitempty"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// IdempotencyRecord holds the first response to a request sent with an Idempotency-Key, so retries
+// get the same answer. StatusCode is 0 while the first request is still running.
+type IdempotencyRecord struct {
+	// Scoped to the caller and route; see middleware.Idempotency.
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Header      map[string]string
+	Body        []byte
+	// A request that never finished (a crashed Lambda) stops holding the key after this.
+	LockedUntil time.Time
+	ExpiresAt   time.Time
+}
+
+func (r *IdempotencyRecord) IsCompleted() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+	InvitationExpired  InvitationStatus = "expired"
+)
+
+type Invitation struct {
+	ID        uuid.UUID        `dynamodbav:"id" json:"id"`
+	TenantID  uuid.UUID        `dynamodbav:"tenant_id" json:"tenant_id"`
+	Email     string           `dynamodbav:"email" json:"email"`
+	Roles     []Role           `dynamodbav:"roles" json:"roles"`
+	Status    InvitationStatus `dynamodbav:"status" json:"status"`
+	InvitedBy string           `dynamodbav:"invited_by" json:"invited_by"`
+	ExpiresAt time.Time        `dynamodbav:"expires_at" json:"expires_at"`
+}
+
+// Expiry is not persisted: a pending invitation past ExpiresAt is reported as expired.
+func (i Invitation) CurrentStatus(now time.Time) InvitationStatus {
+	if i.Status == InvitationPending && now.After(i.ExpiresAt) {
+		return InvitationExpired
+	}
+	return i.Status
+}
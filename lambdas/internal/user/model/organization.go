@@ -0,0 +1,12 @@
+package model
+
+import "github.com/google/uuid"
+
+// DefaultTenantID is the organization users belong to when no tenant is supplied.
+// Admins of this tenant are platform admins and may manage organizations.
+var DefaultTenantID = uuid.Nil
+
+type Organization struct {
+	ID   uuid.UUID `dynamodbav:"id" json:"id"`
+	Name string    `dynamodbav:"name" json:"name"`
+}
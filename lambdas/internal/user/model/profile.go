@@ -0,0 +1,11 @@
+package model
+
+// Profile holds what users say about themselves. Attributes are the organization's custom fields,
+// checked against its schema; values are strings, float64 numbers or booleans.
+type Profile struct {
+	DisplayName string         `dynamodbav:"display_name,omitempty" json:"display_name,omitempty"`
+	Locale      string         `dynamodbav:"locale,omitempty" json:"locale,omitempty"`
+	Timezone    string         `dynamodbav:"timezone,omitempty" json:"timezone,omitempty"`
+	AvatarURL   string         `dynamodbav:"avatar_url,omitempty" json:"avatar_url,omitempty"`
+	Attributes  map[string]any `dynamodbav:"attributes,omitempty" json:"attributes,omitempty"`
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"github.com/danilobml/user-manager/internal/errs"
+)
+
+type Role int
+
+// Values are serialized into JWT claims, so new roles must be appended.
+const (
+	Admin Role = iota
+	AppUser
+	Support
+	SuperAdmin
+)
+
+// DefaultRole is the only role self-registered users get; anything else is granted by an admin.
+const DefaultRole = AppUser
+
+var roleName = map[Role]string{
+	Admin:      "admin",
+	AppUser:    "user",
+	Support:    "support",
+	SuperAdmin: "super-admin",
+}
+
+func (r Role) GetName() string {
+	return roleName[r]
+}
+
+func ParseRole(s string) (Role, error) {
+	for r, name := range roleName {
+		if name == s {
+			return r, nil
+		}
+	}
+	return 0, errs.ErrParsingRoles
+}
+
+type Permission string
+
+const (
+	PermManageOwnAccount    Permission = "account:manage"
+	PermReadUsers           Permission = "users:read"
+	PermManageUsers         Permission = "users:manage"
+	PermImpersonateUsers    Permission = "users:impersonate"
+	PermManageOrganizations Permission = "organizations:manage"
+)
+
+type Permissions map[Permission]struct{}
+
+func (p Permissions) Has(permission Permission) bool {
+	_, ok := p[permission]
+	return ok
+}
+
+// Covers reports whether p holds every permission in other.
+func (p Permissions) Covers(other Permissions) bool {
+	for permission := range other {
+		if !p.Has(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// RoleHierarchy resolves the permissions a set of roles grants, including everything
+// inherited from parent roles: a role's parents are the lower roles it builds on.
+type RoleHierarchy struct {
+	parents     map[Role][]Role
+	permissions map[Role][]Permission
+}
+
+// DefaultRoleHierarchy is super-admin > admin > support > user.
+var DefaultRoleHierarchy = MustRoleHierarchy(
+	map[Role][]Role{
+		SuperAdmin: {Admin},
+		Admin:      {Support},
+		Support:    {AppUser},
+	},
+	map[Role][]Permission{
+		AppUser:    {PermManageOwnAccount},
+		Support:    {PermReadUsers},
+		Admin:      {PermManageUsers, PermImpersonateUsers},
+		SuperAdmin: {PermManageOrganizations},
+	},
+)
+
+func NewRoleHierarchy(parents map[Role][]Role, permissions map[Role][]Permission) (*RoleHierarchy, error) {
+	h := &RoleHierarchy{
+		parents:     parents,
+		permissions: permissions,
+	}
+	if h.hasCycle() {
+		return nil, errs.ErrRoleCycle
+	}
+	return h, nil
+}
+
+func MustRoleHierarchy(parents map[Role][]Role, permissions map[Role][]Permission) *RoleHierarchy {
+	h, err := NewRoleHierarchy(parents, permissions)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// EffectiveRoles returns the given roles plus every role they inherit from.
+func (h *RoleHierarchy) EffectiveRoles(roles []Role) []Role {
+	seen := make(map[Role]bool)
+	effective := make([]Role, 0, len(roles))
+
+	var visit func(r Role)
+	visit = func(r Role) {
+		if seen[r] {
+			return
+		}
+		seen[r] = true
+		effective = append(effective, r)
+		for _, parent := range h.parents[r] {
+			visit(parent)
+		}
+	}
+	for _, r := range roles {
+		visit(r)
+	}
+
+	return effective
+}
+
+func (h *RoleHierarchy) EffectivePermissions(roles []Role) Permissions {
+	permissions := make(Permissions)
+	for _, r := range h.EffectiveRoles(roles) {
+		for _, permission := range h.permissions[r] {
+			permissions[permission] = struct{}{}
+		}
+	}
+	return permissions
+}
+
+// Depth-first search; a role met again while still on the stack closes a cycle.
+func (h *RoleHierarchy) hasCycle() bool {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make(map[Role]int)
+
+	var visit func(r Role) bool
+	visit = func(r Role) bool {
+		switch state[r] {
+		case inProgress:
+			return true
+		case done:
+			return false
+		}
+		state[r] = inProgress
+		for _, parent := range h.parents[r] {
+			if visit(parent) {
+				return true
+			}
+		}
+		state[r] = done
+		return false
+	}
+
+	for r := range h.parents {
+		if visit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,39 +1,33 @@
 package model
 
 import (
-	"github.com/danilobml/user-manager/internal/errs"
-	"github.com/google/uuid"
-)
-
-type Role int
+	"time"
 
-const (
-	Admin Role = iota
-	AppUser
+	"github.com/google/uuid"
 )
 
-var roleName = map[Role]string{
-	Admin:   "admin",
-	AppUser: "user",
-}
-
-func (r Role) GetName() string {
-	return roleName[r]
-}
-
-func ParseRole(s string) (Role, error) {
-	for r, name := range roleName {
-		if name == s {
-			return r, nil
-		}
-	}
-	return 0, errs.ErrParsingRoles
-}
-
 type User struct {
-	ID             uuid.UUID `dynamodbav:"id" json:"id"`
-	Email          string    `dynamodbav:"email" json:"email"`
+	ID       uuid.UUID `dynamodbav:"id" json:"id"`
+	TenantID uuid.UUID `dynamodbav:"tenant_id" json:"tenant_id"`
+	Email    string    `dynamodbav:"email" json:"email"`
+	// Normalized Email, used for uniqueness and lookups.
+	EmailKey       string    `dynamodbav:"email_key" json:"-"`
 	HashedPassword string    `dynamodbav:"hashed_password" json:"-"`
 	Roles          []Role    `dynamodbav:"roles" json:"roles"`
 	IsActive       bool      `dynamodbav:"is_active" json:"is_active"`
+	IsVerified     bool      `dynamodbav:"is_verified" json:"is_verified"`
+	CreatedAt      time.Time `dynamodbav:"created_at" json:"created_at"`
+	// Set by the repository on every write.
+	UpdatedAt time.Time `dynamodbav:"updated_at" json:"updated_at"`
+	// Zero until the user first logs in.
+	LastLoginAt       time.Time `dynamodbav:"last_login_at" json:"last_login_at"`
+	PasswordChangedAt time.Time `dynamodbav:"password_changed_at" json:"password_changed_at"`
+	// Zero while the user is active; set by the repository when IsActive turns false.
+	DeactivatedAt time.Time `dynamodbav:"deactivated_at" json:"deactivated_at"`
+	// Set once the user's personal data has been erased; the repository never clears it.
+	ErasedAt time.Time `dynamodbav:"erased_at" json:"erased_at"`
+	// Written as a whole by Update, like Roles.
+	Profile Profile `dynamodbav:"profile" json:"profile"`
+	// Bumped by every successful Update; Update fails with ErrConflict if it doesn't match the stored one.
+	Version int64 `dynamodbav:"version" json:"version"`
 }
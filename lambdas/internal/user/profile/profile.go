@@ -0,0 +1,337 @@
+// Package profile checks user profiles against the configured attribute schema and trims them down
+// to what a given viewer may see.
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // Lambda images may not ship a zoneinfo database
+
+	"github.com/google/uuid"
+	"golang.org/x/text/language"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+type AttributeType string
+
+const (
+	TypeString  AttributeType = "string"
+	TypeNumber  AttributeType = "number"
+	TypeBoolean AttributeType = "boolean"
+)
+
+// Visibility says who may read a value: the user and admins (self), admins only (admin),
+// or anyone allowed to see the user (public). Users edit their own self and public values; admin ones
+// are set by admins.
+type Visibility string
+
+const (
+	VisibilitySelf   Visibility = "self"
+	VisibilityAdmin  Visibility = "admin"
+	VisibilityPublic Visibility = "public"
+)
+
+// Viewer is how the reader relates to the user whose profile is shown.
+type Viewer int
+
+const (
+	ViewerOther Viewer = iota
+	ViewerSelf
+	ViewerAdmin
+)
+
+func (v Viewer) canSee(visibility Visibility) bool {
+	switch v {
+	case ViewerAdmin:
+		return true
+	case ViewerSelf:
+		return visibility != VisibilityAdmin
+	default:
+		return visibility == VisibilityPublic
+	}
+}
+
+// The built-in fields have fixed visibility.
+var fieldVisibility = map[string]Visibility{
+	"display_name": VisibilityPublic,
+	"avatar_url":   VisibilityPublic,
+	"locale":       VisibilitySelf,
+	"timezone":     VisibilitySelf,
+}
+
+const (
+	maxDisplayName = 100
+	maxAvatarURL   = 2048
+	maxStringValue = 1024
+)
+
+type Attribute struct {
+	Name     string        `json:"name"`
+	Type     AttributeType `json:"type"`
+	Required bool          `json:"required"`
+	// Only for strings; the whole value must match.
+	Pattern    string     `json:"pattern"`
+	Visibility Visibility `json:"visibility"`
+
+	pattern *regexp.Regexp
+}
+
+// Schema lists the custom attributes one organization's users have.
+type Schema struct {
+	attributes map[string]Attribute
+}
+
+// Schemas holds the attributes every organization has plus each organization's own. A nil *Schemas
+// has no custom attributes.
+type Schemas struct {
+	common  []Attribute
+	tenants map[uuid.UUID]*Schema
+}
+
+type schemasDocument struct {
+	Attributes []Attribute               `json:"attributes"`
+	Tenants    map[uuid.UUID][]Attribute `json:"tenants"`
+}
+
+// ParseSchemas reads the PROFILE_SCHEMA document:
+//
+//	{"attributes": [{"name": "department", "type": "string", "visibility": "admin"}],
+//	 "tenants": {"<organization id>": [{"name": "badge", "type": "number", "required": true}]}}
+//
+// Tenant attributes are added to the common ones and replace any of the same name. An empty document
+// means no custom attributes.
+func ParseSchemas(document string) (*Schemas, error) {
+	schemas := &Schemas{tenants: map[uuid.UUID]*Schema{}}
+	if strings.TrimSpace(document) == "" {
+		return schemas, nil
+	}
+
+	var doc schemasDocument
+	if err := json.Unmarshal([]byte(document), &doc); err != nil {
+		return nil, fmt.Errorf("profile schema: %w", err)
+	}
+	common, err := compile(doc.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	schemas.common = common
+	for tenantID, attributes := range doc.Tenants {
+		own, err := compile(attributes)
+		if err != nil {
+			return nil, fmt.Errorf("organization %s: %w", tenantID, err)
+		}
+		schema := newSchema(common)
+		for _, attribute := range own {
+			schema.attributes[attribute.Name] = attribute
+		}
+		schemas.tenants[tenantID] = schema
+	}
+
+	return schemas, nil
+}
+
+func (s *Schemas) For(tenantID uuid.UUID) *Schema {
+	if s == nil {
+		return newSchema(nil)
+	}
+	if schema, ok := s.tenants[tenantID]; ok {
+		return schema
+	}
+	return newSchema(s.common)
+}
+
+// Validate checks a whole profile, as it will be stored, and returns it in canonical form: trimmed,
+// the locale as a BCP 47 tag and numbers as float64. Required attributes are only enforced when the
+// editor may set them, so users aren't blocked by admin attributes nobody has filled in yet.
+func (s *Schema) Validate(profile model.Profile, editor Viewer) (model.Profile, error) {
+	canonical := model.Profile{
+		DisplayName: strings.TrimSpace(profile.DisplayName),
+		Locale:      strings.TrimSpace(profile.Locale),
+		Timezone:    strings.TrimSpace(profile.Timezone),
+		AvatarURL:   strings.TrimSpace(profile.AvatarURL),
+	}
+
+	if len([]rune(canonical.DisplayName)) > maxDisplayName {
+		return model.Profile{}, invalid("display_name is longer than %d characters", maxDisplayName)
+	}
+	if canonical.Locale != "" {
+		tag, err := language.Parse(canonical.Locale)
+		if err != nil {
+			return model.Profile{}, invalid("locale %q is not a BCP 47 language tag", canonical.Locale)
+		}
+		canonical.Locale = tag.String()
+	}
+	if canonical.Timezone != "" {
+		if _, err := time.LoadLocation(canonical.Timezone); err != nil || canonical.Timezone == "Local" {
+			return model.Profile{}, invalid("timezone %q is not an IANA time zone", canonical.Timezone)
+		}
+	}
+	if canonical.AvatarURL != "" {
+		avatar, err := url.Parse(canonical.AvatarURL)
+		if err != nil || (avatar.Scheme != "https" && avatar.Scheme != "http") || avatar.Host == "" || len(canonical.AvatarURL) > maxAvatarURL {
+			return model.Profile{}, invalid("avatar_url must be an http(s) URL of at most %d characters", maxAvatarURL)
+		}
+	}
+
+	for name, value := range profile.Attributes {
+		if value == nil {
+			continue
+		}
+		// Values of attributes since dropped from the schema are kept as they are; CheckEditable stops new ones
+		if attribute, ok := s.attributes[name]; ok {
+			checked, err := attribute.check(value)
+			if err != nil {
+				return model.Profile{}, err
+			}
+			value = checked
+		}
+		if canonical.Attributes == nil {
+			canonical.Attributes = map[string]any{}
+		}
+		canonical.Attributes[name] = value
+	}
+	for _, attribute := range s.attributes {
+		if _, ok := canonical.Attributes[attribute.Name]; !ok && attribute.Required && editor.canEdit(attribute.Visibility) {
+			return model.Profile{}, invalid("attribute %q is required", attribute.Name)
+		}
+	}
+
+	return canonical, nil
+}
+
+// CheckEditable fails if the editor sets or clears a value they may not change.
+func (s *Schema) CheckEditable(attributes map[string]any, editor Viewer) error {
+	for name := range attributes {
+		attribute, ok := s.attributes[name]
+		if !ok {
+			return invalid("unknown attribute %q", name)
+		}
+		if !editor.canEdit(attribute.Visibility) {
+			return errs.ErrUnauthorized
+		}
+	}
+	return nil
+}
+
+// Visible returns the part of the profile the viewer may read. Attributes no longer in the schema
+// are only shown to admins.
+func (s *Schema) Visible(profile model.Profile, viewer Viewer) model.Profile {
+	visible := model.Profile{}
+	if viewer.canSee(fieldVisibility["display_name"]) {
+		visible.DisplayName = profile.DisplayName
+	}
+	if viewer.canSee(fieldVisibility["avatar_url"]) {
+		visible.AvatarURL = profile.AvatarURL
+	}
+	if viewer.canSee(fieldVisibility["locale"]) {
+		visible.Locale = profile.Locale
+	}
+	if viewer.canSee(fieldVisibility["timezone"]) {
+		visible.Timezone = profile.Timezone
+	}
+
+	for name, value := range profile.Attributes {
+		visibility := VisibilityAdmin
+		if attribute, ok := s.attributes[name]; ok {
+			visibility = attribute.Visibility
+		}
+		if !viewer.canSee(visibility) {
+			continue
+		}
+		if visible.Attributes == nil {
+			visible.Attributes = map[string]any{}
+		}
+		visible.Attributes[name] = value
+	}
+
+	return visible
+}
+
+// Helpers
+func (v Viewer) canEdit(visibility Visibility) bool {
+	return v == ViewerAdmin || (v == ViewerSelf && visibility != VisibilityAdmin)
+}
+
+func (a Attribute) check(value any) (any, error) {
+	switch a.Type {
+	case TypeNumber:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, invalid("attribute %q must be a number", a.Name)
+		}
+		return number, nil
+	case TypeBoolean:
+		boolean, ok := value.(bool)
+		if !ok {
+			return nil, invalid("attribute %q must be true or false", a.Name)
+		}
+		return boolean, nil
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return nil, invalid("attribute %q must be a string", a.Name)
+		}
+		text = strings.TrimSpace(text)
+		if len(text) > maxStringValue {
+			return nil, invalid("attribute %q is longer than %d characters", a.Name, maxStringValue)
+		}
+		if a.pattern != nil && !a.pattern.MatchString(text) {
+			return nil, invalid("attribute %q does not match %s", a.Name, a.Pattern)
+		}
+		return text, nil
+	}
+}
+
+func compile(attributes []Attribute) ([]Attribute, error) {
+	compiled := make([]Attribute, 0, len(attributes))
+	seen := map[string]bool{}
+	for _, attribute := range attributes {
+		if attribute.Name == "" || seen[attribute.Name] {
+			return nil, fmt.Errorf("profile schema: missing or repeated attribute name %q", attribute.Name)
+		}
+		seen[attribute.Name] = true
+
+		if attribute.Type == "" {
+			attribute.Type = TypeString
+		}
+		if attribute.Type != TypeString && attribute.Type != TypeNumber && attribute.Type != TypeBoolean {
+			return nil, fmt.Errorf("profile schema: attribute %q has unknown type %q", attribute.Name, attribute.Type)
+		}
+		if attribute.Visibility == "" {
+			attribute.Visibility = VisibilitySelf
+		}
+		if attribute.Visibility != VisibilitySelf && attribute.Visibility != VisibilityAdmin && attribute.Visibility != VisibilityPublic {
+			return nil, fmt.Errorf("profile schema: attribute %q has unknown visibility %q", attribute.Name, attribute.Visibility)
+		}
+		if attribute.Pattern != "" {
+			if attribute.Type != TypeString {
+				return nil, fmt.Errorf("profile schema: attribute %q has a pattern but isn't a string", attribute.Name)
+			}
+			pattern, err := regexp.Compile(`^(?:` + attribute.Pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("profile schema: attribute %q: %w", attribute.Name, err)
+			}
+			attribute.pattern = pattern
+		}
+		compiled = append(compiled, attribute)
+	}
+	return compiled, nil
+}
+
+func newSchema(attributes []Attribute) *Schema {
+	schema := &Schema{attributes: make(map[string]Attribute, len(attributes))}
+	for _, attribute := range attributes {
+		schema.attributes[attribute.Name] = attribute
+	}
+	return schema
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errs.ErrInvalidProfile, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/ddb"
+	dtos "github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+type AuditRepositoryDdb struct {
+	client    ddb.API
+	tableName string
+}
+
+func NewAuditRepositoryDdb(ddbClient ddb.API) *AuditRepositoryDdb {
+	return &AuditRepositoryDdb{
+		client:    ddbClient,
+		tableName: "audit_events",
+	}
+}
+
+func (ar *AuditRepositoryDdb) Record(ctx context.Context, event model.AuditEvent) error {
+	item, err := attributevalue.MarshalMap(dtos.AuditEventToDDB(event))
+	if err != nil {
+		return err
+	}
+
+	_, err = ar.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ar.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+func (ar *AuditRepositoryDdb) ListBySubject(ctx context.Context, subjectID uuid.UUID) ([]*model.AuditEvent, error) {
+	out, err := ar.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(ar.tableName),
+		IndexName:              aws.String("subject-index"),
+		KeyConditionExpression: aws.String("#subject_id = :subject_id"),
+		ExpressionAttributeNames: map[string]string{
+			"#subject_id": "subject_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":subject_id": &types.AttributeValueMemberS{Value: subjectID.String()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ddbEvents []dtos.AuditEventDDB
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &ddbEvents); err != nil {
+		return nil, err
+	}
+
+	eventsResp := make([]*model.AuditEvent, 0, len(ddbEvents))
+	for i := range ddbEvents {
+		e, convErr := dtos.AuditEventFromDDB(ddbEvents[i])
+		if convErr != nil {
+			return nil, convErr
+		}
+		event := e
+		eventsResp = append(eventsResp, &event)
+	}
+
+	return eventsResp, nil
+}
+
+// Scans the whole table, since only subjects are indexed; erasures are rare.
+func (ar *AuditRepositoryDdb) AnonymizeUser(ctx context.Context, userID uuid.UUID, replacement string) (int, error) {
+	changed := 0
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := ar.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String(ar.tableName),
+			FilterExpression: aws.String("#subject_id = :user_id OR #actor_id = :user_id"),
+			ExpressionAttributeNames: map[string]string{
+				"#subject_id": "subject_id",
+				"#actor_id":   "actor_id",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":user_id": &types.AttributeValueMemberS{Value: userID.String()},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return changed, err
+		}
+
+		var ddbEvents []dtos.AuditEventDDB
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &ddbEvents); err != nil {
+			return changed, err
+		}
+		for _, event := range ddbEvents {
+			names := map[string]string{}
+			setParts := []string{}
+			if event.ActorID == userID.String() {
+				names["#actor_email"] = "actor_email"
+				setParts = append(setParts, "#actor_email = :replacement")
+			}
+			if event.SubjectID == userID.String() {
+				names["#subject_email"] = "subject_email"
+				setParts = append(setParts, "#subject_email = :replacement")
+			}
+
+			_, err := ar.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(ar.tableName),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: event.ID},
+				},
+				UpdateExpression:         aws.String("SET " + strings.Join(setParts, ", ")),
+				ExpressionAttributeNames: names,
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":replacement": &types.AttributeValueMemberS{Value: replacement},
+				},
+			})
+			if err != nil {
+				return changed, err
+			}
+			changed++
+		}
+
+		if out.LastEvaluatedKey == nil {
+			return changed, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Safe for concurrent use. Events are copied out, so callers never share stored state.
+type AuditRepositoryInMemory struct {
+	mu   sync.RWMutex
+	data []model.AuditEvent
+}
+
+func NewAuditRepositoryInMemory() *AuditRepositoryInMemory {
+	return &AuditRepositoryInMemory{
+		data: make([]model.AuditEvent, 0),
+	}
+}
+
+func (ar *AuditRepositoryInMemory) Record(ctx context.Context, event model.AuditEvent) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	ar.data = append(ar.data, event)
+
+	return nil
+}
+
+func (ar *AuditRepositoryInMemory) ListBySubject(ctx context.Context, subjectID uuid.UUID) ([]*model.AuditEvent, error) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	eventsResp := make([]*model.AuditEvent, 0)
+	for _, event := range ar.data {
+		if event.SubjectID == subjectID {
+			eventsResp = append(eventsResp, &event)
+		}
+	}
+	return eventsResp, nil
+}
+
+func (ar *AuditRepositoryInMemory) AnonymizeUser(ctx context.Context, userID uuid.UUID, replacement string) (int, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	changed := 0
+	for i := range ar.data {
+		event := &ar.data[i]
+		if event.ActorID != userID && event.SubjectID != userID {
+			continue
+		}
+		if event.ActorID == userID {
+			event.ActorEmail = replacement
+		}
+		if event.SubjectID == userID {
+			event.SubjectEmail = replacement
+		}
+		changed++
+	}
+	return changed, nil
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/google/uuid"
+)
+
+type AuditRepository interface {
+	Record(ctx context.Context, event model.AuditEvent) error
+	ListBySubject(ctx context.Context, subjectID uuid.UUID) ([]*model.AuditEvent, error)
+	// Replaces the user's email in every event where they are actor or subject, and returns how many changed.
+	AnonymizeUser(ctx context.Context, userID uuid.UUID, replacement string) (int, error)
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/postgres/migrations and is applied by postgres.InitPostgres.
+type AuditRepositoryPostgres struct {
+	db *sql.DB
+}
+
+func NewAuditRepositoryPostgres(db *sql.DB) *AuditRepositoryPostgres {
+	return &AuditRepositoryPostgres{
+		db: db,
+	}
+}
+
+const auditColumns = "id, tenant_id, occurred_at, action, actor_id, actor_email, subject_id, subject_email, impersonated, detail"
+
+func (ar *AuditRepositoryPostgres) Record(ctx context.Context, event model.AuditEvent) error {
+	_, err := ar.db.ExecContext(ctx,
+		"INSERT INTO audit_events ("+auditColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		event.ID, event.TenantID, event.OccurredAt.UTC(), event.Action, event.ActorID, event.ActorEmail,
+		event.SubjectID, event.SubjectEmail, event.Impersonated, event.Detail,
+	)
+	return err
+}
+
+func (ar *AuditRepositoryPostgres) ListBySubject(ctx context.Context, subjectID uuid.UUID) ([]*model.AuditEvent, error) {
+	rows, err := ar.db.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_events WHERE subject_id = $1 ORDER BY occurred_at, id", subjectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventsResp := make([]*model.AuditEvent, 0)
+	for rows.Next() {
+		var event model.AuditEvent
+		err := rows.Scan(&event.ID, &event.TenantID, &event.OccurredAt, &event.Action, &event.ActorID, &event.ActorEmail,
+			&event.SubjectID, &event.SubjectEmail, &event.Impersonated, &event.Detail)
+		if err != nil {
+			return nil, err
+		}
+		event.OccurredAt = event.OccurredAt.UTC()
+		eventsResp = append(eventsResp, &event)
+	}
+	return eventsResp, rows.Err()
+}
+
+func (ar *AuditRepositoryPostgres) AnonymizeUser(ctx context.Context, userID uuid.UUID, replacement string) (int, error) {
+	res, err := ar.db.ExecContext(ctx, `
+		UPDATE audit_events SET
+			actor_email = CASE WHEN actor_id = $1 THEN $2 ELSE actor_email END,
+			subject_email = CASE WHEN subject_id = $1 THEN $2 ELSE subject_email END
+		WHERE actor_id = $1 OR subject_id = $1`,
+		userID, replacement,
+	)
+	if err != nil {
+		return 0, err
+	}
+	changed, err := res.RowsAffected()
+	return int(changed), err
+}
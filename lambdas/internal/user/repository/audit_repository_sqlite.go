@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/sqlite/migrations and is applied by sqlite.InitSQLite.
+type AuditRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewAuditRepositorySQLite(db *sql.DB) *AuditRepositorySQLite {
+	return &AuditRepositorySQLite{
+		db: db,
+	}
+}
+
+func (ar *AuditRepositorySQLite) Record(ctx context.Context, event model.AuditEvent) error {
+	_, err := ar.db.ExecContext(ctx,
+		"INSERT INTO audit_events ("+auditColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.ID.String(), event.TenantID.String(), formatSQLiteTime(event.OccurredAt), event.Action, event.ActorID.String(),
+		event.ActorEmail, event.SubjectID.String(), event.SubjectEmail, event.Impersonated, event.Detail,
+	)
+	return err
+}
+
+func (ar *AuditRepositorySQLite) ListBySubject(ctx context.Context, subjectID uuid.UUID) ([]*model.AuditEvent, error) {
+	rows, err := ar.db.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_events WHERE subject_id = ? ORDER BY occurred_at, id", subjectID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventsResp := make([]*model.AuditEvent, 0)
+	for rows.Next() {
+		event, err := scanSQLiteAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		eventsResp = append(eventsResp, event)
+	}
+	return eventsResp, rows.Err()
+}
+
+func (ar *AuditRepositorySQLite) AnonymizeUser(ctx context.Context, userID uuid.UUID, replacement string) (int, error) {
+	id := userID.String()
+	res, err := ar.db.ExecContext(ctx, `
+		UPDATE audit_events SET
+			actor_email = CASE WHEN actor_id = ? THEN ? ELSE actor_email END,
+			subject_email = CASE WHEN subject_id = ? THEN ? ELSE subject_email END
+		WHERE actor_id = ? OR subject_id = ?`,
+		id, replacement, id, replacement, id, id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	changed, err := res.RowsAffected()
+	return int(changed), err
+}
+
+// Helpers
+func scanSQLiteAuditEvent(row rowScanner) (*model.AuditEvent, error) {
+	var event model.AuditEvent
+	var id, tenantID, occurredAt, actorID, subjectID string
+	err := row.Scan(&id, &tenantID, &occurredAt, &event.Action, &actorID, &event.ActorEmail, &subjectID, &event.SubjectEmail,
+		&event.Impersonated, &event.Detail)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.ID, err = uuid.Parse(id); err != nil {
+		return nil, err
+	}
+	if event.TenantID, err = uuid.Parse(tenantID); err != nil {
+		return nil, err
+	}
+	if event.ActorID, err = uuid.Parse(actorID); err != nil {
+		return nil, err
+	}
+	if event.SubjectID, err = uuid.Parse(subjectID); err != nil {
+		return nil, err
+	}
+	if event.OccurredAt, err = time.Parse(sqliteTimeLayout, occurredAt); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
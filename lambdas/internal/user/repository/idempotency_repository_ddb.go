@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danilobml/user-manager/internal/ddb"
+	dtos "github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+type IdempotencyRepositoryDdb struct {
+	client    ddb.API
+	tableName string
+}
+
+func NewIdempotencyRepositoryDdb(ddbClient ddb.API) *IdempotencyRepositoryDdb {
+	return &IdempotencyRepositoryDdb{
+		client:    ddbClient,
+		tableName: "idempotency_keys",
+	}
+}
+
+// TTL deletion can lag by days, so expired items are overwritten as if they were gone.
+func (ir *IdempotencyRepositoryDdb) Reserve(ctx context.Context, record model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	item, err := attributevalue.MarshalMap(dtos.IdempotencyRecordToDDB(record))
+	if err != nil {
+		return nil, err
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	_, err = ir.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(ir.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR #expires_at < :now OR (#status_code = :running AND #locked_until < :now)"),
+		ExpressionAttributeNames: map[string]string{
+			"#key":          "key",
+			"#expires_at":   "expires_at",
+			"#status_code":  "status_code",
+			"#locked_until": "locked_until",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":     &types.AttributeValueMemberN{Value: now},
+			":running": &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &condErr) {
+		return nil, err
+	}
+
+	out, err := ir.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(ir.tableName),
+		Key:            ir.key(record.Key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Released in between; the retry is asked to try again rather than racing for the key here
+	if out.Item == nil {
+		return &model.IdempotencyRecord{Key: record.Key, RequestHash: record.RequestHash}, nil
+	}
+
+	var ddbRecord dtos.IdempotencyRecordDDB
+	if err := attributevalue.UnmarshalMap(out.Item, &ddbRecord); err != nil {
+		return nil, err
+	}
+	existing := dtos.IdempotencyRecordFromDDB(ddbRecord)
+
+	return &existing, nil
+}
+
+func (ir *IdempotencyRepositoryDdb) Complete(ctx context.Context, record model.IdempotencyRecord) error {
+	item, err := attributevalue.MarshalMap(dtos.IdempotencyRecordToDDB(record))
+	if err != nil {
+		return err
+	}
+
+	_, err = ir.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ir.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+func (ir *IdempotencyRepositoryDdb) Release(ctx context.Context, key string) error {
+	_, err := ir.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(ir.tableName),
+		Key:                 ir.key(key),
+		ConditionExpression: aws.String("#status_code = :running"),
+		ExpressionAttributeNames: map[string]string{
+			"#status_code": "status_code",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":running": &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return nil
+	}
+	return err
+}
+
+// Helper
+func (ir *IdempotencyRepositoryDdb) key(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"key": &types.AttributeValueMemberS{Value: key},
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+type IdempotencyRepositoryInMemory struct {
+	mu   sync.Mutex
+	data map[string]model.IdempotencyRecord
+}
+
+func NewIdempotencyRepositoryInMemory() *IdempotencyRepositoryInMemory {
+	return &IdempotencyRepositoryInMemory{
+		data: make(map[string]model.IdempotencyRecord),
+	}
+}
+
+func (ir *IdempotencyRepositoryInMemory) Reserve(ctx context.Context, record model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	now := time.Now()
+	// Expired records are dropped lazily, like DynamoDB's TTL
+	for key, stored := range ir.data {
+		if stored.ExpiresAt.Before(now) {
+			delete(ir.data, key)
+		}
+	}
+
+	if stored, ok := ir.data[record.Key]; ok && (stored.IsCompleted() || stored.LockedUntil.After(now)) {
+		existing := copyIdempotencyRecord(stored)
+		return &existing, nil
+	}
+	ir.data[record.Key] = copyIdempotencyRecord(record)
+
+	return nil, nil
+}
+
+func (ir *IdempotencyRepositoryInMemory) Complete(ctx context.Context, record model.IdempotencyRecord) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	ir.data[record.Key] = copyIdempotencyRecord(record)
+	return nil
+}
+
+func (ir *IdempotencyRepositoryInMemory) Release(ctx context.Context, key string) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	if stored, ok := ir.data[key]; ok && !stored.IsCompleted() {
+		delete(ir.data, key)
+	}
+	return nil
+}
+
+// Helper
+func copyIdempotencyRecord(record model.IdempotencyRecord) model.IdempotencyRecord {
+	record.Header = maps.Clone(record.Header)
+	record.Body = slices.Clone(record.Body)
+	return record
+}
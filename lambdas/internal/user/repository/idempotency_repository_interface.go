@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+type IdempotencyRepository interface {
+	// Stores the record unless the key is held by a live one, which is returned instead (nil when reserved).
+	Reserve(ctx context.Context, record model.IdempotencyRecord) (*model.IdempotencyRecord, error)
+	// Saves the response of a reserved key.
+	Complete(ctx context.Context, record model.IdempotencyRecord) error
+	// Frees a reserved key whose request failed, so a retry runs again.
+	Release(ctx context.Context, key string) error
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/postgres/migrations and is applied by postgres.InitPostgres.
+type IdempotencyRepositoryPostgres struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepositoryPostgres(db *sql.DB) *IdempotencyRepositoryPostgres {
+	return &IdempotencyRepositoryPostgres{
+		db: db,
+	}
+}
+
+const idempotencyColumns = "key, request_hash, status_code, header, body, locked_until, expires_at"
+
+// A stored record is taken over only when it expired or its request stopped holding the lock.
+func (ir *IdempotencyRepositoryPostgres) Reserve(ctx context.Context, record model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	// Expired records are dropped lazily, like DynamoDB's TTL
+	if _, err := ir.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < $1", now); err != nil {
+		return nil, err
+	}
+
+	// The existing record can vanish between the insert and the read, when its request is released
+	for range 3 {
+		var key string
+		err := ir.db.QueryRowContext(ctx, `
+			INSERT INTO idempotency_keys (`+idempotencyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (key) DO UPDATE SET
+				request_hash = EXCLUDED.request_hash,
+				status_code = EXCLUDED.status_code,
+				header = EXCLUDED.header,
+				body = EXCLUDED.body,
+				locked_until = EXCLUDED.locked_until,
+				expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at < $8
+				OR (idempotency_keys.status_code = 0 AND idempotency_keys.locked_until <= $8)
+			RETURNING key`,
+			record.Key, record.RequestHash, record.StatusCode, string(header), record.Body,
+			record.LockedUntil.UTC(), record.ExpiresAt.UTC(), now,
+		).Scan(&key)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		existing, err := ir.find(ctx, record.Key)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return existing, nil
+		}
+	}
+	return nil, errors.New("idempotency key kept changing while reserving it")
+}
+
+func (ir *IdempotencyRepositoryPostgres) Complete(ctx context.Context, record model.IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	_, err = ir.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (`+idempotencyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = EXCLUDED.status_code,
+			header = EXCLUDED.header,
+			body = EXCLUDED.body,
+			locked_until = EXCLUDED.locked_until,
+			expires_at = EXCLUDED.expires_at`,
+		record.Key, record.RequestHash, record.StatusCode, string(header), record.Body,
+		record.LockedUntil.UTC(), record.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+func (ir *IdempotencyRepositoryPostgres) Release(ctx context.Context, key string) error {
+	_, err := ir.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND status_code = 0", key)
+	return err
+}
+
+// Helpers
+func (ir *IdempotencyRepositoryPostgres) find(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	var record model.IdempotencyRecord
+	var header []byte
+	err := ir.db.QueryRowContext(ctx, "SELECT "+idempotencyColumns+" FROM idempotency_keys WHERE key = $1", key).Scan(
+		&record.Key, &record.RequestHash, &record.StatusCode, &header, &record.Body, &record.LockedUntil, &record.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(header, &record.Header); err != nil {
+		return nil, err
+	}
+	record.LockedUntil = record.LockedUntil.UTC()
+	record.ExpiresAt = record.ExpiresAt.UTC()
+	return &record, nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/sqlite/migrations and is applied by sqlite.InitSQLite.
+type IdempotencyRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepositorySQLite(db *sql.DB) *IdempotencyRepositorySQLite {
+	return &IdempotencyRepositorySQLite{
+		db: db,
+	}
+}
+
+// As in the Postgres repository, a stored record is taken over only when it expired or its request stopped holding the lock.
+func (ir *IdempotencyRepositorySQLite) Reserve(ctx context.Context, record model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return nil, err
+	}
+	now := formatSQLiteTime(time.Now())
+	// Expired records are dropped lazily, like DynamoDB's TTL
+	if _, err := ir.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < ?", now); err != nil {
+		return nil, err
+	}
+
+	// The existing record can vanish between the insert and the read, when its request is released
+	for range 3 {
+		var key string
+		err := ir.db.QueryRowContext(ctx, `
+			INSERT INTO idempotency_keys (`+idempotencyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET
+				request_hash = excluded.request_hash,
+				status_code = excluded.status_code,
+				header = excluded.header,
+				body = excluded.body,
+				locked_until = excluded.locked_until,
+				expires_at = excluded.expires_at
+			WHERE idempotency_keys.expires_at < ?
+				OR (idempotency_keys.status_code = 0 AND idempotency_keys.locked_until <= ?)
+			RETURNING key`,
+			record.Key, record.RequestHash, record.StatusCode, string(header), record.Body,
+			formatSQLiteTime(record.LockedUntil), formatSQLiteTime(record.ExpiresAt), now, now,
+		).Scan(&key)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		existing, err := ir.find(ctx, record.Key)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return existing, nil
+		}
+	}
+	return nil, errors.New("idempotency key kept changing while reserving it")
+}
+
+func (ir *IdempotencyRepositorySQLite) Complete(ctx context.Context, record model.IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	_, err = ir.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (`+idempotencyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = excluded.request_hash,
+			status_code = excluded.status_code,
+			header = excluded.header,
+			body = excluded.body,
+			locked_until = excluded.locked_until,
+			expires_at = excluded.expires_at`,
+		record.Key, record.RequestHash, record.StatusCode, string(header), record.Body,
+		formatSQLiteTime(record.LockedUntil), formatSQLiteTime(record.ExpiresAt),
+	)
+	return err
+}
+
+func (ir *IdempotencyRepositorySQLite) Release(ctx context.Context, key string) error {
+	_, err := ir.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = ? AND status_code = 0", key)
+	return err
+}
+
+// Helpers
+func (ir *IdempotencyRepositorySQLite) find(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	var record model.IdempotencyRecord
+	var header, lockedUntil, expiresAt string
+	err := ir.db.QueryRowContext(ctx, "SELECT "+idempotencyColumns+" FROM idempotency_keys WHERE key = ?", key).Scan(
+		&record.Key, &record.RequestHash, &record.StatusCode, &header, &record.Body, &lockedUntil, &expiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(header), &record.Header); err != nil {
+		return nil, err
+	}
+	if record.LockedUntil, err = time.Parse(sqliteTimeLayout, lockedUntil); err != nil {
+		return nil, err
+	}
+	if record.ExpiresAt, err = time.Parse(sqliteTimeLayout, expiresAt); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
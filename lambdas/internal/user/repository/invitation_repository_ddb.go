@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/ddb"
+	dtos "github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+type InvitationRepositoryDdb struct {
+	client    ddb.API
+	tableName string
+}
+
+func NewInvitationRepositoryDdb(ddbClient ddb.API) *InvitationRepositoryDdb {
+	return &InvitationRepositoryDdb{
+		client:    ddbClient,
+		tableName: "invitations",
+	}
+}
+
+func (ir *InvitationRepositoryDdb) List(ctx context.Context, tenantID uuid.UUID) ([]*model.Invitation, error) {
+	out, err := ir.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(ir.tableName),
+		FilterExpression: aws.String("#tenant_id = :tenant_id"),
+		ExpressionAttributeNames: map[string]string{
+			"#tenant_id": "tenant_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tenant_id": &types.AttributeValueMemberS{Value: tenantID.String()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ddbInvitations []dtos.InvitationDDB
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &ddbInvitations); err != nil {
+		return nil, err
+	}
+
+	invitationsResp := make([]*model.Invitation, 0, len(ddbInvitations))
+	for i := range ddbInvitations {
+		inv, convErr := dtos.InvitationFromDDB(ddbInvitations[i])
+		if convErr != nil {
+			return nil, convErr
+		}
+		invitation := inv
+		invitationsResp = append(invitationsResp, &invitation)
+	}
+
+	return invitationsResp, nil
+}
+
+func (ir *InvitationRepositoryDdb) FindById(ctx context.Context, id uuid.UUID) (*model.Invitation, error) {
+	out, err := ir.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(ir.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id.String()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Item == nil {
+		return nil, nil
+	}
+
+	var ddbInvitation dtos.InvitationDDB
+	if err := attributevalue.UnmarshalMap(out.Item, &ddbInvitation); err != nil {
+		return nil, err
+	}
+	inv, convErr := dtos.InvitationFromDDB(ddbInvitation)
+	if convErr != nil {
+		return nil, convErr
+	}
+
+	return &inv, nil
+}
+
+func (ir *InvitationRepositoryDdb) Create(ctx context.Context, invitation model.Invitation) error {
+	item, err := attributevalue.MarshalMap(dtos.InvitationToDDB(invitation))
+	if err != nil {
+		return err
+	}
+
+	_, err = ir.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(ir.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": "id",
+		},
+	})
+	return err
+}
+
+func (ir *InvitationRepositoryDdb) Update(ctx context.Context, invitation model.Invitation) error {
+	av, err := attributevalue.MarshalMap(dtos.InvitationToDDB(invitation))
+	if err != nil {
+		return fmt.Errorf("failed to marshal invitation: %w", err)
+	}
+
+	_, err = ir.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(ir.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: invitation.ID.String()},
+		},
+		UpdateExpression:    aws.String("SET #roles=:roles, #status=:status, #expires_at=:expires_at"),
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id":         "id",
+			"#roles":      "roles",
+			"#status":     "status",
+			"#expires_at": "expires_at",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":roles":      av["roles"],
+			":status":     av["status"],
+			":expires_at": av["expires_at"],
+		},
+	})
+	return err
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Safe for concurrent use. Invitations are copied in and out, so callers never share stored state.
+// List returns them in the order they were created.
+type InvitationRepositoryInMemory struct {
+	mu    sync.RWMutex
+	byID  map[uuid.UUID]model.Invitation
+	order []uuid.UUID
+}
+
+func NewInvitationRepositoryInMemory() *InvitationRepositoryInMemory {
+	return &InvitationRepositoryInMemory{
+		byID: make(map[uuid.UUID]model.Invitation),
+	}
+}
+
+func (ir *InvitationRepositoryInMemory) List(ctx context.Context, tenantID uuid.UUID) ([]*model.Invitation, error) {
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+
+	invitationsResp := make([]*model.Invitation, 0)
+	for _, id := range ir.order {
+		invitation := ir.byID[id]
+		if invitation.TenantID != tenantID {
+			continue
+		}
+		invitationsResp = append(invitationsResp, copyInvitation(invitation))
+	}
+	return invitationsResp, nil
+}
+
+func (ir *InvitationRepositoryInMemory) FindById(ctx context.Context, id uuid.UUID) (*model.Invitation, error) {
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+
+	invitation, ok := ir.byID[id]
+	if !ok {
+		return nil, errs.ErrNotFound
+	}
+	return copyInvitation(invitation), nil
+}
+
+func (ir *InvitationRepositoryInMemory) Create(ctx context.Context, invitation model.Invitation) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	if _, ok := ir.byID[invitation.ID]; ok {
+		return errs.ErrAlreadyExists
+	}
+
+	ir.byID[invitation.ID] = *copyInvitation(invitation)
+	ir.order = append(ir.order, invitation.ID)
+
+	return nil
+}
+
+func (ir *InvitationRepositoryInMemory) Update(ctx context.Context, invitation model.Invitation) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	existingInvitation, ok := ir.byID[invitation.ID]
+	if !ok {
+		return errs.ErrNotFound
+	}
+
+	existingInvitation.Roles = slices.Clone(invitation.Roles)
+	existingInvitation.Status = invitation.Status
+	existingInvitation.ExpiresAt = invitation.ExpiresAt
+	ir.byID[invitation.ID] = existingInvitation
+
+	return nil
+}
+
+// Helpers
+func copyInvitation(invitation model.Invitation) *model.Invitation {
+	invitation.Roles = slices.Clone(invitation.Roles)
+	return &invitation
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/google/uuid"
+)
+
+type InvitationRepository interface {
+	List(ctx context.Context, tenantID uuid.UUID) ([]*model.Invitation, error)
+	FindById(ctx context.Context, id uuid.UUID) (*model.Invitation, error)
+	Create(ctx context.Context, invitation model.Invitation) error
+	Update(ctx context.Context, invitation model.Invitation) error
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/postgres/migrations and is applied by postgres.InitPostgres.
+type InvitationRepositoryPostgres struct {
+	db      *sql.DB
+	typeMap *pgtype.Map
+}
+
+func NewInvitationRepositoryPostgres(db *sql.DB) *InvitationRepositoryPostgres {
+	return &InvitationRepositoryPostgres{
+		db:      db,
+		typeMap: pgtype.NewMap(),
+	}
+}
+
+const invitationColumns = "id, tenant_id, email, roles, status, invited_by, expires_at"
+
+func (ir *InvitationRepositoryPostgres) List(ctx context.Context, tenantID uuid.UUID) ([]*model.Invitation, error) {
+	rows, err := ir.db.QueryContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE tenant_id = $1 ORDER BY expires_at, id", tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitationsResp := make([]*model.Invitation, 0)
+	for rows.Next() {
+		invitation, err := ir.scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitationsResp = append(invitationsResp, invitation)
+	}
+	return invitationsResp, rows.Err()
+}
+
+func (ir *InvitationRepositoryPostgres) FindById(ctx context.Context, id uuid.UUID) (*model.Invitation, error) {
+	row := ir.db.QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE id = $1", id)
+	invitation, err := ir.scanInvitation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return invitation, err
+}
+
+func (ir *InvitationRepositoryPostgres) Create(ctx context.Context, invitation model.Invitation) error {
+	_, err := ir.db.ExecContext(ctx,
+		"INSERT INTO invitations ("+invitationColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		invitation.ID, invitation.TenantID, invitation.Email, helpers.GetRoleNames(invitation.Roles), string(invitation.Status),
+		invitation.InvitedBy, invitation.ExpiresAt.UTC(),
+	)
+	if isUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	return err
+}
+
+// Only roles, status and expiry change, as in the DynamoDB repository.
+func (ir *InvitationRepositoryPostgres) Update(ctx context.Context, invitation model.Invitation) error {
+	res, err := ir.db.ExecContext(ctx,
+		"UPDATE invitations SET roles = $1, status = $2, expires_at = $3 WHERE id = $4",
+		helpers.GetRoleNames(invitation.Roles), string(invitation.Status), invitation.ExpiresAt.UTC(), invitation.ID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// Helpers
+func (ir *InvitationRepositoryPostgres) scanInvitation(row rowScanner) (*model.Invitation, error) {
+	var invitation model.Invitation
+	var roleNames []string
+	var status string
+	err := row.Scan(&invitation.ID, &invitation.TenantID, &invitation.Email, ir.typeMap.SQLScanner(&roleNames), &status,
+		&invitation.InvitedBy, &invitation.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Status = model.InvitationStatus(status)
+	invitation.ExpiresAt = invitation.ExpiresAt.UTC()
+	if invitation.Roles, err = parseRoleNames(roleNames); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/sqlite/migrations and is applied by sqlite.InitSQLite.
+type InvitationRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewInvitationRepositorySQLite(db *sql.DB) *InvitationRepositorySQLite {
+	return &InvitationRepositorySQLite{
+		db: db,
+	}
+}
+
+func (ir *InvitationRepositorySQLite) List(ctx context.Context, tenantID uuid.UUID) ([]*model.Invitation, error) {
+	rows, err := ir.db.QueryContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE tenant_id = ? ORDER BY expires_at, id", tenantID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitationsResp := make([]*model.Invitation, 0)
+	for rows.Next() {
+		invitation, err := scanSQLiteInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitationsResp = append(invitationsResp, invitation)
+	}
+	return invitationsResp, rows.Err()
+}
+
+func (ir *InvitationRepositorySQLite) FindById(ctx context.Context, id uuid.UUID) (*model.Invitation, error) {
+	invitation, err := scanSQLiteInvitation(ir.db.QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE id = ?", id.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return invitation, err
+}
+
+func (ir *InvitationRepositorySQLite) Create(ctx context.Context, invitation model.Invitation) error {
+	roles, err := json.Marshal(helpers.GetRoleNames(invitation.Roles))
+	if err != nil {
+		return err
+	}
+	_, err = ir.db.ExecContext(ctx,
+		"INSERT INTO invitations ("+invitationColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		invitation.ID.String(), invitation.TenantID.String(), invitation.Email, string(roles), string(invitation.Status),
+		invitation.InvitedBy, formatSQLiteTime(invitation.ExpiresAt),
+	)
+	if isSQLiteUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	return err
+}
+
+// Only roles, status and expiry change, as in the DynamoDB repository.
+func (ir *InvitationRepositorySQLite) Update(ctx context.Context, invitation model.Invitation) error {
+	roles, err := json.Marshal(helpers.GetRoleNames(invitation.Roles))
+	if err != nil {
+		return err
+	}
+	res, err := ir.db.ExecContext(ctx,
+		"UPDATE invitations SET roles = ?, status = ?, expires_at = ? WHERE id = ?",
+		string(roles), string(invitation.Status), formatSQLiteTime(invitation.ExpiresAt), invitation.ID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// Helpers
+func scanSQLiteInvitation(row rowScanner) (*model.Invitation, error) {
+	var invitation model.Invitation
+	var id, tenantID, roles, status, expiresAt string
+	err := row.Scan(&id, &tenantID, &invitation.Email, &roles, &status, &invitation.InvitedBy, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation.ID, err = uuid.Parse(id); err != nil {
+		return nil, err
+	}
+	if invitation.TenantID, err = uuid.Parse(tenantID); err != nil {
+		return nil, err
+	}
+	if invitation.ExpiresAt, err = time.Parse(sqliteTimeLayout, expiresAt); err != nil {
+		return nil, err
+	}
+	invitation.Status = model.InvitationStatus(status)
+
+	var roleNames []string
+	if err := json.Unmarshal([]byte(roles), &roleNames); err != nil {
+		return nil, err
+	}
+	if invitation.Roles, err = parseRoleNames(roleNames); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/ddb"
+	dtos "github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+type OrganizationRepositoryDdb struct {
+	client    ddb.API
+	tableName string
+}
+
+func NewOrganizationRepositoryDdb(ddbClient ddb.API) *OrganizationRepositoryDdb {
+	return &OrganizationRepositoryDdb{
+		client:    ddbClient,
+		tableName: "organizations",
+	}
+}
+
+func (or *OrganizationRepositoryDdb) List(ctx context.Context) ([]*model.Organization, error) {
+	out, err := or.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName: aws.String(or.tableName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ddbOrgs []dtos.OrganizationDDB
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &ddbOrgs); err != nil {
+		return nil, err
+	}
+
+	orgsResp := make([]*model.Organization, 0, len(ddbOrgs))
+	for i := range ddbOrgs {
+		o, convErr := dtos.OrganizationFromDDB(ddbOrgs[i])
+		if convErr != nil {
+			return nil, convErr
+		}
+		org := o
+		orgsResp = append(orgsResp, &org)
+	}
+
+	return orgsResp, nil
+}
+
+func (or *OrganizationRepositoryDdb) FindById(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	out, err := or.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(or.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id.String()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Item == nil {
+		return nil, nil
+	}
+
+	var ddbOrg dtos.OrganizationDDB
+	if err := attributevalue.UnmarshalMap(out.Item, &ddbOrg); err != nil {
+		return nil, err
+	}
+	o, convErr := dtos.OrganizationFromDDB(ddbOrg)
+	if convErr != nil {
+		return nil, convErr
+	}
+
+	return &o, nil
+}
+
+func (or *OrganizationRepositoryDdb) Create(ctx context.Context, organization model.Organization) error {
+	item, err := attributevalue.MarshalMap(dtos.OrganizationToDDB(organization))
+	if err != nil {
+		return err
+	}
+
+	_, err = or.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(or.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": "id",
+		},
+	})
+	return err
+}
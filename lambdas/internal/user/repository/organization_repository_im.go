@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Safe for concurrent use. Organizations are copied in and out, so callers never share stored state.
+// List returns them in the order they were created.
+type OrganizationRepositoryInMemory struct {
+	mu    sync.RWMutex
+	byID  map[uuid.UUID]model.Organization
+	order []uuid.UUID
+}
+
+func NewOrganizationRepositoryInMemory() *OrganizationRepositoryInMemory {
+	return &OrganizationRepositoryInMemory{
+		byID: make(map[uuid.UUID]model.Organization),
+	}
+}
+
+func (or *OrganizationRepositoryInMemory) List(ctx context.Context) ([]*model.Organization, error) {
+	or.mu.RLock()
+	defer or.mu.RUnlock()
+
+	orgsResp := make([]*model.Organization, 0, len(or.order))
+	for _, id := range or.order {
+		organization := or.byID[id]
+		orgsResp = append(orgsResp, &organization)
+	}
+	return orgsResp, nil
+}
+
+func (or *OrganizationRepositoryInMemory) FindById(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	or.mu.RLock()
+	defer or.mu.RUnlock()
+
+	organization, ok := or.byID[id]
+	if !ok {
+		return nil, errs.ErrNotFound
+	}
+	return &organization, nil
+}
+
+func (or *OrganizationRepositoryInMemory) Create(ctx context.Context, organization model.Organization) error {
+	or.mu.Lock()
+	defer or.mu.Unlock()
+
+	if _, ok := or.byID[organization.ID]; ok {
+		return errs.ErrAlreadyExists
+	}
+
+	or.byID[organization.ID] = organization
+	or.order = append(or.order, organization.ID)
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/google/uuid"
+)
+
+type OrganizationRepository interface {
+	List(ctx context.Context) ([]*model.Organization, error)
+	FindById(ctx context.Context, id uuid.UUID) (*model.Organization, error)
+	Create(ctx context.Context, organization model.Organization) error
+}
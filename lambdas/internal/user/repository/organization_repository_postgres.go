@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/postgres/migrations and is applied by postgres.InitPostgres.
+type OrganizationRepositoryPostgres struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepositoryPostgres(db *sql.DB) *OrganizationRepositoryPostgres {
+	return &OrganizationRepositoryPostgres{
+		db: db,
+	}
+}
+
+func (or *OrganizationRepositoryPostgres) List(ctx context.Context) ([]*model.Organization, error) {
+	rows, err := or.db.QueryContext(ctx, "SELECT id, name FROM organizations ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgsResp := make([]*model.Organization, 0)
+	for rows.Next() {
+		var organization model.Organization
+		if err := rows.Scan(&organization.ID, &organization.Name); err != nil {
+			return nil, err
+		}
+		orgsResp = append(orgsResp, &organization)
+	}
+	return orgsResp, rows.Err()
+}
+
+func (or *OrganizationRepositoryPostgres) FindById(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	var organization model.Organization
+	err := or.db.QueryRowContext(ctx, "SELECT id, name FROM organizations WHERE id = $1", id).Scan(&organization.ID, &organization.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (or *OrganizationRepositoryPostgres) Create(ctx context.Context, organization model.Organization) error {
+	_, err := or.db.ExecContext(ctx, "INSERT INTO organizations (id, name) VALUES ($1, $2)", organization.ID, organization.Name)
+	if isUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	return err
+}
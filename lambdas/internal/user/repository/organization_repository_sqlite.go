@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/sqlite/migrations and is applied by sqlite.InitSQLite.
+type OrganizationRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepositorySQLite(db *sql.DB) *OrganizationRepositorySQLite {
+	return &OrganizationRepositorySQLite{
+		db: db,
+	}
+}
+
+func (or *OrganizationRepositorySQLite) List(ctx context.Context) ([]*model.Organization, error) {
+	rows, err := or.db.QueryContext(ctx, "SELECT id, name FROM organizations ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgsResp := make([]*model.Organization, 0)
+	for rows.Next() {
+		organization, err := scanSQLiteOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgsResp = append(orgsResp, organization)
+	}
+	return orgsResp, rows.Err()
+}
+
+func (or *OrganizationRepositorySQLite) FindById(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	organization, err := scanSQLiteOrganization(or.db.QueryRowContext(ctx, "SELECT id, name FROM organizations WHERE id = ?", id.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return organization, err
+}
+
+func (or *OrganizationRepositorySQLite) Create(ctx context.Context, organization model.Organization) error {
+	_, err := or.db.ExecContext(ctx, "INSERT INTO organizations (id, name) VALUES (?, ?)", organization.ID.String(), organization.Name)
+	if isSQLiteUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	return err
+}
+
+// Helpers
+func scanSQLiteOrganization(row rowScanner) (*model.Organization, error) {
+	var organization model.Organization
+	var id string
+	if err := row.Scan(&id, &organization.Name); err != nil {
+		return nil, err
+	}
+	var err error
+	if organization.ID, err = uuid.Parse(id); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
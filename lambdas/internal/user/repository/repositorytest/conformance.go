@@ -0,0 +1,656 @@
+// Package repositorytest holds the behavior every repository.UserRepository must share,
+// so backends can't drift apart on not-found, uniqueness or paging semantics.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+	"github.com/google/uuid"
+)
+
+// RunUserRepository runs the suite. newRepo must return an empty repository on each call.
+func RunUserRepository(t *testing.T, newRepo func(t *testing.T) repository.UserRepository) {
+	t.Run("CreateAndFind", func(t *testing.T) { testCreateAndFind(t, newRepo(t)) })
+	t.Run("MissingUsers", func(t *testing.T) { testMissingUsers(t, newRepo(t)) })
+	t.Run("EmailUniqueness", func(t *testing.T) { testEmailUniqueness(t, newRepo(t)) })
+	t.Run("EmailKeys", func(t *testing.T) { testEmailKeys(t, newRepo(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newRepo(t)) })
+	t.Run("Versioning", func(t *testing.T) { testVersioning(t, newRepo(t)) })
+	t.Run("Timestamps", func(t *testing.T) { testTimestamps(t, newRepo(t)) })
+	t.Run("Deactivation", func(t *testing.T) { testDeactivation(t, newRepo(t)) })
+	t.Run("Profile", func(t *testing.T) { testProfile(t, newRepo(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newRepo(t)) })
+	t.Run("ReturnedUsersAreCopies", func(t *testing.T) { testReturnedUsersAreCopies(t, newRepo(t)) })
+	t.Run("ListFiltersAndSorts", func(t *testing.T) { testListFiltersAndSorts(t, newRepo(t)) })
+	t.Run("ListPaginates", func(t *testing.T) { testListPaginates(t, newRepo(t)) })
+	t.Run("ListFiltersByActivity", func(t *testing.T) { testListFiltersByActivity(t, newRepo(t)) })
+}
+
+// Every backend stores at least microsecond precision.
+var baseTime = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newUser(tenantID uuid.UUID, email string, createdOffset time.Duration) model.User {
+	return model.User{
+		ID:             uuid.New(),
+		TenantID:       tenantID,
+		Email:          email,
+		HashedPassword: "hashed-" + email,
+		Roles:          []model.Role{model.AppUser},
+		IsActive:       true,
+		CreatedAt:      baseTime.Add(createdOffset),
+		Version:        1,
+	}
+}
+
+func mustCreate(t *testing.T, repo repository.UserRepository, users ...model.User) {
+	t.Helper()
+	for _, u := range users {
+		if err := repo.Create(context.Background(), u); err != nil {
+			t.Fatalf("create %s: %v", u.Email, err)
+		}
+	}
+}
+
+func assertSameUser(t *testing.T, got *model.User, want model.User) {
+	t.Helper()
+	if got == nil {
+		t.Fatalf("expected user %s, got nil", want.Email)
+	}
+	if got.ID != want.ID || got.TenantID != want.TenantID || got.Email != want.Email ||
+		got.HashedPassword != want.HashedPassword || got.IsActive != want.IsActive || got.IsVerified != want.IsVerified ||
+		!slices.Equal(got.Roles, want.Roles) || !got.CreatedAt.Equal(want.CreatedAt) || got.Version != want.Version ||
+		!got.LastLoginAt.Equal(want.LastLoginAt) || !got.PasswordChangedAt.Equal(want.PasswordChangedAt) {
+		t.Fatalf("user mismatch:\n got  %+v\n want %+v", *got, want)
+	}
+}
+
+func emails(users []*model.User) []string {
+	out := make([]string, 0, len(users))
+	for _, u := range users {
+		out = append(out, u.Email)
+	}
+	return out
+}
+
+func testCreateAndFind(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(uuid.New(), "find@example.com", 0)
+	user.Roles = []model.Role{model.AppUser, model.Support}
+	user.IsVerified = true
+	mustCreate(t, repo, user)
+
+	byID, err := repo.FindById(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("find by id: %v", err)
+	}
+	assertSameUser(t, byID, user)
+
+	byEmail, err := repo.FindByEmail(ctx, user.TenantID, user.Email)
+	if err != nil {
+		t.Fatalf("find by email: %v", err)
+	}
+	assertSameUser(t, byEmail, user)
+}
+
+func testMissingUsers(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(uuid.New(), "present@example.com", 0)
+	mustCreate(t, repo, user)
+
+	byID, err := repo.FindById(ctx, uuid.New())
+	if byID != nil || err != nil {
+		t.Fatalf("FindById on a missing user: expected nil, nil; got %+v, %v", byID, err)
+	}
+	byEmail, err := repo.FindByEmail(ctx, user.TenantID, "absent@example.com")
+	if byEmail != nil || err != nil {
+		t.Fatalf("FindByEmail on a missing user: expected nil, nil; got %+v, %v", byEmail, err)
+	}
+	otherTenant, err := repo.FindByEmail(ctx, uuid.New(), user.Email)
+	if otherTenant != nil || err != nil {
+		t.Fatalf("FindByEmail in another tenant: expected nil, nil; got %+v, %v", otherTenant, err)
+	}
+}
+
+func testEmailUniqueness(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	tenantID := uuid.New()
+	user := newUser(tenantID, "taken@example.com", 0)
+	mustCreate(t, repo, user)
+
+	dup := newUser(tenantID, user.Email, time.Second)
+	if err := repo.Create(ctx, dup); !errors.Is(err, errs.ErrAlreadyExists) {
+		t.Fatalf("duplicate email in tenant: expected ErrAlreadyExists, got %v", err)
+	}
+	if found, _ := repo.FindById(ctx, dup.ID); found != nil {
+		t.Fatalf("rejected duplicate was stored: %+v", found)
+	}
+
+	mustCreate(t, repo, newUser(uuid.New(), user.Email, 0))
+
+	sameID := newUser(tenantID, "other@example.com", 0)
+	sameID.ID = user.ID
+	if err := repo.Create(ctx, sameID); !errors.Is(err, errs.ErrAlreadyExists) {
+		t.Fatalf("duplicate id: expected ErrAlreadyExists, got %v", err)
+	}
+}
+
+// Lookups and uniqueness go by EmailKey, while Email keeps the address as typed.
+func testEmailKeys(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	tenantID := uuid.New()
+	user := newUser(tenantID, "Alice@Example.com", 0)
+	user.EmailKey = "alice@example.com"
+	mustCreate(t, repo, user)
+
+	found, err := repo.FindByEmail(ctx, tenantID, "alice@example.com")
+	if err != nil || found == nil || found.Email != "Alice@Example.com" || found.EmailKey != "alice@example.com" {
+		t.Fatalf("find by key: got %+v, %v", found, err)
+	}
+	if byDisplay, _ := repo.FindByEmail(ctx, tenantID, "Alice@Example.com"); byDisplay != nil {
+		t.Fatalf("lookups must use the key, found %+v by display email", byDisplay)
+	}
+
+	dup := newUser(tenantID, "ALICE@example.com", time.Second)
+	dup.EmailKey = "alice@example.com"
+	if err := repo.Create(ctx, dup); !errors.Is(err, errs.ErrAlreadyExists) {
+		t.Fatalf("same key, different display email: expected ErrAlreadyExists, got %v", err)
+	}
+
+	// Changing only the display email keeps the key
+	recased := *found
+	recased.Email = "alice@example.com"
+	if err := repo.Update(ctx, recased); err != nil {
+		t.Fatalf("update display email: %v", err)
+	}
+	found, _ = repo.FindByEmail(ctx, tenantID, "alice@example.com")
+	if found == nil || found.Email != "alice@example.com" {
+		t.Fatalf("expected the new display email, got %+v", found)
+	}
+
+	// An update without a key, e.g. a password reset, leaves the stored key alone
+	unkeyed := *found
+	unkeyed.Email = "Alice@Example.com"
+	unkeyed.EmailKey = ""
+	if err := repo.Update(ctx, unkeyed); err != nil {
+		t.Fatalf("update without a key: %v", err)
+	}
+	found, _ = repo.FindByEmail(ctx, tenantID, "alice@example.com")
+	if found == nil || found.EmailKey != "alice@example.com" {
+		t.Fatalf("expected the stored key kept, got %+v", found)
+	}
+
+	moved := *found
+	moved.Email = "Alice@New.com"
+	moved.EmailKey = "alice@new.com"
+	if err := repo.Update(ctx, moved); err != nil {
+		t.Fatalf("update key: %v", err)
+	}
+	if old, _ := repo.FindByEmail(ctx, tenantID, "alice@example.com"); old != nil {
+		t.Fatalf("old key still resolves to %+v", old)
+	}
+	mustCreate(t, repo, dup)
+}
+
+func testUpdate(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	tenantID := uuid.New()
+	user := newUser(tenantID, "before@example.com", 0)
+	other := newUser(tenantID, "other@example.com", time.Second)
+	mustCreate(t, repo, user, other)
+
+	if err := repo.Update(ctx, newUser(tenantID, "ghost@example.com", 0)); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("updating a missing user: expected ErrNotFound, got %v", err)
+	}
+
+	updated := user
+	updated.Email = "after@example.com"
+	updated.EmailKey = "after@example.com"
+	updated.HashedPassword = "new-hash"
+	updated.Roles = []model.Role{model.Admin}
+	updated.IsActive = false
+	updated.IsVerified = true
+	if err := repo.Update(ctx, updated); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	updated.Version++
+	found, _ := repo.FindById(ctx, user.ID)
+	assertSameUser(t, found, updated)
+
+	// The old email is free again, the new one is taken
+	if old, _ := repo.FindByEmail(ctx, tenantID, "before@example.com"); old != nil {
+		t.Fatalf("old email still resolves to %+v", old)
+	}
+	mustCreate(t, repo, newUser(tenantID, "before@example.com", 2*time.Second))
+
+	clash := updated
+	clash.Email = other.Email
+	clash.EmailKey = other.Email
+	if err := repo.Update(ctx, clash); !errors.Is(err, errs.ErrAlreadyExists) {
+		t.Fatalf("moving to a taken email: expected ErrAlreadyExists, got %v", err)
+	}
+	found, _ = repo.FindById(ctx, user.ID)
+	assertSameUser(t, found, updated)
+
+	// An empty email keeps the stored one
+	keep := updated
+	keep.Email = ""
+	keep.IsActive = true
+	if err := repo.Update(ctx, keep); err != nil {
+		t.Fatalf("update without email: %v", err)
+	}
+	found, _ = repo.FindById(ctx, user.ID)
+	if found.Email != updated.Email || !found.IsActive {
+		t.Fatalf("expected email kept and user reactivated, got %+v", found)
+	}
+}
+
+func testVersioning(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(uuid.New(), "versioned@example.com", 0)
+	user.Version = 42
+	mustCreate(t, repo, user)
+
+	found, _ := repo.FindById(ctx, user.ID)
+	if found.Version != 1 {
+		t.Fatalf("expected a created user at version 1, got %d", found.Version)
+	}
+
+	first := *found
+	first.IsVerified = true
+	if err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	found, _ = repo.FindById(ctx, user.ID)
+	if found.Version != 2 {
+		t.Fatalf("expected version 2 after an update, got %d", found.Version)
+	}
+
+	// A writer still holding version 1 lost the race
+	stale := first
+	stale.Email = "stale@example.com"
+	stale.IsActive = false
+	if err := repo.Update(ctx, stale); !errors.Is(err, errs.ErrConflict) {
+		t.Fatalf("stale update: expected ErrConflict, got %v", err)
+	}
+	found, _ = repo.FindById(ctx, user.ID)
+	if found.Version != 2 || found.Email != user.Email || !found.IsActive {
+		t.Fatalf("stale update was applied: %+v", found)
+	}
+	if taken, _ := repo.FindByEmail(ctx, user.TenantID, "stale@example.com"); taken != nil {
+		t.Fatalf("stale update claimed its email: %+v", taken)
+	}
+
+	if err := repo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := repo.Update(ctx, *found); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("updating a deleted user: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testTimestamps(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Microsecond)
+	user := newUser(uuid.New(), "stamped@example.com", 0)
+	user.PasswordChangedAt = baseTime
+	mustCreate(t, repo, user)
+
+	found, _ := repo.FindById(ctx, user.ID)
+	if found.UpdatedAt.Before(start) || !found.LastLoginAt.IsZero() || !found.PasswordChangedAt.Equal(baseTime) {
+		t.Fatalf("unexpected timestamps after create: %+v", found)
+	}
+	created := found.UpdatedAt
+
+	changed := *found
+	changed.PasswordChangedAt = baseTime.Add(time.Hour)
+	if err := repo.Update(ctx, changed); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	found, _ = repo.FindById(ctx, user.ID)
+	if found.UpdatedAt.Before(created) || !found.PasswordChangedAt.Equal(changed.PasswordChangedAt) {
+		t.Fatalf("unexpected timestamps after update: %+v", found)
+	}
+
+	// A login is not a change
+	loginAt := baseTime.Add(2 * time.Hour)
+	if err := repo.RecordLogin(ctx, user.ID, loginAt); err != nil {
+		t.Fatalf("record login: %v", err)
+	}
+	loggedIn, _ := repo.FindById(ctx, user.ID)
+	if !loggedIn.LastLoginAt.Equal(loginAt) || loggedIn.Version != found.Version || !loggedIn.UpdatedAt.Equal(found.UpdatedAt) {
+		t.Fatalf("record login changed more than the login time: before %+v, after %+v", found, loggedIn)
+	}
+
+	// Updates keep the last login and an unset password time keeps the stored one
+	again := *loggedIn
+	again.LastLoginAt = time.Time{}
+	again.PasswordChangedAt = time.Time{}
+	if err := repo.Update(ctx, again); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	found, _ = repo.FindById(ctx, user.ID)
+	if !found.LastLoginAt.Equal(loginAt) || !found.PasswordChangedAt.Equal(changed.PasswordChangedAt) {
+		t.Fatalf("update dropped timestamps: %+v", found)
+	}
+
+	if err := repo.RecordLogin(ctx, uuid.New(), loginAt); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("recording a login for a missing user: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testDeactivation(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Microsecond)
+	active := newUser(uuid.New(), "active@example.com", 0)
+	leaving := newUser(uuid.New(), "leaving@example.com", 0)
+	// Given times are kept, so old deactivations can be set up directly
+	longGone := newUser(uuid.New(), "gone@example.com", 0)
+	longGone.IsActive = false
+	longGone.DeactivatedAt = baseTime
+	mustCreate(t, repo, active, leaving, longGone)
+
+	if found, _ := repo.FindById(ctx, active.ID); !found.DeactivatedAt.IsZero() {
+		t.Fatalf("active user has a deactivation time: %+v", found)
+	}
+
+	found, _ := repo.FindById(ctx, leaving.ID)
+	found.IsActive = false
+	if err := repo.Update(ctx, *found); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	deactivated, _ := repo.FindById(ctx, leaving.ID)
+	if deactivated.DeactivatedAt.Before(start) {
+		t.Fatalf("expected a deactivation time after %v, got %+v", start, deactivated)
+	}
+
+	// Staying inactive keeps the original time
+	if err := repo.Update(ctx, *deactivated); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	stillInactive, _ := repo.FindById(ctx, leaving.ID)
+	if !stillInactive.DeactivatedAt.Equal(deactivated.DeactivatedAt) {
+		t.Fatalf("deactivation time moved from %v to %v", deactivated.DeactivatedAt, stillInactive.DeactivatedAt)
+	}
+
+	old, err := repo.FindDeactivatedBefore(ctx, baseTime.Add(time.Hour), 10)
+	if err != nil || len(old) != 1 || old[0].ID != longGone.ID || !old[0].DeactivatedAt.Equal(baseTime) {
+		t.Fatalf("expected only %s deactivated before the cutoff, got %v (%v)", longGone.Email, emails(old), err)
+	}
+	all, _ := repo.FindDeactivatedBefore(ctx, time.Now().Add(time.Hour), 10)
+	if len(all) != 2 {
+		t.Fatalf("expected both inactive users, got %v", emails(all))
+	}
+	if limited, _ := repo.FindDeactivatedBefore(ctx, time.Now().Add(time.Hour), 1); len(limited) != 1 {
+		t.Fatalf("expected the limit to apply, got %v", emails(limited))
+	}
+
+	// Reactivating clears it
+	stillInactive.IsActive = true
+	if err := repo.Update(ctx, *stillInactive); err != nil {
+		t.Fatalf("reactivate: %v", err)
+	}
+	if restored, _ := repo.FindById(ctx, leaving.ID); !restored.DeactivatedAt.IsZero() {
+		t.Fatalf("reactivated user kept the deactivation time: %+v", restored)
+	}
+	if all, _ := repo.FindDeactivatedBefore(ctx, time.Now().Add(time.Hour), 10); len(all) != 1 {
+		t.Fatalf("expected only %s after the reactivation, got %v", longGone.Email, emails(all))
+	}
+
+	// Erased users are kept out of purges, and the erasure time can't be cleared
+	erased, _ := repo.FindById(ctx, longGone.ID)
+	erased.ErasedAt = start
+	if err := repo.Update(ctx, *erased); err != nil {
+		t.Fatalf("erase: %v", err)
+	}
+	if all, _ := repo.FindDeactivatedBefore(ctx, time.Now().Add(time.Hour), 10); len(all) != 0 {
+		t.Fatalf("expected erased users to be skipped, got %v", emails(all))
+	}
+	erased, _ = repo.FindById(ctx, longGone.ID)
+	erased.ErasedAt = time.Time{}
+	if err := repo.Update(ctx, *erased); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if found, _ := repo.FindById(ctx, longGone.ID); !found.ErasedAt.Equal(start) {
+		t.Fatalf("expected the erasure time %v to be kept, got %+v", start, found)
+	}
+}
+
+func testProfile(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(uuid.New(), "profile@example.com", 0)
+	user.Profile = model.Profile{
+		DisplayName: "Profile User",
+		Locale:      "de-DE",
+		Timezone:    "Europe/Berlin",
+		AvatarURL:   "https://example.com/avatar.png",
+		Attributes:  map[string]any{"department": "Sales", "badge": float64(42), "newsletter": true},
+	}
+	mustCreate(t, repo, user)
+
+	found, _ := repo.FindById(ctx, user.ID)
+	if !reflect.DeepEqual(found.Profile, user.Profile) {
+		t.Fatalf("profile mismatch:\n got  %+v\n want %+v", found.Profile, user.Profile)
+	}
+
+	// Update writes the profile as a whole
+	found.Profile.Attributes["department"] = "Support"
+	delete(found.Profile.Attributes, "badge")
+	found.Profile.AvatarURL = ""
+	if err := repo.Update(ctx, *found); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	updated, _ := repo.FindById(ctx, user.ID)
+	if !reflect.DeepEqual(updated.Profile, found.Profile) {
+		t.Fatalf("updated profile mismatch:\n got  %+v\n want %+v", updated.Profile, found.Profile)
+	}
+
+	updated.Profile = model.Profile{}
+	if err := repo.Update(ctx, *updated); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	cleared, _ := repo.FindById(ctx, user.ID)
+	if !reflect.DeepEqual(cleared.Profile, model.Profile{}) {
+		t.Fatalf("expected an empty profile, got %+v", cleared.Profile)
+	}
+}
+
+func testDelete(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(uuid.New(), "gone@example.com", 0)
+	mustCreate(t, repo, user)
+
+	if err := repo.Delete(ctx, uuid.New()); err != nil {
+		t.Fatalf("deleting a missing user should be a no-op, got %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if found, err := repo.FindById(ctx, user.ID); found != nil || err != nil {
+		t.Fatalf("deleted user still found: %+v, %v", found, err)
+	}
+
+	// Deleting frees the email
+	mustCreate(t, repo, newUser(user.TenantID, user.Email, 0))
+}
+
+func testReturnedUsersAreCopies(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(uuid.New(), "copy@example.com", 0)
+	mustCreate(t, repo, user)
+
+	found, _ := repo.FindById(ctx, user.ID)
+	found.IsActive = false
+	found.Roles[0] = model.SuperAdmin
+
+	again, _ := repo.FindById(ctx, user.ID)
+	assertSameUser(t, again, user)
+}
+
+func testListFiltersAndSorts(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	tenantID := uuid.New()
+
+	carol := newUser(tenantID, "carol@example.com", 0)
+	alice := newUser(tenantID, "alice@example.com", time.Hour)
+	bob := newUser(tenantID, "bob@example.com", 2*time.Hour)
+	bob.IsActive = false
+	alan := newUser(tenantID, "alan@example.com", 3*time.Hour)
+	alan.Roles = []model.Role{model.AppUser, model.Support}
+	outsider := newUser(uuid.New(), "aaron@example.com", 0)
+	mustCreate(t, repo, carol, alice, bob, alan, outsider)
+
+	active, inactive := true, false
+	support := model.Support
+	from, to := baseTime.Add(time.Hour), baseTime.Add(2*time.Hour)
+
+	cases := []struct {
+		name string
+		opts repository.UserListOptions
+		want []string
+	}{
+		{"tenant only, email asc", repository.UserListOptions{}, []string{"alan@example.com", "alice@example.com", "bob@example.com", "carol@example.com"}},
+		{"email desc", repository.UserListOptions{SortDesc: true}, []string{"carol@example.com", "bob@example.com", "alice@example.com", "alan@example.com"}},
+		{"created asc", repository.UserListOptions{SortBy: repository.SortByCreatedAt}, []string{"carol@example.com", "alice@example.com", "bob@example.com", "alan@example.com"}},
+		{"created desc", repository.UserListOptions{SortBy: repository.SortByCreatedAt, SortDesc: true}, []string{"alan@example.com", "bob@example.com", "alice@example.com", "carol@example.com"}},
+		{"active", repository.UserListOptions{IsActive: &active}, []string{"alan@example.com", "alice@example.com", "carol@example.com"}},
+		{"inactive", repository.UserListOptions{IsActive: &inactive}, []string{"bob@example.com"}},
+		{"role", repository.UserListOptions{Role: &support}, []string{"alan@example.com"}},
+		{"email prefix", repository.UserListOptions{EmailPrefix: "al"}, []string{"alan@example.com", "alice@example.com"}},
+		{"prefix is case-sensitive", repository.UserListOptions{EmailPrefix: "AL"}, []string{}},
+		{"created range is inclusive", repository.UserListOptions{CreatedFrom: &from, CreatedTo: &to}, []string{"alice@example.com", "bob@example.com"}},
+		{"created range by created", repository.UserListOptions{CreatedFrom: &from, SortBy: repository.SortByCreatedAt}, []string{"alice@example.com", "bob@example.com", "alan@example.com"}},
+		{"created to only", repository.UserListOptions{CreatedTo: &from}, []string{"alice@example.com", "carol@example.com"}},
+	}
+	for _, c := range cases {
+		opts := c.opts
+		opts.TenantID = tenantID
+		page, err := repo.List(ctx, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := emails(page.Users); !slices.Equal(got, c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+		if page.NextCursor != "" {
+			t.Fatalf("%s: unexpected cursor without a limit", c.name)
+		}
+	}
+
+	if _, err := repo.List(ctx, repository.UserListOptions{TenantID: tenantID, Cursor: "not a cursor"}); !errors.Is(err, errs.ErrInvalidCursor) {
+		t.Fatalf("bad cursor: expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+// Walking every page must visit each matching user exactly once, in order.
+// A backend may hand out one cursor too many, leading to an empty last page.
+func testListPaginates(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	tenantID := uuid.New()
+
+	var want []string
+	for i, email := range []string{"u1@example.com", "u2@example.com", "u3@example.com", "u4@example.com", "u5@example.com"} {
+		user := newUser(tenantID, email, time.Duration(5-i)*time.Minute)
+		if i == 2 {
+			user.IsActive = false
+		} else {
+			want = append(want, email)
+		}
+		mustCreate(t, repo, user)
+	}
+
+	active := true
+	for _, sortBy := range []string{repository.SortByEmail, repository.SortByCreatedAt} {
+		for _, desc := range []bool{false, true} {
+			expected := slices.Clone(want)
+			// Creation times run opposite to emails
+			if (sortBy == repository.SortByCreatedAt) != desc {
+				slices.Reverse(expected)
+			}
+
+			var got []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > len(want)+1 {
+					t.Fatalf("sort %s desc=%v: too many pages", sortBy, desc)
+				}
+				page, err := repo.List(ctx, repository.UserListOptions{
+					TenantID: tenantID,
+					IsActive: &active,
+					Limit:    2,
+					Cursor:   cursor,
+					SortBy:   sortBy,
+					SortDesc: desc,
+				})
+				if err != nil {
+					t.Fatalf("sort %s desc=%v: %v", sortBy, desc, err)
+				}
+				if len(page.Users) > 2 {
+					t.Fatalf("sort %s desc=%v: page larger than the limit: %v", sortBy, desc, emails(page.Users))
+				}
+				if len(page.Users) == 0 && page.NextCursor != "" {
+					t.Fatalf("sort %s desc=%v: empty page with a cursor", sortBy, desc)
+				}
+				got = append(got, emails(page.Users)...)
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+			if !slices.Equal(got, expected) {
+				t.Fatalf("sort %s desc=%v: got %v, want %v", sortBy, desc, got, expected)
+			}
+		}
+	}
+}
+
+func testListFiltersByActivity(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	tenantID := uuid.New()
+	start := time.Now().UTC().Truncate(time.Microsecond)
+
+	never := newUser(tenantID, "never@example.com", 0)
+	stale := newUser(tenantID, "stale@example.com", 0)
+	stale.PasswordChangedAt = baseTime
+	recent := newUser(tenantID, "recent@example.com", 0)
+	recent.PasswordChangedAt = baseTime.Add(2 * time.Hour)
+	mustCreate(t, repo, never, stale, recent)
+	if err := repo.RecordLogin(ctx, stale.ID, baseTime); err != nil {
+		t.Fatalf("record login: %v", err)
+	}
+	if err := repo.RecordLogin(ctx, recent.ID, baseTime.Add(48*time.Hour)); err != nil {
+		t.Fatalf("record login: %v", err)
+	}
+
+	cutoff := baseTime.Add(24 * time.Hour)
+	passwordCutoff := baseTime.Add(time.Hour)
+	beforeStart := start.Add(-time.Minute)
+	cases := []struct {
+		name string
+		opts repository.UserListOptions
+		want []string
+	}{
+		{"last login before, including never", repository.UserListOptions{LastLoginBefore: &cutoff}, []string{"never@example.com", "stale@example.com"}},
+		{"last login after", repository.UserListOptions{LastLoginAfter: &cutoff}, []string{"recent@example.com"}},
+		{"password changed before, including never", repository.UserListOptions{PasswordChangedBefore: &passwordCutoff}, []string{"never@example.com", "stale@example.com"}},
+		{"updated from", repository.UserListOptions{UpdatedFrom: &beforeStart}, []string{"never@example.com", "recent@example.com", "stale@example.com"}},
+		{"updated to", repository.UserListOptions{UpdatedTo: &beforeStart}, []string{}},
+	}
+	for _, tc := range cases {
+		tc.opts.TenantID = tenantID
+		page, err := repo.List(ctx, tc.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := emails(page.Users); !slices.Equal(got, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/google/uuid"
+)
+
+const (
+	SortByEmail     = "email"
+	SortByCreatedAt = "created_at"
+)
+
+// UserListOptions selects one page of a tenant's users. Nil/zero filters are ignored.
+// The "before" filters on last login and password change also match users that never had one.
+// EmailPrefix and SortByEmail work on the normalized email key, not the display email.
+type UserListOptions struct {
+	TenantID              uuid.UUID
+	Limit                 int
+	Cursor                string
+	IsActive              *bool
+	Role                  *model.Role
+	EmailPrefix           string
+	CreatedFrom           *time.Time
+	CreatedTo             *time.Time
+	UpdatedFrom           *time.Time
+	UpdatedTo             *time.Time
+	LastLoginBefore       *time.Time
+	LastLoginAfter        *time.Time
+	PasswordChangedBefore *time.Time
+	SortBy                string
+	SortDesc              bool
+}
+
+// NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []*model.User
+	NextCursor string
+}
+
+// Cursors are opaque to clients: each backend stores whatever it needs to resume.
+func encodeCursor(position map[string]string) string {
+	raw, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (map[string]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errs.ErrInvalidCursor
+	}
+	var position map[string]string
+	if err := json.Unmarshal(raw, &position); err != nil {
+		return nil, errs.ErrInvalidCursor
+	}
+	return position, nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Read-through cache in front of another UserRepository. Finds by id and email are served from an
+// in-process LRU until their TTL runs out; writes go straight to the wrapped repository and drop the user
+// from the cache. Lists and misses are never cached.
+//
+// Invalidation is local: a write made by another process is only seen here once the entry expires, so the
+// TTL bounds how stale a read can be.
+type UserRepositoryCached struct {
+	next UserRepository
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	lru     *list.List
+	byID    map[uuid.UUID]*list.Element
+	byEmail map[userEmailKey]*list.Element
+	// Bumped on every invalidation, so a read that raced with a write doesn't store what it read.
+	generation uint64
+	stats      CacheStats
+}
+
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+type cachedUser struct {
+	user    model.User
+	expires time.Time
+}
+
+func NewUserRepositoryCached(next UserRepository, ttl time.Duration, size int) *UserRepositoryCached {
+	return &UserRepositoryCached{
+		next:    next,
+		ttl:     ttl,
+		size:    max(size, 1),
+		lru:     list.New(),
+		byID:    make(map[uuid.UUID]*list.Element),
+		byEmail: make(map[userEmailKey]*list.Element),
+	}
+}
+
+func (ur *UserRepositoryCached) Stats() CacheStats {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	stats := ur.stats
+	stats.Size = ur.lru.Len()
+	return stats
+}
+
+func (ur *UserRepositoryCached) List(ctx context.Context, opts UserListOptions) (UserPage, error) {
+	return ur.next.List(ctx, opts)
+}
+
+func (ur *UserRepositoryCached) FindById(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	ur.mu.Lock()
+	element := ur.byID[id]
+	return ur.readThrough(element, func() (*model.User, error) {
+		return ur.next.FindById(ctx, id)
+	})
+}
+
+func (ur *UserRepositoryCached) FindByEmail(ctx context.Context, tenantID uuid.UUID, email string) (*model.User, error) {
+	ur.mu.Lock()
+	element := ur.byEmail[userEmailKey{tenantID: tenantID, email: email}]
+	return ur.readThrough(element, func() (*model.User, error) {
+		return ur.next.FindByEmail(ctx, tenantID, email)
+	})
+}
+
+func (ur *UserRepositoryCached) Create(ctx context.Context, user model.User) error {
+	return ur.next.Create(ctx, user)
+}
+
+// Failed updates invalidate too: a conflict means the cached copy is behind.
+func (ur *UserRepositoryCached) Update(ctx context.Context, user model.User) error {
+	defer ur.invalidate(user.ID)
+	return ur.next.Update(ctx, user)
+}
+
+func (ur *UserRepositoryCached) Delete(ctx context.Context, id uuid.UUID) error {
+	defer ur.invalidate(id)
+	return ur.next.Delete(ctx, id)
+}
+
+func (ur *UserRepositoryCached) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	defer ur.invalidate(id)
+	return ur.next.RecordLogin(ctx, id, at)
+}
+
+func (ur *UserRepositoryCached) FindDeactivatedBefore(ctx context.Context, before time.Time, limit int) ([]*model.User, error) {
+	return ur.next.FindDeactivatedBefore(ctx, before, limit)
+}
+
+// Called with mu held; releases it before going to the wrapped repository.
+func (ur *UserRepositoryCached) readThrough(element *list.Element, load func() (*model.User, error)) (*model.User, error) {
+	if element != nil {
+		entry := element.Value.(*cachedUser)
+		if time.Now().Before(entry.expires) {
+			ur.lru.MoveToFront(element)
+			ur.stats.Hits++
+			user := copyUser(entry.user)
+			ur.mu.Unlock()
+			return user, nil
+		}
+		ur.remove(element)
+	}
+	ur.stats.Misses++
+	generation := ur.generation
+	ur.mu.Unlock()
+
+	user, err := load()
+	if err != nil || user == nil {
+		return user, err
+	}
+
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	if ur.generation == generation {
+		ur.store(*user)
+	}
+	return user, nil
+}
+
+// Helpers
+// All of these expect mu to be held.
+func (ur *UserRepositoryCached) store(user model.User) {
+	if existing, ok := ur.byID[user.ID]; ok {
+		ur.remove(existing)
+	}
+	element := ur.lru.PushFront(&cachedUser{user: *copyUser(user), expires: time.Now().Add(ur.ttl)})
+	ur.byID[user.ID] = element
+	ur.byEmail[userEmailKey{tenantID: user.TenantID, email: emailKeyOf(user)}] = element
+
+	for ur.lru.Len() > ur.size {
+		ur.remove(ur.lru.Back())
+		ur.stats.Evictions++
+	}
+}
+
+func (ur *UserRepositoryCached) remove(element *list.Element) {
+	user := element.Value.(*cachedUser).user
+	ur.lru.Remove(element)
+	delete(ur.byID, user.ID)
+	delete(ur.byEmail, userEmailKey{tenantID: user.TenantID, email: emailKeyOf(user)})
+}
+
+func (ur *UserRepositoryCached) invalidate(id uuid.UUID) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	ur.generation++
+	if element, ok := ur.byID[id]; ok {
+		ur.remove(element)
+	}
+}
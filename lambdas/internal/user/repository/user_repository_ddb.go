@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -11,46 +14,185 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 
+	"github.com/danilobml/user-manager/internal/ddb"
+	"github.com/danilobml/user-manager/internal/errs"
 	dtos "github.com/danilobml/user-manager/internal/user/dtos"
 	"github.com/danilobml/user-manager/internal/user/model"
 )
 
 type UserRepositoryDdb struct {
-	client    *dynamodb.Client
-	tableName string
+	client              ddb.API
+	tableName           string
+	emailLocksTableName string
 }
 
-func NewUserRepositoryDdb(ddbClient *dynamodb.Client) *UserRepositoryDdb {
+func NewUserRepositoryDdb(ddbClient ddb.API) *UserRepositoryDdb {
 	return &UserRepositoryDdb{
-		client:    ddbClient,
-		tableName: "users",
+		client:              ddbClient,
+		tableName:           "users",
+		emailLocksTableName: "user_email_locks",
 	}
 }
 
-func (ur *UserRepositoryDdb) List(ctx context.Context) ([]*model.User, error) {
-	out, err := ur.client.Scan(ctx, &dynamodb.ScanInput{
-		TableName: aws.String(ur.tableName),
-	})
-	if err != nil {
-		return nil, err
+// Queries a per-tenant index sorted by the requested attribute, so ordering and pagination happen in DynamoDB.
+// Filters on the sort attribute become key conditions; the rest are filter expressions, and pages are
+// topped up until the limit is reached because DynamoDB applies Limit before filtering.
+func (ur *UserRepositoryDdb) List(ctx context.Context, opts UserListOptions) (UserPage, error) {
+	indexName, sortAttr := "tenant-email-key-index", "email_key"
+	if opts.SortBy == SortByCreatedAt {
+		indexName, sortAttr = "tenant-created-index", "created_at"
 	}
 
-	var ddbUsers []dtos.UserDDB
-	if err := attributevalue.UnmarshalListOfMaps(out.Items, &ddbUsers); err != nil {
-		return nil, err
+	names := map[string]string{
+		"#tenant_id": "tenant_id",
+		"#sort":      sortAttr,
+	}
+	values := map[string]types.AttributeValue{
+		":tenant_id": &types.AttributeValueMemberS{Value: opts.TenantID.String()},
+	}
+	keyCond := "#tenant_id = :tenant_id"
+	filters := []string{}
+
+	if opts.EmailPrefix != "" {
+		values[":email_prefix"] = &types.AttributeValueMemberS{Value: opts.EmailPrefix}
+		if sortAttr == "email_key" {
+			keyCond += " AND begins_with(#sort, :email_prefix)"
+		} else {
+			names["#email_key"] = "email_key"
+			filters = append(filters, "begins_with(#email_key, :email_prefix)")
+		}
+	}
+
+	createdAttr := "#created_at"
+	if sortAttr == "created_at" {
+		createdAttr = "#sort"
+	} else if opts.CreatedFrom != nil || opts.CreatedTo != nil {
+		names["#created_at"] = "created_at"
+	}
+	createdConds := []string{}
+	if opts.CreatedFrom != nil && opts.CreatedTo != nil {
+		values[":created_from"] = &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(*opts.CreatedFrom)}
+		values[":created_to"] = &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(*opts.CreatedTo)}
+		createdConds = append(createdConds, createdAttr+" BETWEEN :created_from AND :created_to")
+	} else if opts.CreatedFrom != nil {
+		values[":created_from"] = &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(*opts.CreatedFrom)}
+		createdConds = append(createdConds, createdAttr+" >= :created_from")
+	} else if opts.CreatedTo != nil {
+		values[":created_to"] = &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(*opts.CreatedTo)}
+		createdConds = append(createdConds, createdAttr+" <= :created_to")
+	}
+	if sortAttr == "created_at" {
+		for _, cond := range createdConds {
+			keyCond += " AND " + cond
+		}
+	} else {
+		filters = append(filters, createdConds...)
 	}
 
-	usersResp := make([]*model.User, 0, len(ddbUsers))
-	for i := range ddbUsers {
-		u, convErr := dtos.FromDDB(ddbUsers[i])
-		if convErr != nil {
-			return nil, convErr
+	timeFilters := []struct {
+		attr, placeholder, op string
+		value                 *time.Time
+		orMissing             bool
+	}{
+		{"updated_at", ":updated_from", ">=", opts.UpdatedFrom, false},
+		{"updated_at", ":updated_to", "<=", opts.UpdatedTo, false},
+		{"last_login_at", ":last_login_before", "<", opts.LastLoginBefore, true},
+		{"last_login_at", ":last_login_after", ">", opts.LastLoginAfter, false},
+		{"password_changed_at", ":password_changed_before", "<", opts.PasswordChangedBefore, true},
+	}
+	for _, f := range timeFilters {
+		if f.value == nil {
+			continue
+		}
+		names["#"+f.attr] = f.attr
+		values[f.placeholder] = &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(*f.value)}
+		cond := "#" + f.attr + " " + f.op + " " + f.placeholder
+		if f.orMissing {
+			cond = "(attribute_not_exists(#" + f.attr + ") OR " + cond + ")"
 		}
-		user := u
-		usersResp = append(usersResp, &user)
+		filters = append(filters, cond)
 	}
 
-	return usersResp, nil
+	if opts.IsActive != nil {
+		names["#is_active"] = "is_active"
+		values[":is_active"] = &types.AttributeValueMemberBOOL{Value: *opts.IsActive}
+		filters = append(filters, "#is_active = :is_active")
+	}
+	if opts.Role != nil {
+		names["#roles"] = "roles"
+		values[":role"] = &types.AttributeValueMemberS{Value: opts.Role.GetName()}
+		filters = append(filters, "contains(#roles, :role)")
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(ur.tableName),
+		IndexName:                 aws.String(indexName),
+		KeyConditionExpression:    aws.String(keyCond),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(!opts.SortDesc),
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+	if opts.Limit > 0 {
+		input.Limit = aws.Int32(int32(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		position, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return UserPage{}, err
+		}
+		// DynamoDB rejects start keys that don't match the index, so check cursors from clients here
+		if !validDDBCursor(position, sortAttr, opts.TenantID) {
+			return UserPage{}, errs.ErrInvalidCursor
+		}
+		startKey := make(map[string]types.AttributeValue, len(position))
+		for k, v := range position {
+			startKey[k] = &types.AttributeValueMemberS{Value: v}
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	page := UserPage{Users: []*model.User{}}
+	for {
+		out, err := ur.client.Query(ctx, input)
+		if err != nil {
+			return UserPage{}, err
+		}
+
+		var ddbUsers []dtos.UserDDB
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &ddbUsers); err != nil {
+			return UserPage{}, err
+		}
+
+		for i := range ddbUsers {
+			u, convErr := dtos.FromDDB(ddbUsers[i])
+			if convErr != nil {
+				return UserPage{}, convErr
+			}
+			user := u
+			page.Users = append(page.Users, &user)
+
+			if opts.Limit > 0 && len(page.Users) == opts.Limit {
+				if i == len(ddbUsers)-1 && out.LastEvaluatedKey == nil {
+					return page, nil
+				}
+				// Resume right after this item, even if DynamoDB's own page went further
+				page.NextCursor = encodeCursor(map[string]string{
+					"id":        ddbUsers[i].ID,
+					"tenant_id": ddbUsers[i].TenantID,
+					sortAttr:    ddbSortValue(ddbUsers[i], sortAttr),
+				})
+				return page, nil
+			}
+		}
+
+		if out.LastEvaluatedKey == nil {
+			return page, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
 }
 
 func (ur *UserRepositoryDdb) FindById(ctx context.Context, id uuid.UUID) (*model.User, error) {
@@ -80,16 +222,18 @@ func (ur *UserRepositoryDdb) FindById(ctx context.Context, id uuid.UUID) (*model
 	return &u, nil
 }
 
-func (ur *UserRepositoryDdb) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+func (ur *UserRepositoryDdb) FindByEmail(ctx context.Context, tenantID uuid.UUID, email string) (*model.User, error) {
 	out, err := ur.client.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(ur.tableName),
-		IndexName:              aws.String("email-index"),
-		KeyConditionExpression: aws.String("#email = :email"),
+		IndexName:              aws.String("tenant-email-key-index"),
+		KeyConditionExpression: aws.String("#tenant_id = :tenant_id AND #email_key = :email_key"),
 		ExpressionAttributeNames: map[string]string{
-			"#email": "email",
+			"#tenant_id": "tenant_id",
+			"#email_key": "email_key",
 		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":email": &types.AttributeValueMemberS{Value: email},
+			":tenant_id": &types.AttributeValueMemberS{Value: tenantID.String()},
+			":email_key": &types.AttributeValueMemberS{Value: email},
 		},
 		Limit: aws.Int32(1),
 	})
@@ -111,6 +255,14 @@ func (ur *UserRepositoryDdb) FindByEmail(ctx context.Context, email string) (*mo
 }
 
 func (ur *UserRepositoryDdb) Create(ctx context.Context, user model.User) error {
+	user.Version = 1
+	user.EmailKey = emailKeyOf(user)
+	user.UpdatedAt = now()
+	user.DeactivatedAt = deactivatedAt(user, time.Time{})
+	user.ErasedAt = erasedAt(user, time.Time{})
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = user.UpdatedAt
+	}
 	ddbUser := dtos.ToDDB(user)
 	item, err := attributevalue.MarshalMap(ddbUser)
 	if err != nil {
@@ -118,62 +270,458 @@ func (ur *UserRepositoryDdb) Create(ctx context.Context, user model.User) error
 	}
 	item["id"] = &types.AttributeValueMemberS{Value: user.ID.String()}
 
-	_, err = ur.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName:           aws.String(ur.tableName),
-		Item:                item,
-		ConditionExpression: aws.String("attribute_not_exists(#id)"),
-		ExpressionAttributeNames: map[string]string{
-			"#id": "id",
+	// The user and its email lock are written together, so a taken email fails the whole transaction.
+	_, err = ur.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(ur.tableName),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(#id)"),
+					ExpressionAttributeNames: map[string]string{
+						"#id": "id",
+					},
+				},
+			},
+			ur.putEmailLock(user.TenantID, user.EmailKey, ddbUser.ID),
 		},
 	})
-	return err
+	return mapTransactionError(err, errs.ErrAlreadyExists, errs.ErrAlreadyExists)
 }
 
 func (ur *UserRepositoryDdb) Update(ctx context.Context, user model.User) error {
 	ddbUser := dtos.ToDDB(user)
 	av, err := attributevalue.MarshalMap(ddbUser)
-	if err != nil { return fmt.Errorf("failed to marshal user: %w", err) }
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
 
 	names := map[string]string{
 		"#id":              "id",
 		"#hashed_password": "hashed_password",
 		"#roles":           "roles",
 		"#is_active":       "is_active",
+		"#is_verified":     "is_verified",
+		"#version":         "version",
+		"#updated_at":      "updated_at",
+		"#profile":         "profile",
 	}
 	values := map[string]types.AttributeValue{
-		":hashed_password": av["hashed_password"],
-		":roles":           av["roles"],
-		":is_active":       av["is_active"],
+		":hashed_password":  av["hashed_password"],
+		":roles":            av["roles"],
+		":is_active":        av["is_active"],
+		":is_verified":      av["is_verified"],
+		":expected_version": &types.AttributeValueMemberN{Value: strconv.FormatInt(user.Version, 10)},
+		":new_version":      &types.AttributeValueMemberN{Value: strconv.FormatInt(user.Version+1, 10)},
+		":updated_at":       &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(now())},
+		":profile":          av["profile"],
+	}
+	setParts := []string{"#hashed_password=:hashed_password", "#roles=:roles", "#is_active=:is_active", "#is_verified=:is_verified", "#version=:new_version", "#updated_at=:updated_at", "#profile=:profile"}
+	if ddbUser.PasswordChangedAt != "" {
+		names["#password_changed_at"] = "password_changed_at"
+		values[":password_changed_at"] = av["password_changed_at"]
+		setParts = append(setParts, "#password_changed_at=:password_changed_at")
 	}
-	setParts := []string{"#hashed_password=:hashed_password", "#roles=:roles", "#is_active=:is_active"}
 
-	if ddbUser.Email != "" {
+	// Items written before versioning have no version attribute and read as 0.
+	versionCond := "#version = :expected_version"
+	if user.Version == 0 {
+		versionCond = "(attribute_not_exists(#version) OR #version = :expected_version)"
+	}
+
+	existingUser, err := ur.FindById(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if existingUser == nil {
+		return errs.ErrNotFound
+	}
+	if existingUser.Version != user.Version {
+		return errs.ErrConflict
+	}
+
+	if ddbUser.Email != "" && ddbUser.Email != existingUser.Email {
 		names["#email"] = "email"
 		values[":email"] = av["email"]
 		setParts = append(setParts, "#email=:email")
 	}
+	oldKey, newKey := emailKeyOf(*existingUser), user.EmailKey
+	keyChanged := newKey != "" && newKey != oldKey
+	if keyChanged {
+		names["#email_key"] = "email_key"
+		values[":email_key"] = &types.AttributeValueMemberS{Value: newKey}
+		setParts = append(setParts, "#email_key=:email_key")
+	}
 
-	updateExpr := "SET " + strings.Join(setParts, ", ")
+	names["#deactivated_at"] = "deactivated_at"
+	removeExpr := ""
+	if deactivated := deactivatedAt(user, existingUser.DeactivatedAt); deactivated.IsZero() {
+		removeExpr = " REMOVE #deactivated_at"
+	} else {
+		values[":deactivated_at"] = &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(deactivated)}
+		setParts = append(setParts, "#deactivated_at=:deactivated_at")
+	}
 
-	_, err = ur.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName: aws.String(ur.tableName),
-		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{Value: ddbUser.ID},
+	if erased := erasedAt(user, existingUser.ErasedAt); !erased.IsZero() {
+		names["#erased_at"] = "erased_at"
+		values[":erased_at"] = &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(erased)}
+		setParts = append(setParts, "#erased_at=:erased_at")
+	}
+
+	updateExpr := "SET " + strings.Join(setParts, ", ") + removeExpr
+
+	if !keyChanged {
+		_, err = ur.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(ur.tableName),
+			Key: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: ddbUser.ID},
+			},
+			UpdateExpression:          aws.String(updateExpr),
+			ConditionExpression:       aws.String("attribute_exists(#id) AND " + versionCond),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return ur.updateConflict(ctx, user.ID)
+		}
+		return err
+	}
+
+	// Moving to a new email key swaps the locks atomically; the version condition guards against a concurrent change.
+	_, err = ur.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName: aws.String(ur.tableName),
+					Key: map[string]types.AttributeValue{
+						"id": &types.AttributeValueMemberS{Value: ddbUser.ID},
+					},
+					UpdateExpression:          aws.String(updateExpr),
+					ConditionExpression:       aws.String("attribute_exists(#id) AND " + versionCond),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			},
+			ur.deleteEmailLock(existingUser.TenantID, oldKey),
+			ur.putEmailLock(existingUser.TenantID, newKey, ddbUser.ID),
 		},
-		UpdateExpression:          aws.String(updateExpr),
-		ConditionExpression:       aws.String("attribute_exists(#id)"),
-		ExpressionAttributeNames:  names,
-		ExpressionAttributeValues: values,
 	})
+	err = mapTransactionError(err, errs.ErrConflict, errs.ErrAlreadyExists)
+	if errors.Is(err, errs.ErrConflict) {
+		return ur.updateConflict(ctx, user.ID)
+	}
 	return err
 }
 
+// A failed update condition means the user was either deleted or changed since it was read.
+func (ur *UserRepositoryDdb) updateConflict(ctx context.Context, id uuid.UUID) error {
+	current, err := ur.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errs.ErrNotFound
+	}
+	return errs.ErrConflict
+}
+
 func (ur *UserRepositoryDdb) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := ur.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+	existingUser, err := ur.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existingUser == nil {
+		return nil
+	}
+
+	_, err = ur.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName: aws.String(ur.tableName),
+					Key: map[string]types.AttributeValue{
+						"id": &types.AttributeValueMemberS{Value: id.String()},
+					},
+				},
+			},
+			ur.deleteEmailLock(existingUser.TenantID, emailKeyOf(*existingUser)),
+		},
+	})
+	return mapTransactionError(err, errs.ErrNotFound, errs.ErrNotFound)
+}
+
+func (ur *UserRepositoryDdb) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := ur.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(ur.tableName),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id.String()},
 		},
+		UpdateExpression:    aws.String("SET #last_login_at = :last_login_at"),
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id":            "id",
+			"#last_login_at": "last_login_at",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":last_login_at": &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(at)},
+		},
 	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return errs.ErrNotFound
+	}
+	return err
+}
+
+// Scans the whole table: purges run rarely and inactive users are spread over every tenant.
+func (ur *UserRepositoryDdb) FindDeactivatedBefore(ctx context.Context, before time.Time, limit int) ([]*model.User, error) {
+	users := make([]*model.User, 0)
+	var startKey map[string]types.AttributeValue
+	for len(users) < limit {
+		out, err := ur.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String(ur.tableName),
+			FilterExpression: aws.String("#is_active = :inactive AND #deactivated_at < :before AND attribute_not_exists(#erased_at)"),
+			ExpressionAttributeNames: map[string]string{
+				"#is_active":      "is_active",
+				"#deactivated_at": "deactivated_at",
+				"#erased_at":      "erased_at",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":inactive": &types.AttributeValueMemberBOOL{Value: false},
+				":before":   &types.AttributeValueMemberS{Value: dtos.FormatDDBTime(before)},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range out.Items {
+			if len(users) == limit {
+				break
+			}
+			var ddbUser dtos.UserDDB
+			if err := attributevalue.UnmarshalMap(item, &ddbUser); err != nil {
+				return nil, err
+			}
+			u, err := dtos.FromDDB(ddbUser)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, &u)
+		}
+
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+	return users, nil
+}
+
+// Rewrites email_key, and moves the matching email lock, for users written before emails were normalized
+// or after the normalization rules changed. Users written before organizations also get the default
+// tenant_id, without which the per-tenant indexes don't contain them, and users written before email locks
+// get their lock. Users that already have the right key and lock are left alone, and versions are not
+// bumped, so ETags held by clients stay valid. With dryRun nothing is written.
+func (ur *UserRepositoryDdb) BackfillEmailKeys(ctx context.Context, key func(email string) string, dryRun bool) (EmailKeyBackfillReport, error) {
+	var report EmailKeyBackfillReport
+	claimed := map[string]string{}
+
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := ur.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String(ur.tableName),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return report, err
+		}
+
+		for _, item := range out.Items {
+			var ddbUser dtos.UserDDB
+			if err := attributevalue.UnmarshalMap(item, &ddbUser); err != nil {
+				return report, err
+			}
+			user, err := dtos.FromDDB(ddbUser)
+			if err != nil {
+				return report, err
+			}
+			report.Scanned++
+
+			newKey := key(user.Email)
+			lock := emailLockKey(user.TenantID, newKey)
+
+			owner, err := ur.emailLockOwner(ctx, user.TenantID, newKey)
+			if err != nil {
+				return report, err
+			}
+			if newKey == user.EmailKey && ddbUser.TenantID != "" && owner == ddbUser.ID {
+				continue
+			}
+			if claimedBy, ok := claimed[lock]; ok && owner == "" {
+				owner = claimedBy
+			}
+			if owner != "" && owner != ddbUser.ID {
+				report.Collisions = append(report.Collisions, user.ID)
+				continue
+			}
+			claimed[lock] = ddbUser.ID
+
+			if dryRun {
+				report.Updated++
+				continue
+			}
+
+			err = ur.moveEmailKey(ctx, user, newKey, owner == ddbUser.ID)
+			if errors.Is(err, errs.ErrAlreadyExists) {
+				report.Collisions = append(report.Collisions, user.ID)
+				continue
+			}
+			if errors.Is(err, errs.ErrConflict) {
+				return report, fmt.Errorf("user %s changed during the backfill, run it again: %w", user.ID, err)
+			}
+			if err != nil {
+				return report, err
+			}
+			report.Updated++
+		}
+
+		if out.LastEvaluatedKey == nil {
+			return report, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+// Sets the key, and the tenant if missing, only if the user is unchanged since it was scanned, and moves the
+// lock in the same transaction.
+func (ur *UserRepositoryDdb) moveEmailKey(ctx context.Context, user model.User, newKey string, hasLock bool) error {
+	versionCond := "#version = :version"
+	if user.Version == 0 {
+		versionCond = "attribute_not_exists(#version)"
+	}
+	values := map[string]types.AttributeValue{
+		":email":     &types.AttributeValueMemberS{Value: user.Email},
+		":email_key": &types.AttributeValueMemberS{Value: newKey},
+		":tenant_id": &types.AttributeValueMemberS{Value: user.TenantID.String()},
+	}
+	if user.Version != 0 {
+		values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(user.Version, 10)}
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName: aws.String(ur.tableName),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: user.ID.String()},
+				},
+				UpdateExpression:    aws.String("SET #email_key = :email_key, #tenant_id = :tenant_id"),
+				ConditionExpression: aws.String("#email = :email AND " + versionCond),
+				ExpressionAttributeNames: map[string]string{
+					"#email":     "email",
+					"#email_key": "email_key",
+					"#tenant_id": "tenant_id",
+					"#version":   "version",
+				},
+				ExpressionAttributeValues: values,
+			},
+		},
+	}
+	if oldKey := emailKeyOf(user); oldKey != newKey {
+		items = append(items, ur.deleteEmailLock(user.TenantID, oldKey))
+	}
+	if !hasLock {
+		items = append(items, ur.putEmailLock(user.TenantID, newKey, user.ID.String()))
+	}
+
+	_, err := ur.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	return mapTransactionError(err, errs.ErrConflict, errs.ErrAlreadyExists)
+}
+
+func (ur *UserRepositoryDdb) emailLockOwner(ctx context.Context, tenantID uuid.UUID, emailKey string) (string, error) {
+	out, err := ur.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(ur.emailLocksTableName),
+		Key: map[string]types.AttributeValue{
+			"email_key": &types.AttributeValueMemberS{Value: emailLockKey(tenantID, emailKey)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	owner, ok := out.Item["user_id"].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", nil
+	}
+	return owner.Value, nil
+}
+
+// Helper
+func ddbSortValue(u dtos.UserDDB, sortAttr string) string {
+	if sortAttr == "created_at" {
+		return u.CreatedAt
+	}
+	return u.EmailKey
+}
+
+// Email locks live in their own table, keyed by tenant and normalized email, and point back to the owning user.
+// A cursor holds exactly the table and index keys of the page's last user, in the tenant being listed.
+func validDDBCursor(position map[string]string, sortAttr string, tenantID uuid.UUID) bool {
+	if len(position) != 3 || position[sortAttr] == "" || position["tenant_id"] != tenantID.String() {
+		return false
+	}
+	_, err := uuid.Parse(position["id"])
+	return err == nil
+}
+
+func emailLockKey(tenantID uuid.UUID, emailKey string) string {
+	return tenantID.String() + "#" + emailKey
+}
+
+func (ur *UserRepositoryDdb) putEmailLock(tenantID uuid.UUID, emailKey string, userID string) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: aws.String(ur.emailLocksTableName),
+			Item: map[string]types.AttributeValue{
+				"email_key": &types.AttributeValueMemberS{Value: emailLockKey(tenantID, emailKey)},
+				"user_id":   &types.AttributeValueMemberS{Value: userID},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#email_key)"),
+			ExpressionAttributeNames: map[string]string{
+				"#email_key": "email_key",
+			},
+		},
+	}
+}
+
+// Locks missing for users created before uniqueness was enforced are tolerated, so no condition here.
+func (ur *UserRepositoryDdb) deleteEmailLock(tenantID uuid.UUID, emailKey string) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Delete: &types.Delete{
+			TableName: aws.String(ur.emailLocksTableName),
+			Key: map[string]types.AttributeValue{
+				"email_key": &types.AttributeValueMemberS{Value: emailLockKey(tenantID, emailKey)},
+			},
+		},
+	}
+}
+
+// The first transaction item is always the user; any other conditional failure is an email lock.
+func mapTransactionError(err error, userConflict error, lockConflict error) error {
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		return err
+	}
+	for i, reason := range canceledErr.CancellationReasons {
+		if aws.ToString(reason.Code) != "ConditionalCheckFailed" {
+			continue
+		}
+		if i == 0 {
+			return userConflict
+		}
+		return lockConflict
+	}
 	return err
 }
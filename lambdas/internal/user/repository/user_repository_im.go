@@ -2,7 +2,12 @@ package repository
 
 import (
 	"context"
+	"maps"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -10,79 +15,256 @@ import (
 	"github.com/danilobml/user-manager/internal/user/model"
 )
 
+// Safe for concurrent use. Users are copied in and out, so callers never share stored state.
+// Not-found semantics match the DynamoDB repository: finds return nil, nil and deleting a missing user is a no-op.
 type UserRepositoryInMemory struct {
-	data []model.User
+	mu      sync.RWMutex
+	byID    map[uuid.UUID]model.User
+	byEmail map[userEmailKey]uuid.UUID
+}
+
+type userEmailKey struct {
+	tenantID uuid.UUID
+	email    string
 }
 
 func NewUserRepositoryInMemory() *UserRepositoryInMemory {
 	return &UserRepositoryInMemory{
-		data: make([]model.User, 0),
+		byID:    make(map[uuid.UUID]model.User),
+		byEmail: make(map[userEmailKey]uuid.UUID),
 	}
 }
 
-func (ur *UserRepositoryInMemory) List(ctx context.Context) ([]*model.User, error) {
-	usersResp := make([]*model.User, 0, len(ur.data))
-	for i := range ur.data {
-		usersResp = append(usersResp, &ur.data[i])
+func (ur *UserRepositoryInMemory) List(ctx context.Context, opts UserListOptions) (UserPage, error) {
+	offset := 0
+	if opts.Cursor != "" {
+		position, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return UserPage{}, err
+		}
+		offset, err = strconv.Atoi(position["offset"])
+		if err != nil || offset < 0 {
+			return UserPage{}, errs.ErrInvalidCursor
+		}
+	}
+
+	ur.mu.RLock()
+	matches := make([]*model.User, 0)
+	for _, user := range ur.byID {
+		if matchesListOptions(user, opts) {
+			matches = append(matches, copyUser(user))
+		}
+	}
+	ur.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b *model.User) int {
+		c := strings.Compare(a.EmailKey, b.EmailKey)
+		if opts.SortBy == SortByCreatedAt {
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if c == 0 {
+			c = strings.Compare(a.ID.String(), b.ID.String())
+		}
+		if opts.SortDesc {
+			return -c
+		}
+		return c
+	})
+
+	if offset >= len(matches) {
+		return UserPage{Users: []*model.User{}}, nil
 	}
-	if usersResp == nil {
-		return []*model.User{}, nil
+	end := len(matches)
+	if opts.Limit > 0 && offset+opts.Limit < end {
+		end = offset + opts.Limit
+	}
+
+	page := UserPage{Users: matches[offset:end]}
+	if end < len(matches) {
+		page.NextCursor = encodeCursor(map[string]string{"offset": strconv.Itoa(end)})
 	}
-	return usersResp, nil
+
+	return page, nil
 }
 
 func (ur *UserRepositoryInMemory) FindById(ctx context.Context, id uuid.UUID) (*model.User, error) {
-	for i := range ur.data {
-		if ur.data[i].ID == id {
-			return &ur.data[i], nil
-		}
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	user, ok := ur.byID[id]
+	if !ok {
+		return nil, nil
 	}
-	return nil, errs.ErrNotFound
+	return copyUser(user), nil
 }
 
-func (ur *UserRepositoryInMemory) FindByEmail(ctx context.Context, email string) (*model.User, error) {
-	for i := range ur.data {
-		if ur.data[i].Email == email {
-			return &ur.data[i], nil
-		}
+func (ur *UserRepositoryInMemory) FindByEmail(ctx context.Context, tenantID uuid.UUID, email string) (*model.User, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	id, ok := ur.byEmail[userEmailKey{tenantID: tenantID, email: email}]
+	if !ok {
+		return nil, nil
 	}
-	return nil, errs.ErrNotFound
+	return copyUser(ur.byID[id]), nil
 }
 
 func (ur *UserRepositoryInMemory) Create(ctx context.Context, user model.User) error {
-	existingUser, _ := ur.FindByEmail(ctx, user.Email)
-	if existingUser != nil {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	user.EmailKey = emailKeyOf(user)
+	key := userEmailKey{tenantID: user.TenantID, email: user.EmailKey}
+	if _, taken := ur.byEmail[key]; taken {
+		return errs.ErrAlreadyExists
+	}
+	if _, taken := ur.byID[user.ID]; taken {
 		return errs.ErrAlreadyExists
 	}
 
-	ur.data = append(ur.data, user)
+	stored := *copyUser(user)
+	stored.Version = 1
+	stored.UpdatedAt = now()
+	stored.DeactivatedAt = deactivatedAt(user, time.Time{})
+	stored.ErasedAt = erasedAt(user, time.Time{})
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = stored.UpdatedAt
+	}
+	ur.byID[user.ID] = stored
+	ur.byEmail[key] = user.ID
 
 	return nil
 }
 
+// Updates the same fields as the DynamoDB repository; an empty email or unset PasswordChangedAt keeps the stored value.
+// The caller's Version must match the stored one.
 func (ur *UserRepositoryInMemory) Update(ctx context.Context, user model.User) error {
-	existingUser, err := ur.FindById(ctx, user.ID)
-	if err != nil {
-		return err
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	existing, ok := ur.byID[user.ID]
+	if !ok {
+		return errs.ErrNotFound
+	}
+	if existing.Version != user.Version {
+		return errs.ErrConflict
 	}
 
-	existingUser.Email = user.Email
-	existingUser.HashedPassword = user.HashedPassword
-	existingUser.Roles = user.Roles
-	existingUser.IsActive = user.IsActive
+	if newKey := user.EmailKey; newKey != "" && newKey != existing.EmailKey {
+		lookup := userEmailKey{tenantID: existing.TenantID, email: newKey}
+		if _, taken := ur.byEmail[lookup]; taken {
+			return errs.ErrAlreadyExists
+		}
+		delete(ur.byEmail, userEmailKey{tenantID: existing.TenantID, email: existing.EmailKey})
+		ur.byEmail[lookup] = existing.ID
+		existing.EmailKey = newKey
+	}
+	if user.Email != "" {
+		existing.Email = user.Email
+	}
+
+	existing.HashedPassword = user.HashedPassword
+	existing.Roles = slices.Clone(user.Roles)
+	existing.Profile = copyUser(user).Profile
+	existing.DeactivatedAt = deactivatedAt(user, existing.DeactivatedAt)
+	existing.ErasedAt = erasedAt(user, existing.ErasedAt)
+	existing.IsActive = user.IsActive
+	existing.IsVerified = user.IsVerified
+	if !user.PasswordChangedAt.IsZero() {
+		existing.PasswordChangedAt = user.PasswordChangedAt
+	}
+	existing.UpdatedAt = now()
+	existing.Version++
+	ur.byID[user.ID] = existing
 
 	return nil
 }
 
 func (ur *UserRepositoryInMemory) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := ur.FindById(ctx, id)
-	if err != nil {
-		return err
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	existing, ok := ur.byID[id]
+	if !ok {
+		return nil
 	}
 
-	ur.data = slices.DeleteFunc(ur.data, func(user model.User) bool {
-		return user.ID == id
-	})
+	delete(ur.byEmail, userEmailKey{tenantID: existing.TenantID, email: existing.EmailKey})
+	delete(ur.byID, id)
 
 	return nil
 }
+
+func (ur *UserRepositoryInMemory) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	existing, ok := ur.byID[id]
+	if !ok {
+		return errs.ErrNotFound
+	}
+	existing.LastLoginAt = at.UTC().Truncate(time.Microsecond)
+	ur.byID[id] = existing
+
+	return nil
+}
+
+func (ur *UserRepositoryInMemory) FindDeactivatedBefore(ctx context.Context, before time.Time, limit int) ([]*model.User, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	users := make([]*model.User, 0)
+	for _, user := range ur.byID {
+		if len(users) == limit {
+			break
+		}
+		if !user.IsActive && user.ErasedAt.IsZero() && !user.DeactivatedAt.IsZero() && user.DeactivatedAt.Before(before) {
+			users = append(users, copyUser(user))
+		}
+	}
+	return users, nil
+}
+
+// Helpers
+func copyUser(user model.User) *model.User {
+	user.Roles = slices.Clone(user.Roles)
+	user.Profile.Attributes = maps.Clone(user.Profile.Attributes)
+	return &user
+}
+
+func matchesListOptions(user model.User, opts UserListOptions) bool {
+	if user.TenantID != opts.TenantID {
+		return false
+	}
+	if opts.IsActive != nil && user.IsActive != *opts.IsActive {
+		return false
+	}
+	if opts.Role != nil && !slices.Contains(user.Roles, *opts.Role) {
+		return false
+	}
+	if opts.EmailPrefix != "" && !strings.HasPrefix(user.EmailKey, opts.EmailPrefix) {
+		return false
+	}
+	if opts.CreatedFrom != nil && user.CreatedAt.Before(*opts.CreatedFrom) {
+		return false
+	}
+	if opts.CreatedTo != nil && user.CreatedAt.After(*opts.CreatedTo) {
+		return false
+	}
+	if opts.UpdatedFrom != nil && user.UpdatedAt.Before(*opts.UpdatedFrom) {
+		return false
+	}
+	if opts.UpdatedTo != nil && user.UpdatedAt.After(*opts.UpdatedTo) {
+		return false
+	}
+	if opts.LastLoginBefore != nil && !user.LastLoginAt.IsZero() && !user.LastLoginAt.Before(*opts.LastLoginBefore) {
+		return false
+	}
+	if opts.LastLoginAfter != nil && !user.LastLoginAt.After(*opts.LastLoginAfter) {
+		return false
+	}
+	if opts.PasswordChangedBefore != nil && !user.PasswordChangedAt.IsZero() && !user.PasswordChangedAt.Before(*opts.PasswordChangedBefore) {
+		return false
+	}
+	return true
+}
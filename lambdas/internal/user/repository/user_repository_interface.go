@@ -2,16 +2,75 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/danilobml/user-manager/internal/user/model"
 	"github.com/google/uuid"
 )
 
 type UserRepository interface {
-	List(ctx context.Context) ([]*model.User, error)
+	List(ctx context.Context, opts UserListOptions) (UserPage, error)
 	FindById(ctx context.Context, id uuid.UUID) (*model.User, error)
-	FindByEmail(ctx context.Context, email string) (*model.User, error)
+	FindByEmail(ctx context.Context, tenantID uuid.UUID, email string) (*model.User, error)
 	Create(ctx context.Context, user model.User) error
+	// An empty EmailKey keeps the stored key, so callers that only change other fields can't re-key the user.
 	Update(ctx context.Context, user model.User) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	// Records a login without counting as a change: Version and UpdatedAt are left alone.
+	RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error
+	// Inactive users of every tenant deactivated before the given time, at most limit of them.
+	// Erased users are kept as tombstones and never returned.
+	FindDeactivatedBefore(ctx context.Context, before time.Time, limit int) ([]*model.User, error)
+}
+
+// Rebuilds email keys with the current normalization rules. Implemented by the persistent backends, see cmd/migrate-email-keys.
+type EmailKeyBackfiller interface {
+	BackfillEmailKeys(ctx context.Context, key func(email string) string, dryRun bool) (EmailKeyBackfillReport, error)
+}
+
+// Users are read in pages of this many by the SQL backfills.
+const emailKeyBackfillBatch = 500
+
+type EmailKeyBackfillReport struct {
+	Scanned int
+	Updated int
+	// Users whose new key is already taken by someone else. They keep their old key until resolved by hand.
+	Collisions []uuid.UUID
+}
+
+// Helpers
+// Callers that don't normalize emails, and items stored before keys existed, use the email itself as the key.
+func emailKeyOf(user model.User) string {
+	if user.EmailKey != "" {
+		return user.EmailKey
+	}
+	return user.Email
+}
+
+// Timestamps are kept at microsecond precision, the finest every backend stores.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// DeactivatedAt follows IsActive: set when a user is deactivated, kept while they stay inactive and cleared
+// when they are reactivated. Callers may pass their own time, e.g. when importing.
+func deactivatedAt(user model.User, stored time.Time) time.Time {
+	switch {
+	case user.IsActive:
+		return time.Time{}
+	case !user.DeactivatedAt.IsZero():
+		return user.DeactivatedAt.UTC().Truncate(time.Microsecond)
+	case !stored.IsZero():
+		return stored
+	default:
+		return now()
+	}
+}
+
+// Erasure can't be undone: once stored, ErasedAt is kept whatever the caller passes.
+func erasedAt(user model.User, stored time.Time) time.Time {
+	if !stored.IsZero() || user.ErasedAt.IsZero() {
+		return stored
+	}
+	return user.ErasedAt.UTC().Truncate(time.Microsecond)
 }
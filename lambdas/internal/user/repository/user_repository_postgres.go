@@ -0,0 +1,459 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Schema lives in internal/postgres/migrations and is applied by postgres.InitPostgres.
+type UserRepositoryPostgres struct {
+	db      *sql.DB
+	typeMap *pgtype.Map
+}
+
+func NewUserRepositoryPostgres(db *sql.DB) *UserRepositoryPostgres {
+	return &UserRepositoryPostgres{
+		db:      db,
+		typeMap: pgtype.NewMap(),
+	}
+}
+
+const userColumns = "id, tenant_id, email, email_key, hashed_password, roles, is_active, is_verified, created_at, updated_at, last_login_at, password_changed_at, deactivated_at, erased_at, profile, version"
+
+const pgUniqueViolation = "23505"
+
+// Keyset pagination on (sort column, id): the cursor holds the last row's values, so pages stay stable under inserts.
+func (ur *UserRepositoryPostgres) List(ctx context.Context, opts UserListOptions) (UserPage, error) {
+	args := []any{}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := []string{"tenant_id = " + arg(opts.TenantID)}
+	if opts.IsActive != nil {
+		where = append(where, "is_active = "+arg(*opts.IsActive))
+	}
+	if opts.Role != nil {
+		where = append(where, arg(opts.Role.GetName())+" = ANY(roles)")
+	}
+	if opts.EmailPrefix != "" {
+		where = append(where, "email_key LIKE "+arg(escapeLike(opts.EmailPrefix)+"%"))
+	}
+	if opts.CreatedFrom != nil {
+		where = append(where, "created_at >= "+arg(*opts.CreatedFrom))
+	}
+	if opts.CreatedTo != nil {
+		where = append(where, "created_at <= "+arg(*opts.CreatedTo))
+	}
+	if opts.UpdatedFrom != nil {
+		where = append(where, "updated_at >= "+arg(*opts.UpdatedFrom))
+	}
+	if opts.UpdatedTo != nil {
+		where = append(where, "updated_at <= "+arg(*opts.UpdatedTo))
+	}
+	if opts.LastLoginBefore != nil {
+		where = append(where, "(last_login_at IS NULL OR last_login_at < "+arg(*opts.LastLoginBefore)+")")
+	}
+	if opts.LastLoginAfter != nil {
+		where = append(where, "last_login_at > "+arg(*opts.LastLoginAfter))
+	}
+	if opts.PasswordChangedBefore != nil {
+		where = append(where, "(password_changed_at IS NULL OR password_changed_at < "+arg(*opts.PasswordChangedBefore)+")")
+	}
+
+	sortCol := "email_key"
+	if opts.SortBy == SortByCreatedAt {
+		sortCol = "created_at"
+	}
+	direction, comparison := "ASC", ">"
+	if opts.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		position, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return UserPage{}, err
+		}
+		lastID, err := uuid.Parse(position["id"])
+		if err != nil {
+			return UserPage{}, errs.ErrInvalidCursor
+		}
+		var lastSort any = position[sortCol]
+		if sortCol == "created_at" {
+			lastSort, err = time.Parse(time.RFC3339Nano, position[sortCol])
+			if err != nil {
+				return UserPage{}, errs.ErrInvalidCursor
+			}
+		}
+		where = append(where, "("+sortCol+", id) "+comparison+" ("+arg(lastSort)+", "+arg(lastID)+")")
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY " + sortCol + " " + direction + ", id " + direction
+	if opts.Limit > 0 {
+		// One extra row tells whether another page exists
+		query += " LIMIT " + arg(opts.Limit+1)
+	}
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return UserPage{}, err
+	}
+	defer rows.Close()
+
+	page := UserPage{Users: []*model.User{}}
+	for rows.Next() {
+		user, err := ur.scanUser(rows)
+		if err != nil {
+			return UserPage{}, err
+		}
+		page.Users = append(page.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return UserPage{}, err
+	}
+
+	if opts.Limit > 0 && len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+		last := page.Users[len(page.Users)-1]
+		position := map[string]string{"id": last.ID.String(), "email_key": last.EmailKey}
+		if sortCol == "created_at" {
+			position = map[string]string{"id": last.ID.String(), "created_at": last.CreatedAt.Format(time.RFC3339Nano)}
+		}
+		page.NextCursor = encodeCursor(position)
+	}
+
+	return page, nil
+}
+
+func (ur *UserRepositoryPostgres) FindById(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	row := ur.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id)
+	user, err := ur.scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (ur *UserRepositoryPostgres) FindByEmail(ctx context.Context, tenantID uuid.UUID, email string) (*model.User, error) {
+	row := ur.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE tenant_id = $1 AND email_key = $2", tenantID, email)
+	user, err := ur.scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (ur *UserRepositoryPostgres) Create(ctx context.Context, user model.User) error {
+	updatedAt := now()
+	createdAt := user.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = updatedAt
+	}
+	profile, err := json.Marshal(user.Profile)
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.db.ExecContext(ctx,
+		"INSERT INTO users ("+userColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, 1)",
+		user.ID, user.TenantID, user.Email, emailKeyOf(user), user.HashedPassword, helpers.GetRoleNames(user.Roles), user.IsActive, user.IsVerified,
+		createdAt, updatedAt, nullTime(user.LastLoginAt), nullTime(user.PasswordChangedAt), nullTime(deactivatedAt(user, time.Time{})),
+		nullTime(erasedAt(user, time.Time{})), string(profile),
+	)
+	if isUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	return err
+}
+
+// An empty email or unset PasswordChangedAt keeps the stored value, as in the DynamoDB repository.
+// DeactivatedAt follows IsActive, see deactivatedAt; ErasedAt is never cleared.
+// Only matches the row at the caller's version, and bumps it.
+func (ur *UserRepositoryPostgres) Update(ctx context.Context, user model.User) error {
+	profile, err := json.Marshal(user.Profile)
+	if err != nil {
+		return err
+	}
+
+	res, err := ur.db.ExecContext(ctx,
+		`UPDATE users SET
+			email = COALESCE(NULLIF($2, ''), email),
+			email_key = COALESCE(NULLIF($10, ''), email_key),
+			hashed_password = $3,
+			roles = $4,
+			is_active = $5,
+			is_verified = $6,
+			password_changed_at = COALESCE($8, password_changed_at),
+			deactivated_at = CASE WHEN $5 THEN NULL ELSE COALESCE($11, deactivated_at, $9) END,
+			erased_at = COALESCE(erased_at, $12),
+			profile = $13,
+			updated_at = $9,
+			version = version + 1
+		WHERE id = $1 AND version = $7`,
+		user.ID, user.Email, user.HashedPassword, helpers.GetRoleNames(user.Roles), user.IsActive, user.IsVerified, user.Version,
+		nullTime(user.PasswordChangedAt), now(), user.EmailKey, nullTime(user.DeactivatedAt),
+		nullTime(user.ErasedAt), string(profile),
+	)
+	if isUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ur.updateConflict(ctx, user.ID)
+	}
+
+	return nil
+}
+
+func (ur *UserRepositoryPostgres) updateConflict(ctx context.Context, id uuid.UUID) error {
+	current, err := ur.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errs.ErrNotFound
+	}
+	return errs.ErrConflict
+}
+
+func (ur *UserRepositoryPostgres) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := ur.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	return err
+}
+
+func (ur *UserRepositoryPostgres) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := ur.db.ExecContext(ctx, "UPDATE users SET last_login_at = $2 WHERE id = $1", id, nullTime(at))
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+func (ur *UserRepositoryPostgres) FindDeactivatedBefore(ctx context.Context, before time.Time, limit int) ([]*model.User, error) {
+	rows, err := ur.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE NOT is_active AND erased_at IS NULL AND deactivated_at < $1 ORDER BY deactivated_at LIMIT $2",
+		before.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ur.scanUsers(rows)
+}
+
+// Rewrites email_key for users whose key was written with other rules, e.g. the lower(email) of migration
+// 0004. Works like the DynamoDB backfill: users that already have the right key are left alone, versions
+// are not bumped, and users whose new key is taken are reported instead. With dryRun nothing is written.
+func (ur *UserRepositoryPostgres) BackfillEmailKeys(ctx context.Context, key func(email string) string, dryRun bool) (EmailKeyBackfillReport, error) {
+	var report EmailKeyBackfillReport
+	claimed := map[userEmailKey]uuid.UUID{}
+
+	after := uuid.Nil
+	for {
+		rows, err := ur.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE id > $1 ORDER BY id LIMIT $2", after, emailKeyBackfillBatch)
+		if err != nil {
+			return report, err
+		}
+		users, err := ur.scanUsers(rows)
+		if err != nil {
+			return report, err
+		}
+
+		for _, user := range users {
+			report.Scanned++
+			newKey := key(user.Email)
+			if newKey == user.EmailKey {
+				continue
+			}
+
+			lookup := userEmailKey{tenantID: user.TenantID, email: newKey}
+			owner, ok := claimed[lookup]
+			if !ok {
+				holder, err := ur.FindByEmail(ctx, user.TenantID, newKey)
+				if err != nil {
+					return report, err
+				}
+				if holder != nil {
+					owner, ok = holder.ID, true
+				}
+			}
+			if ok && owner != user.ID {
+				report.Collisions = append(report.Collisions, user.ID)
+				continue
+			}
+			claimed[lookup] = user.ID
+
+			if dryRun {
+				report.Updated++
+				continue
+			}
+			err := ur.setEmailKey(ctx, *user, newKey)
+			if errors.Is(err, errs.ErrAlreadyExists) {
+				report.Collisions = append(report.Collisions, user.ID)
+				continue
+			}
+			if errors.Is(err, errs.ErrConflict) {
+				return report, fmt.Errorf("user %s changed during the backfill, run it again: %w", user.ID, err)
+			}
+			if err != nil {
+				return report, err
+			}
+			report.Updated++
+		}
+
+		if len(users) < emailKeyBackfillBatch {
+			return report, nil
+		}
+		after = users[len(users)-1].ID
+	}
+}
+
+// Helpers
+// Sets the key only if the user is unchanged since it was scanned.
+func (ur *UserRepositoryPostgres) setEmailKey(ctx context.Context, user model.User, newKey string) error {
+	res, err := ur.db.ExecContext(ctx, "UPDATE users SET email_key = $1 WHERE id = $2 AND email = $3 AND version = $4",
+		newKey, user.ID, user.Email, user.Version)
+	if isUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errs.ErrConflict
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (ur *UserRepositoryPostgres) scanUsers(rows *sql.Rows) ([]*model.User, error) {
+	defer rows.Close()
+
+	users := make([]*model.User, 0)
+	for rows.Next() {
+		user, err := ur.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (ur *UserRepositoryPostgres) scanUser(row rowScanner) (*model.User, error) {
+	var user model.User
+	var roleNames []string
+	var lastLoginAt, passwordChangedAt, deactivatedAt, erasedAt sql.NullTime
+	var profile []byte
+	err := row.Scan(
+		&user.ID,
+		&user.TenantID,
+		&user.Email,
+		&user.EmailKey,
+		&user.HashedPassword,
+		ur.typeMap.SQLScanner(&roleNames),
+		&user.IsActive,
+		&user.IsVerified,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&lastLoginAt,
+		&passwordChangedAt,
+		&deactivatedAt,
+		&erasedAt,
+		&profile,
+		&user.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(profile, &user.Profile); err != nil {
+		return nil, err
+	}
+
+	if user.Roles, err = parseRoleNames(roleNames); err != nil {
+		return nil, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	user.UpdatedAt = user.UpdatedAt.UTC()
+	if lastLoginAt.Valid {
+		user.LastLoginAt = lastLoginAt.Time.UTC()
+	}
+	if passwordChangedAt.Valid {
+		user.PasswordChangedAt = passwordChangedAt.Time.UTC()
+	}
+	if deactivatedAt.Valid {
+		user.DeactivatedAt = deactivatedAt.Time.UTC()
+	}
+	if erasedAt.Valid {
+		user.ErasedAt = erasedAt.Time.UTC()
+	}
+
+	return &user, nil
+}
+
+func parseRoleNames(names []string) ([]model.Role, error) {
+	roles := make([]model.Role, 0, len(names))
+	for _, name := range names {
+		role, err := model.ParseRole(name)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// Zero times are stored as NULL.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
+
+// LIKE treats % and _ as wildcards; backslash is Postgres' default escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
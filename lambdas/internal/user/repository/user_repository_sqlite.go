@@ -0,0 +1,455 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// Fixed-width UTC text, so created_at sorts and compares correctly as a string.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// Schema lives in internal/sqlite/migrations and is applied by sqlite.InitSQLite.
+type UserRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewUserRepositorySQLite(db *sql.DB) *UserRepositorySQLite {
+	return &UserRepositorySQLite{
+		db: db,
+	}
+}
+
+// Keyset pagination on (sort column, id), as in the Postgres repository.
+func (ur *UserRepositorySQLite) List(ctx context.Context, opts UserListOptions) (UserPage, error) {
+	where := []string{"tenant_id = ?"}
+	args := []any{opts.TenantID.String()}
+
+	if opts.IsActive != nil {
+		where = append(where, "is_active = ?")
+		args = append(args, *opts.IsActive)
+	}
+	if opts.Role != nil {
+		where = append(where, "EXISTS (SELECT 1 FROM json_each(users.roles) WHERE json_each.value = ?)")
+		args = append(args, opts.Role.GetName())
+	}
+	if opts.EmailPrefix != "" {
+		// LIKE is case-insensitive in SQLite, so compare the prefix directly
+		where = append(where, "substr(email_key, 1, length(?)) = ?")
+		args = append(args, opts.EmailPrefix, opts.EmailPrefix)
+	}
+	if opts.CreatedFrom != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, formatSQLiteTime(*opts.CreatedFrom))
+	}
+	if opts.CreatedTo != nil {
+		where = append(where, "created_at <= ?")
+		args = append(args, formatSQLiteTime(*opts.CreatedTo))
+	}
+	if opts.UpdatedFrom != nil {
+		where = append(where, "updated_at >= ?")
+		args = append(args, formatSQLiteTime(*opts.UpdatedFrom))
+	}
+	if opts.UpdatedTo != nil {
+		where = append(where, "updated_at <= ?")
+		args = append(args, formatSQLiteTime(*opts.UpdatedTo))
+	}
+	if opts.LastLoginBefore != nil {
+		where = append(where, "(last_login_at IS NULL OR last_login_at < ?)")
+		args = append(args, formatSQLiteTime(*opts.LastLoginBefore))
+	}
+	if opts.LastLoginAfter != nil {
+		where = append(where, "last_login_at > ?")
+		args = append(args, formatSQLiteTime(*opts.LastLoginAfter))
+	}
+	if opts.PasswordChangedBefore != nil {
+		where = append(where, "(password_changed_at IS NULL OR password_changed_at < ?)")
+		args = append(args, formatSQLiteTime(*opts.PasswordChangedBefore))
+	}
+
+	sortCol := "email_key"
+	if opts.SortBy == SortByCreatedAt {
+		sortCol = "created_at"
+	}
+	direction, comparison := "ASC", ">"
+	if opts.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		position, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return UserPage{}, err
+		}
+		if _, err := uuid.Parse(position["id"]); err != nil {
+			return UserPage{}, errs.ErrInvalidCursor
+		}
+		where = append(where, "("+sortCol+", id) "+comparison+" (?, ?)")
+		args = append(args, position[sortCol], position["id"])
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY " + sortCol + " " + direction + ", id " + direction
+	if opts.Limit > 0 {
+		// One extra row tells whether another page exists
+		query += " LIMIT ?"
+		args = append(args, opts.Limit+1)
+	}
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return UserPage{}, err
+	}
+	defer rows.Close()
+
+	page := UserPage{Users: []*model.User{}}
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return UserPage{}, err
+		}
+		page.Users = append(page.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return UserPage{}, err
+	}
+
+	if opts.Limit > 0 && len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+		last := page.Users[len(page.Users)-1]
+		position := map[string]string{"id": last.ID.String(), "email_key": last.EmailKey}
+		if sortCol == "created_at" {
+			position = map[string]string{"id": last.ID.String(), "created_at": formatSQLiteTime(last.CreatedAt)}
+		}
+		page.NextCursor = encodeCursor(position)
+	}
+
+	return page, nil
+}
+
+func (ur *UserRepositorySQLite) FindById(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	row := ur.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id.String())
+	user, err := scanSQLiteUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (ur *UserRepositorySQLite) FindByEmail(ctx context.Context, tenantID uuid.UUID, email string) (*model.User, error) {
+	row := ur.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE tenant_id = ? AND email_key = ?", tenantID.String(), email)
+	user, err := scanSQLiteUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (ur *UserRepositorySQLite) Create(ctx context.Context, user model.User) error {
+	updatedAt := now()
+	createdAt := user.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = updatedAt
+	}
+	roles, err := json.Marshal(helpers.GetRoleNames(user.Roles))
+	if err != nil {
+		return err
+	}
+	profile, err := json.Marshal(user.Profile)
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.db.ExecContext(ctx,
+		"INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)",
+		user.ID.String(), user.TenantID.String(), user.Email, emailKeyOf(user), user.HashedPassword, string(roles), user.IsActive, user.IsVerified,
+		formatSQLiteTime(createdAt), formatSQLiteTime(updatedAt), nullSQLiteTime(user.LastLoginAt), nullSQLiteTime(user.PasswordChangedAt),
+		nullSQLiteTime(deactivatedAt(user, time.Time{})), nullSQLiteTime(erasedAt(user, time.Time{})), string(profile),
+	)
+	if isSQLiteUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	return err
+}
+
+// An empty email or unset PasswordChangedAt keeps the stored value, as in the DynamoDB repository.
+// DeactivatedAt follows IsActive, see deactivatedAt; ErasedAt is never cleared.
+// Only matches the row at the caller's version, and bumps it.
+func (ur *UserRepositorySQLite) Update(ctx context.Context, user model.User) error {
+	roles, err := json.Marshal(helpers.GetRoleNames(user.Roles))
+	if err != nil {
+		return err
+	}
+	profile, err := json.Marshal(user.Profile)
+	if err != nil {
+		return err
+	}
+
+	res, err := ur.db.ExecContext(ctx,
+		`UPDATE users SET
+			email = COALESCE(NULLIF(?, ''), email),
+			email_key = COALESCE(NULLIF(?, ''), email_key),
+			hashed_password = ?,
+			roles = ?,
+			is_active = ?,
+			is_verified = ?,
+			password_changed_at = COALESCE(?, password_changed_at),
+			deactivated_at = CASE WHEN ? THEN NULL ELSE COALESCE(?, deactivated_at, ?) END,
+			erased_at = COALESCE(erased_at, ?),
+			profile = ?,
+			updated_at = ?,
+			version = version + 1
+		WHERE id = ? AND version = ?`,
+		user.Email, user.EmailKey, user.HashedPassword, string(roles), user.IsActive, user.IsVerified,
+		nullSQLiteTime(user.PasswordChangedAt), user.IsActive, nullSQLiteTime(user.DeactivatedAt), formatSQLiteTime(now()),
+		nullSQLiteTime(user.ErasedAt), string(profile), formatSQLiteTime(now()), user.ID.String(), user.Version,
+	)
+	if isSQLiteUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ur.updateConflict(ctx, user.ID)
+	}
+
+	return nil
+}
+
+func (ur *UserRepositorySQLite) updateConflict(ctx context.Context, id uuid.UUID) error {
+	current, err := ur.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errs.ErrNotFound
+	}
+	return errs.ErrConflict
+}
+
+func (ur *UserRepositorySQLite) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := ur.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id.String())
+	return err
+}
+
+func (ur *UserRepositorySQLite) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := ur.db.ExecContext(ctx, "UPDATE users SET last_login_at = ? WHERE id = ?", formatSQLiteTime(at), id.String())
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+func (ur *UserRepositorySQLite) FindDeactivatedBefore(ctx context.Context, before time.Time, limit int) ([]*model.User, error) {
+	rows, err := ur.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE NOT is_active AND erased_at IS NULL AND deactivated_at < ? ORDER BY deactivated_at LIMIT ?",
+		formatSQLiteTime(before), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanSQLiteUsers(rows)
+}
+
+// Same as the Postgres backfill.
+func (ur *UserRepositorySQLite) BackfillEmailKeys(ctx context.Context, key func(email string) string, dryRun bool) (EmailKeyBackfillReport, error) {
+	var report EmailKeyBackfillReport
+	claimed := map[userEmailKey]uuid.UUID{}
+
+	after := uuid.Nil
+	for {
+		rows, err := ur.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE id > ? ORDER BY id LIMIT ?", after.String(), emailKeyBackfillBatch)
+		if err != nil {
+			return report, err
+		}
+		users, err := scanSQLiteUsers(rows)
+		if err != nil {
+			return report, err
+		}
+
+		for _, user := range users {
+			report.Scanned++
+			newKey := key(user.Email)
+			if newKey == user.EmailKey {
+				continue
+			}
+
+			lookup := userEmailKey{tenantID: user.TenantID, email: newKey}
+			owner, ok := claimed[lookup]
+			if !ok {
+				holder, err := ur.FindByEmail(ctx, user.TenantID, newKey)
+				if err != nil {
+					return report, err
+				}
+				if holder != nil {
+					owner, ok = holder.ID, true
+				}
+			}
+			if ok && owner != user.ID {
+				report.Collisions = append(report.Collisions, user.ID)
+				continue
+			}
+			claimed[lookup] = user.ID
+
+			if dryRun {
+				report.Updated++
+				continue
+			}
+			err := ur.setEmailKey(ctx, *user, newKey)
+			if errors.Is(err, errs.ErrAlreadyExists) {
+				report.Collisions = append(report.Collisions, user.ID)
+				continue
+			}
+			if errors.Is(err, errs.ErrConflict) {
+				return report, fmt.Errorf("user %s changed during the backfill, run it again: %w", user.ID, err)
+			}
+			if err != nil {
+				return report, err
+			}
+			report.Updated++
+		}
+
+		if len(users) < emailKeyBackfillBatch {
+			return report, nil
+		}
+		after = users[len(users)-1].ID
+	}
+}
+
+// Helpers
+// Sets the key only if the user is unchanged since it was scanned.
+func (ur *UserRepositorySQLite) setEmailKey(ctx context.Context, user model.User, newKey string) error {
+	res, err := ur.db.ExecContext(ctx, "UPDATE users SET email_key = ? WHERE id = ? AND email = ? AND version = ?",
+		newKey, user.ID.String(), user.Email, user.Version)
+	if isSQLiteUniqueViolation(err) {
+		return errs.ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errs.ErrConflict
+	}
+	return nil
+}
+
+func scanSQLiteUsers(rows *sql.Rows) ([]*model.User, error) {
+	defer rows.Close()
+
+	users := make([]*model.User, 0)
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func scanSQLiteUser(row rowScanner) (*model.User, error) {
+	var user model.User
+	var id, tenantID, roles, createdAt, updatedAt, profile string
+	var lastLoginAt, passwordChangedAt, deactivatedAt, erasedAt sql.NullString
+	err := row.Scan(&id, &tenantID, &user.Email, &user.EmailKey, &user.HashedPassword, &roles, &user.IsActive, &user.IsVerified,
+		&createdAt, &updatedAt, &lastLoginAt, &passwordChangedAt, &deactivatedAt, &erasedAt, &profile, &user.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.ID, err = uuid.Parse(id); err != nil {
+		return nil, err
+	}
+	if user.TenantID, err = uuid.Parse(tenantID); err != nil {
+		return nil, err
+	}
+	if user.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt); err != nil {
+		return nil, err
+	}
+	if user.UpdatedAt, err = time.Parse(sqliteTimeLayout, updatedAt); err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		if user.LastLoginAt, err = time.Parse(sqliteTimeLayout, lastLoginAt.String); err != nil {
+			return nil, err
+		}
+	}
+	if passwordChangedAt.Valid {
+		if user.PasswordChangedAt, err = time.Parse(sqliteTimeLayout, passwordChangedAt.String); err != nil {
+			return nil, err
+		}
+	}
+	if deactivatedAt.Valid {
+		if user.DeactivatedAt, err = time.Parse(sqliteTimeLayout, deactivatedAt.String); err != nil {
+			return nil, err
+		}
+	}
+	if erasedAt.Valid {
+		if user.ErasedAt, err = time.Parse(sqliteTimeLayout, erasedAt.String); err != nil {
+			return nil, err
+		}
+	}
+
+	var roleNames []string
+	if err := json.Unmarshal([]byte(roles), &roleNames); err != nil {
+		return nil, err
+	}
+	if user.Roles, err = parseRoleNames(roleNames); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(profile), &user.Profile); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// Zero times are stored as NULL.
+func nullSQLiteTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return formatSQLiteTime(t)
+}
+
+// Covers both the email constraint and a reused primary key.
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/httpx/middleware"
+	"github.com/danilobml/user-manager/internal/user/bulkio"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/model"
+	passwordhasher "github.com/danilobml/user-manager/internal/user/password_hasher"
+	"github.com/danilobml/user-manager/internal/user/profile"
+	"github.com/danilobml/user-manager/internal/user/repository"
+)
+
+const exportPageSize = 500
+
+type BulkServiceImpl struct {
+	userRepository    repository.UserRepository
+	invitationService *InvitationServiceImpl
+	passwordHasher    passwordhasher.PasswordHasher
+	emailNormalizer   *emailnorm.Normalizer
+	profileSchemas    *profile.Schemas
+}
+
+func NewBulkServiceImpl(userRepository repository.UserRepository, invitationService *InvitationServiceImpl, emailNormalizer *emailnorm.Normalizer, profileSchemas *profile.Schemas) *BulkServiceImpl {
+	return &BulkServiceImpl{
+		userRepository:    userRepository,
+		invitationService: invitationService,
+		passwordHasher:    passwordhasher.NewPasswordHasher(),
+		emailNormalizer:   emailNormalizer,
+		profileSchemas:    profileSchemas,
+	}
+}
+
+// Admin only: imports into the admin's organization, granting only roles the admin holds
+func (bs *BulkServiceImpl) ImportUsers(ctx context.Context, rows bulkio.RowReader, opts dtos.ImportOptions) (dtos.ImportReport, error) {
+	if !isAdmin(ctx, bs.userRepository, bs.emailNormalizer) {
+		return dtos.ImportReport{}, errs.ErrUnauthorized
+	}
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+
+	canGrant := func(roles []model.Role) bool {
+		return canGrantRoles(ctx, roles)
+	}
+	return bs.importUsers(ctx, claims.TenantID, claims.Email, rows, opts, canGrant)
+}
+
+// Support and up, scoped to the caller's own organization and profile attributes they may read, like listing users
+func (bs *BulkServiceImpl) ExportUsers(ctx context.Context, write func(dtos.ResponseUser) error) error {
+	if !hasPermission(ctx, bs.userRepository, bs.emailNormalizer, model.PermReadUsers) {
+		return errs.ErrUnauthorized
+	}
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+
+	callerIsAdmin := isAdmin(ctx, bs.userRepository, bs.emailNormalizer)
+	viewer := func(user *model.User) profile.Viewer {
+		return profileViewerOf(ctx, bs.emailNormalizer, user, callerIsAdmin)
+	}
+	return bs.exportUsers(ctx, claims.TenantID, viewer, write)
+}
+
+// Not exposed: used by the bulk CLI, which may grant any role
+func (bs *BulkServiceImpl) ImportTenantUsers(ctx context.Context, tenantID uuid.UUID, invitedBy string, rows bulkio.RowReader, opts dtos.ImportOptions) (dtos.ImportReport, error) {
+	canGrant := func(roles []model.Role) bool {
+		return true
+	}
+	return bs.importUsers(ctx, tenantID, invitedBy, rows, opts, canGrant)
+}
+
+// Not exposed: streams every user of the tenant, oldest first, with the whole profile
+func (bs *BulkServiceImpl) ExportTenantUsers(ctx context.Context, tenantID uuid.UUID, write func(dtos.ResponseUser) error) error {
+	viewer := func(*model.User) profile.Viewer {
+		return profile.ViewerAdmin
+	}
+	return bs.exportUsers(ctx, tenantID, viewer, write)
+}
+
+func (bs *BulkServiceImpl) exportUsers(ctx context.Context, tenantID uuid.UUID, viewer func(*model.User) profile.Viewer, write func(dtos.ResponseUser) error) error {
+	cursor := ""
+	for {
+		page, err := bs.userRepository.List(ctx, repository.UserListOptions{
+			TenantID: tenantID,
+			Limit:    exportPageSize,
+			Cursor:   cursor,
+			SortBy:   repository.SortByCreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, user := range page.Users {
+			if err := write(visibleResponseUser(bs.profileSchemas, user, viewer(user))); err != nil {
+				return err
+			}
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// Rows are handled one at a time, so a bad row is reported and the rest still go in. Users that already exist,
+// or are already invited, are skipped: running the same file again is safe.
+func (bs *BulkServiceImpl) importUsers(ctx context.Context, tenantID uuid.UUID, invitedBy string, rows bulkio.RowReader, opts dtos.ImportOptions, canGrant func([]model.Role) bool) (dtos.ImportReport, error) {
+	report := dtos.ImportReport{DryRun: opts.DryRun, Rows: make([]dtos.ImportRowResult, 0)}
+
+	invited := map[string]bool{}
+	if opts.Invite {
+		var err error
+		invited, err = bs.invitationService.pendingEmailKeys(ctx, tenantID)
+		if err != nil {
+			return report, err
+		}
+	}
+	seen := map[string]int{}
+	passwords := 0
+
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		var rowErr *bulkio.RowError
+		if errors.As(err, &rowErr) {
+			addImportResult(&report, dtos.ImportRowResult{Line: rowErr.Line, Status: dtos.ImportInvalid, Error: rowErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		addImportResult(&report, bs.importRow(ctx, tenantID, invitedBy, row, opts, canGrant, seen, invited, &passwords))
+	}
+}
+
+// passwords counts the rows hashed so far, for opts.MaxPasswords.
+func (bs *BulkServiceImpl) importRow(ctx context.Context, tenantID uuid.UUID, invitedBy string, row dtos.ImportUserRow, opts dtos.ImportOptions, canGrant func([]model.Role) bool, seen map[string]int, invited map[string]bool, passwords *int) dtos.ImportRowResult {
+	result := dtos.ImportRowResult{Line: row.Line, Email: row.Email}
+	finish := func(status string, err error) dtos.ImportRowResult {
+		result.Status = status
+		if err != nil {
+			result.Error = err.Error()
+		}
+		var validationErr *errs.ValidationError
+		if errors.As(err, &validationErr) {
+			result.Errors = validationErr.Fields
+		}
+		return result
+	}
+
+	inviting := opts.Invite && row.Password == ""
+	var err error
+	if inviting {
+		err = helpers.ValidateStruct(dtos.CreateInvitationRequest{Email: row.Email, Roles: row.Roles})
+	} else {
+		err = helpers.ValidateStruct(dtos.RegisterRequest{TenantID: tenantID, Email: row.Email, Password: row.Password})
+	}
+	if err != nil {
+		return finish(dtos.ImportInvalid, err)
+	}
+
+	roles, err := helpers.ParseRoles(row.Roles)
+	if err != nil {
+		return finish(dtos.ImportInvalid, err)
+	}
+	if len(roles) == 0 {
+		roles = []model.Role{model.DefaultRole}
+	}
+	if !canGrant(roles) {
+		return finish(dtos.ImportInvalid, fmt.Errorf("%w: can't grant roles you don't hold", errs.ErrUnauthorized))
+	}
+
+	key := bs.emailNormalizer.Key(row.Email)
+	if line, ok := seen[key]; ok {
+		return finish(dtos.ImportSkipped, fmt.Errorf("same email as line %d", line))
+	}
+	seen[key] = row.Line
+
+	existing, err := bs.userRepository.FindByEmail(ctx, tenantID, key)
+	if err != nil {
+		return finish(dtos.ImportFailed, err)
+	}
+	if existing != nil {
+		return finish(dtos.ImportSkipped, errs.ErrAlreadyExists)
+	}
+
+	if inviting {
+		if invited[key] {
+			return finish(dtos.ImportSkipped, errors.New("already invited"))
+		}
+		if !opts.DryRun {
+			if _, err := bs.invitationService.invite(ctx, tenantID, row.Email, roles, invitedBy); err != nil {
+				return finish(dtos.ImportFailed, err)
+			}
+		}
+		return finish(dtos.ImportInvited, nil)
+	}
+
+	// Users skipped above don't count, so importing the same file again picks up where the limit stopped it
+	if opts.MaxPasswords > 0 && *passwords >= opts.MaxPasswords {
+		return finish(dtos.ImportSkipped, fmt.Errorf("only %d rows with a password are created per request, import the file again for the rest", opts.MaxPasswords))
+	}
+	*passwords++
+
+	if opts.DryRun {
+		return finish(dtos.ImportCreated, nil)
+	}
+	hashedPassword, err := bs.passwordHasher.HashPassword(row.Password)
+	if err != nil {
+		return finish(dtos.ImportFailed, err)
+	}
+	now := time.Now().UTC()
+	err = bs.userRepository.Create(ctx, model.User{
+		ID:                uuid.New(),
+		TenantID:          tenantID,
+		Email:             bs.emailNormalizer.Display(row.Email),
+		EmailKey:          key,
+		HashedPassword:    hashedPassword,
+		Roles:             roles,
+		IsActive:          true,
+		CreatedAt:         now,
+		PasswordChangedAt: now,
+	})
+	if errors.Is(err, errs.ErrAlreadyExists) {
+		return finish(dtos.ImportSkipped, err)
+	}
+	if err != nil {
+		return finish(dtos.ImportFailed, err)
+	}
+	return finish(dtos.ImportCreated, nil)
+}
+
+// Helper
+func addImportResult(report *dtos.ImportReport, result dtos.ImportRowResult) {
+	switch result.Status {
+	case dtos.ImportCreated:
+		report.Created++
+	case dtos.ImportInvited:
+		report.Invited++
+	case dtos.ImportSkipped:
+		report.Skipped++
+	case dtos.ImportInvalid:
+		report.Invalid++
+	case dtos.ImportFailed:
+		report.Failed++
+	}
+	report.Rows = append(report.Rows, result)
+}
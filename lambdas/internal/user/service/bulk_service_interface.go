@@ -0,0 +1,13 @@
+package service
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/user/bulkio"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+)
+
+type BulkService interface {
+	ImportUsers(ctx context.Context, rows bulkio.RowReader, opts dtos.ImportOptions) (dtos.ImportReport, error)
+	ExportUsers(ctx context.Context, write func(dtos.ResponseUser) error) error
+}
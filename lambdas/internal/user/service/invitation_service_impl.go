@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
+	"github.com/danilobml/user-manager/internal/httpx/middleware"
+	mailer "github.com/danilobml/user-manager/internal/mailer/service"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/model"
+	passwordhasher "github.com/danilobml/user-manager/internal/user/password_hasher"
+	"github.com/danilobml/user-manager/internal/user/repository"
+
+	"github.com/google/uuid"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+type InvitationServiceImpl struct {
+	invitationRepository   repository.InvitationRepository
+	organizationRepository repository.OrganizationRepository
+	userRepository         repository.UserRepository
+	jwtManager             *jwt.JwtManager
+	passwordHasher         passwordhasher.PasswordHasher
+	emailService           mailer.Mailer
+	baseUrl                string
+	emailNormalizer        *emailnorm.Normalizer
+}
+
+func NewInvitationServiceImpl(invitationRepository repository.InvitationRepository, organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, jwtManager *jwt.JwtManager, emailService mailer.Mailer, baseUrl string, emailNormalizer *emailnorm.Normalizer) *InvitationServiceImpl {
+	return &InvitationServiceImpl{
+		invitationRepository:   invitationRepository,
+		organizationRepository: organizationRepository,
+		userRepository:         userRepository,
+		jwtManager:             jwtManager,
+		passwordHasher:         passwordhasher.NewPasswordHasher(),
+		emailService:           emailService,
+		baseUrl:                baseUrl,
+		emailNormalizer:        emailNormalizer,
+	}
+}
+
+// Admin only, into the admin's own organization. Platform admins may invite into any organization, which is
+// how organizations other than the default get their users.
+func (is *InvitationServiceImpl) CreateInvitation(ctx context.Context, createInvitationReq dtos.CreateInvitationRequest) (dtos.ResponseInvitation, error) {
+	if !isAdmin(ctx, is.userRepository, is.emailNormalizer) {
+		return dtos.ResponseInvitation{}, errs.ErrUnauthorized
+	}
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+
+	tenantID := claims.TenantID
+	if createInvitationReq.TenantID != nil && *createInvitationReq.TenantID != claims.TenantID {
+		if !isPlatformAdmin(ctx, is.userRepository, is.emailNormalizer) {
+			return dtos.ResponseInvitation{}, errs.ErrUnauthorized
+		}
+		tenantID = *createInvitationReq.TenantID
+		if tenantID != model.DefaultTenantID {
+			org, err := is.organizationRepository.FindById(ctx, tenantID)
+			if err != nil {
+				return dtos.ResponseInvitation{}, err
+			}
+			if org == nil {
+				return dtos.ResponseInvitation{}, errs.ErrNotFound
+			}
+		}
+	}
+
+	existingUser, _ := is.userRepository.FindByEmail(ctx, tenantID, is.emailNormalizer.Key(createInvitationReq.Email))
+	if existingUser != nil {
+		return dtos.ResponseInvitation{}, errs.ErrAlreadyExists
+	}
+
+	parsedRoles, err := helpers.ParseRoles(createInvitationReq.Roles)
+	if err != nil {
+		return dtos.ResponseInvitation{}, err
+	}
+	if len(parsedRoles) == 0 {
+		parsedRoles = []model.Role{model.DefaultRole}
+	}
+	if !canGrantRoles(ctx, parsedRoles) {
+		return dtos.ResponseInvitation{}, errs.ErrUnauthorized
+	}
+
+	invitation, err := is.invite(ctx, tenantID, createInvitationReq.Email, parsedRoles, claims.Email)
+	if err != nil {
+		return dtos.ResponseInvitation{}, err
+	}
+
+	return toResponseInvitation(invitation), nil
+}
+
+// Admin only, scoped to the admin's own organization
+func (is *InvitationServiceImpl) ListInvitations(ctx context.Context) (dtos.GetAllInvitationsResponse, error) {
+	if !isAdmin(ctx, is.userRepository, is.emailNormalizer) {
+		return dtos.GetAllInvitationsResponse{}, errs.ErrUnauthorized
+	}
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+
+	invitations, err := is.invitationRepository.List(ctx, claims.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	respInvitations := make(dtos.GetAllInvitationsResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		respInvitations = append(respInvitations, toResponseInvitation(*invitation))
+	}
+
+	return respInvitations, nil
+}
+
+// Admin only
+func (is *InvitationServiceImpl) RevokeInvitation(ctx context.Context, id uuid.UUID) error {
+	if !isAdmin(ctx, is.userRepository, is.emailNormalizer) {
+		return errs.ErrUnauthorized
+	}
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+
+	invitation, err := is.invitationRepository.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if invitation == nil || invitation.TenantID != claims.TenantID {
+		return errs.ErrNotFound
+	}
+
+	if invitation.CurrentStatus(time.Now()) != model.InvitationPending {
+		return errs.ErrInvalidInvitation
+	}
+
+	revokedInvitation := *invitation
+	revokedInvitation.Status = model.InvitationRevoked
+
+	return is.invitationRepository.Update(ctx, revokedInvitation)
+}
+
+// Public: the signed token proves the invitee received the email, so the account starts verified.
+func (is *InvitationServiceImpl) AcceptInvitation(ctx context.Context, acceptInvitationReq dtos.AcceptInvitationRequest) (dtos.AcceptInvitationResponse, error) {
+	invitationID, err := is.jwtManager.VerifyInviteToken(acceptInvitationReq.Token)
+	if err != nil {
+		return dtos.AcceptInvitationResponse{}, errs.ErrInvalidInvitation
+	}
+	id, err := uuid.Parse(invitationID)
+	if err != nil {
+		return dtos.AcceptInvitationResponse{}, errs.ErrInvalidInvitation
+	}
+
+	invitation, err := is.invitationRepository.FindById(ctx, id)
+	if err != nil || invitation == nil {
+		return dtos.AcceptInvitationResponse{}, errs.ErrInvalidInvitation
+	}
+
+	if invitation.CurrentStatus(time.Now()) != model.InvitationPending {
+		return dtos.AcceptInvitationResponse{}, errs.ErrInvalidInvitation
+	}
+
+	hashedPassword, err := is.passwordHasher.HashPassword(acceptInvitationReq.Password)
+	if err != nil {
+		return dtos.AcceptInvitationResponse{}, err
+	}
+
+	now := time.Now().UTC()
+	user := model.User{
+		ID:                uuid.New(),
+		TenantID:          invitation.TenantID,
+		Email:             is.emailNormalizer.Display(invitation.Email),
+		EmailKey:          is.emailNormalizer.Key(invitation.Email),
+		HashedPassword:    hashedPassword,
+		Roles:             invitation.Roles,
+		IsActive:          true,
+		IsVerified:        true,
+		CreatedAt:         now,
+		PasswordChangedAt: now,
+	}
+	err = is.userRepository.Create(ctx, user)
+	if err != nil {
+		return dtos.AcceptInvitationResponse{}, err
+	}
+
+	acceptedInvitation := *invitation
+	acceptedInvitation.Status = model.InvitationAccepted
+	err = is.invitationRepository.Update(ctx, acceptedInvitation)
+	if err != nil {
+		return dtos.AcceptInvitationResponse{}, err
+	}
+
+	token, err := is.jwtManager.CreateToken(user)
+	if err != nil {
+		return dtos.AcceptInvitationResponse{}, err
+	}
+
+	return dtos.AcceptInvitationResponse{Token: token}, nil
+}
+
+// Helpers
+// Also used by bulk imports.
+func (is *InvitationServiceImpl) invite(ctx context.Context, tenantID uuid.UUID, email string, roles []model.Role, invitedBy string) (model.Invitation, error) {
+	invitation := model.Invitation{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Email:     email,
+		Roles:     roles,
+		Status:    model.InvitationPending,
+		InvitedBy: invitedBy,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+	err := is.invitationRepository.Create(ctx, invitation)
+	if err != nil {
+		return model.Invitation{}, err
+	}
+
+	token, err := is.jwtManager.CreateInviteToken(invitation.ID.String(), invitation.ExpiresAt)
+	if err != nil {
+		return model.Invitation{}, err
+	}
+
+	link := fmt.Sprintf("%s/accept-invitation?token=%s", is.baseUrl, token)
+	subject := "You have been invited"
+	body := fmt.Sprintf("%s invited you to join. Click the link below to set your password and activate your account:\r\n\r\n%s\r\n\r\nThis link expires in 7 days.", invitation.InvitedBy, link)
+
+	// The invitation stays listable and revocable even if the email can't be sent.
+	if err := is.emailService.SendMail([]string{invitation.Email}, subject, body); err != nil {
+		log.Println("Error sending email: ", err)
+	}
+
+	return invitation, nil
+}
+
+// Normalized emails of the tenant's pending invitations.
+func (is *InvitationServiceImpl) pendingEmailKeys(ctx context.Context, tenantID uuid.UUID) (map[string]bool, error) {
+	invitations, err := is.invitationRepository.List(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	keys := make(map[string]bool, len(invitations))
+	for _, invitation := range invitations {
+		if invitation.CurrentStatus(now) == model.InvitationPending {
+			keys[is.emailNormalizer.Key(invitation.Email)] = true
+		}
+	}
+	return keys, nil
+}
+
+func toResponseInvitation(invitation model.Invitation) dtos.ResponseInvitation {
+	return dtos.ResponseInvitation{
+		ID:        invitation.ID,
+		TenantID:  invitation.TenantID,
+		Email:     invitation.Email,
+		Roles:     helpers.GetRoleNames(invitation.Roles),
+		Status:    string(invitation.CurrentStatus(time.Now())),
+		InvitedBy: invitation.InvitedBy,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/google/uuid"
+)
+
+type InvitationService interface {
+	CreateInvitation(ctx context.Context, createInvitationReq dtos.CreateInvitationRequest) (dtos.ResponseInvitation, error)
+	ListInvitations(ctx context.Context) (dtos.GetAllInvitationsResponse, error)
+	RevokeInvitation(ctx context.Context, id uuid.UUID) error
+	AcceptInvitation(ctx context.Context, acceptInvitationReq dtos.AcceptInvitationRequest) (dtos.AcceptInvitationResponse, error)
+}
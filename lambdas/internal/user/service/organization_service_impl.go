@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/repository"
+
+	"github.com/google/uuid"
+)
+
+type OrganizationServiceImpl struct {
+	organizationRepository repository.OrganizationRepository
+	userRepository         repository.UserRepository
+	emailNormalizer        *emailnorm.Normalizer
+}
+
+func NewOrganizationServiceImpl(organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, emailNormalizer *emailnorm.Normalizer) *OrganizationServiceImpl {
+	return &OrganizationServiceImpl{
+		organizationRepository: organizationRepository,
+		userRepository:         userRepository,
+		emailNormalizer:        emailNormalizer,
+	}
+}
+
+// Platform admin only
+func (ors *OrganizationServiceImpl) CreateOrganization(ctx context.Context, createOrgReq dtos.CreateOrganizationRequest) (dtos.CreateOrganizationResponse, error) {
+	if !isPlatformAdmin(ctx, ors.userRepository, ors.emailNormalizer) {
+		return dtos.CreateOrganizationResponse{}, errs.ErrUnauthorized
+	}
+
+	org := model.Organization{
+		ID:   uuid.New(),
+		Name: createOrgReq.Name,
+	}
+	err := ors.organizationRepository.Create(ctx, org)
+	if err != nil {
+		return dtos.CreateOrganizationResponse{}, err
+	}
+
+	return org, nil
+}
+
+// Platform admin only
+func (ors *OrganizationServiceImpl) ListAllOrganizations(ctx context.Context) (dtos.GetAllOrganizationsResponse, error) {
+	if !isPlatformAdmin(ctx, ors.userRepository, ors.emailNormalizer) {
+		return dtos.GetAllOrganizationsResponse{}, errs.ErrUnauthorized
+	}
+
+	orgs, err := ors.organizationRepository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	respOrgs := make(dtos.GetAllOrganizationsResponse, 0, len(orgs))
+	for _, org := range orgs {
+		respOrgs = append(respOrgs, *org)
+	}
+
+	return respOrgs, nil
+}
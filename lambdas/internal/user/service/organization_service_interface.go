@@ -0,0 +1,12 @@
+package service
+
+import (
+	"context"
+
+	"github.com/danilobml/user-manager/internal/user/dtos"
+)
+
+type OrganizationService interface {
+	CreateOrganization(ctx context.Context, createOrgReq dtos.CreateOrganizationRequest) (dtos.CreateOrganizationResponse, error)
+	ListAllOrganizations(ctx context.Context) (dtos.GetAllOrganizationsResponse, error)
+}
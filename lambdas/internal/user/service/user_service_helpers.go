@@ -2,45 +2,295 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
 
+	"github.com/danilobml/user-manager/internal/errs"
+	"github.com/danilobml/user-manager/internal/helpers"
 	"github.com/danilobml/user-manager/internal/httpx/middleware"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/model"
+	"github.com/danilobml/user-manager/internal/user/profile"
+	"github.com/danilobml/user-manager/internal/user/repository"
+	"github.com/google/uuid"
 )
 
 // Helpers
-func (us *UserServiceImpl) IsUserOwner(ctx context.Context, userEmail string) bool {
-	_, err := us.userRepository.FindByEmail(ctx, userEmail)
-	if err != nil {
+// Decided from the token alone; callers have already loaded the user.
+func (us *UserServiceImpl) IsUserOwner(ctx context.Context, user *model.User) bool {
+	return isOwner(ctx, us.emailNormalizer, user)
+}
+
+func isOwner(ctx context.Context, emailNormalizer *emailnorm.Normalizer, user *model.User) bool {
+	claims, ok := middleware.GetClaimsFromContext(ctx)
+	if !ok {
 		return false
 	}
 
+	return claims.TenantID == user.TenantID && emailNormalizer.Key(claims.Email) == emailNormalizer.Key(user.Email) &&
+		subjectMatches(claims, user)
+}
+
+func (us *UserServiceImpl) IsUserAdmin(ctx context.Context) bool {
+	return isAdmin(ctx, us.userRepository, us.emailNormalizer)
+}
+
+// Tokens carry the display email, so the caller is looked up by its normalized key.
+func findCaller(ctx context.Context, userRepository repository.UserRepository, emailNormalizer *emailnorm.Normalizer, claims *jwt.Claims) (*model.User, error) {
+	user, err := userRepository.FindByEmail(ctx, claims.TenantID, emailNormalizer.Key(claims.Email))
+	if err != nil || user == nil || !subjectMatches(claims, user) {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Tokens issued before subjects were added have none and fall back to the email alone.
+func subjectMatches(claims *jwt.Claims, user *model.User) bool {
+	return claims.Subject == "" || claims.Subject == user.ID.String()
+}
+
+// Checks the caller still exists and holds the permission resolved by the authentication middleware.
+func hasPermission(ctx context.Context, userRepository repository.UserRepository, emailNormalizer *emailnorm.Normalizer, permission model.Permission) bool {
 	claims, ok := middleware.GetClaimsFromContext(ctx)
 	if !ok {
 		return false
 	}
 
-	if claims.Email != userEmail {
+	user, err := findCaller(ctx, userRepository, emailNormalizer, claims)
+	if err != nil || user == nil {
 		return false
 	}
 
-	return true
+	permissions, ok := middleware.GetPermissionsFromContext(ctx)
+	return ok && permissions.Has(permission)
 }
 
-func (us *UserServiceImpl) IsUserAdmin(ctx context.Context) bool {
+// Shared by every service that restricts operations to admins (or higher) of the caller's tenant.
+func isAdmin(ctx context.Context, userRepository repository.UserRepository, emailNormalizer *emailnorm.Normalizer) bool {
+	return hasPermission(ctx, userRepository, emailNormalizer, model.PermManageUsers)
+}
+
+// Super-admins of the default tenant may act across organizations.
+func isPlatformAdmin(ctx context.Context, userRepository repository.UserRepository, emailNormalizer *emailnorm.Normalizer) bool {
 	claims, ok := middleware.GetClaimsFromContext(ctx)
+	if !ok || claims.TenantID != model.DefaultTenantID {
+		return false
+	}
+
+	return hasPermission(ctx, userRepository, emailNormalizer, model.PermManageOrganizations)
+}
+
+// Callers may only hand out (or take away) roles whose permissions they hold themselves.
+func canGrantRoles(ctx context.Context, roles []model.Role) bool {
+	permissions, ok := middleware.GetPermissionsFromContext(ctx)
 	if !ok {
 		return false
 	}
 
-	_, err := us.userRepository.FindByEmail(ctx, claims.Email)
-	if err != nil {
+	return permissions.Covers(model.DefaultRoleHierarchy.EffectivePermissions(roles))
+}
+
+// Users of other organizations are reported as not found, so tenants can't probe each other's IDs.
+func (us *UserServiceImpl) IsSameTenant(ctx context.Context, user *model.User) bool {
+	if user == nil {
 		return false
 	}
 
-	for _, role := range claims.Roles {
-		if role.GetName() == "admin" {
-			return true
+	claims, ok := middleware.GetClaimsFromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	return claims.TenantID == user.TenantID
+}
+
+// Users can't change their own roles, but may send them back unchanged; admins change roles they can grant.
+func checkRoleChange(ctx context.Context, user *model.User, roles []model.Role, callerIsAdmin bool) error {
+	if !callerIsAdmin {
+		if !sameRoles(user.Roles, roles) {
+			return errs.ErrUnauthorized
 		}
+		return nil
+	}
+	if !canGrantRoles(ctx, user.Roles) || !canGrantRoles(ctx, roles) {
+		return errs.ErrUnauthorized
+	}
+	return nil
+}
+
+// Order and repeats don't matter.
+func sameRoles(a, b []model.Role) bool {
+	return slices.Equal(slices.Compact(slices.Sorted(slices.Values(a))), slices.Compact(slices.Sorted(slices.Values(b))))
+}
+
+// A nil expected version means the client sent no If-Match.
+func versionMatches(user *model.User, expectedVersion *int64) bool {
+	return expectedVersion == nil || *expectedVersion == user.Version
+}
+
+const defaultListLimit = 50
+
+// Maps validated query params onto repository options, always scoped to one tenant
+func listOptionsFromRequest(tenantID uuid.UUID, listUsersReq dtos.ListUsersRequest) (repository.UserListOptions, error) {
+	opts := repository.UserListOptions{
+		TenantID:    tenantID,
+		Limit:       listUsersReq.Limit,
+		Cursor:      listUsersReq.Cursor,
+		IsActive:    listUsersReq.Active,
+		EmailPrefix: emailnorm.Fold(listUsersReq.EmailPrefix),
+		SortBy:      repository.SortByEmail,
+		SortDesc:    listUsersReq.Order == "desc",
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultListLimit
+	}
+	if listUsersReq.Sort == repository.SortByCreatedAt {
+		opts.SortBy = repository.SortByCreatedAt
 	}
 
-	return false
+	if listUsersReq.Role != "" {
+		role, err := model.ParseRole(listUsersReq.Role)
+		if err != nil {
+			return repository.UserListOptions{}, err
+		}
+		opts.Role = &role
+	}
+
+	timeFilters := []struct {
+		value  string
+		target **time.Time
+	}{
+		{listUsersReq.CreatedFrom, &opts.CreatedFrom},
+		{listUsersReq.CreatedTo, &opts.CreatedTo},
+		{listUsersReq.UpdatedFrom, &opts.UpdatedFrom},
+		{listUsersReq.UpdatedTo, &opts.UpdatedTo},
+		{listUsersReq.LastLoginBefore, &opts.LastLoginBefore},
+		{listUsersReq.LastLoginAfter, &opts.LastLoginAfter},
+		{listUsersReq.PasswordChangedBefore, &opts.PasswordChangedBefore},
+	}
+	for _, f := range timeFilters {
+		if f.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, f.value)
+		if err != nil {
+			return repository.UserListOptions{}, err
+		}
+		*f.target = &parsed
+	}
+	if listUsersReq.InactiveDays > 0 {
+		cutoff := time.Now().UTC().AddDate(0, 0, -listUsersReq.InactiveDays)
+		opts.LastLoginBefore = &cutoff
+	}
+
+	lastLoginBefore := "last_login_before"
+	if listUsersReq.InactiveDays > 0 {
+		lastLoginBefore = "inactive_days"
+	}
+	ranges := []struct {
+		from, to         *time.Time
+		fromName, toName string
+	}{
+		{opts.CreatedFrom, opts.CreatedTo, "created_from", "created_to"},
+		{opts.UpdatedFrom, opts.UpdatedTo, "updated_from", "updated_to"},
+		{opts.LastLoginAfter, opts.LastLoginBefore, "last_login_after", lastLoginBefore},
+	}
+	for _, r := range ranges {
+		if isInvalidRange(r.from, r.to) {
+			return repository.UserListOptions{}, fmt.Errorf("%w: %s must not be after %s", errs.ErrInvalidDateRange, r.fromName, r.toName)
+		}
+	}
+
+	return opts, nil
+}
+
+func isInvalidRange(from, to *time.Time) bool {
+	return from != nil && to != nil && from.After(*to)
+}
+
+// Unique per user, so it still satisfies the email uniqueness constraint, and undeliverable (RFC 2606).
+func erasedEmail(id uuid.UUID) string {
+	return "erased-" + id.String() + "@erased.invalid"
+}
+
+// How the caller relates to the user, which decides the profile fields they see and may edit.
+func (us *UserServiceImpl) profileViewer(ctx context.Context, user *model.User, callerIsAdmin bool) profile.Viewer {
+	return profileViewerOf(ctx, us.emailNormalizer, user, callerIsAdmin)
+}
+
+func profileViewerOf(ctx context.Context, emailNormalizer *emailnorm.Normalizer, user *model.User, callerIsAdmin bool) profile.Viewer {
+	switch {
+	case callerIsAdmin:
+		return profile.ViewerAdmin
+	case isOwner(ctx, emailNormalizer, user):
+		return profile.ViewerSelf
+	default:
+		return profile.ViewerOther
+	}
+}
+
+func (us *UserServiceImpl) responseUserFor(user *model.User, viewer profile.Viewer) dtos.ResponseUser {
+	return visibleResponseUser(us.profileSchemas, user, viewer)
+}
+
+// The user with only the profile attributes the viewer may read.
+func visibleResponseUser(profileSchemas *profile.Schemas, user *model.User, viewer profile.Viewer) dtos.ResponseUser {
+	resp := newResponseUser(user)
+	resp.Profile = profileSchemas.For(user.TenantID).Visible(user.Profile, viewer)
+	return resp
+}
+
+// Fields the request leaves out keep their value; an empty string or a null attribute clears one.
+func mergeProfile(stored model.Profile, updateProfileReq dtos.UpdateProfileRequest) model.Profile {
+	merged := stored
+	if updateProfileReq.DisplayName != nil {
+		merged.DisplayName = *updateProfileReq.DisplayName
+	}
+	if updateProfileReq.Locale != nil {
+		merged.Locale = *updateProfileReq.Locale
+	}
+	if updateProfileReq.Timezone != nil {
+		merged.Timezone = *updateProfileReq.Timezone
+	}
+	if updateProfileReq.AvatarURL != nil {
+		merged.AvatarURL = *updateProfileReq.AvatarURL
+	}
+
+	merged.Attributes = maps.Clone(stored.Attributes)
+	for name, value := range updateProfileReq.Attributes {
+		if merged.Attributes == nil {
+			merged.Attributes = map[string]any{}
+		}
+		if value == nil {
+			delete(merged.Attributes, name)
+			continue
+		}
+		merged.Attributes[name] = value
+	}
+
+	return merged
+}
+
+// Everything stored, for admins and data exports; see responseUserFor for what other callers get.
+func newResponseUser(user *model.User) dtos.ResponseUser {
+	return dtos.ResponseUser{
+		ID:                user.ID,
+		TenantID:          user.TenantID,
+		Email:             user.Email,
+		Roles:             helpers.GetRoleNames(user.Roles),
+		IsActive:          user.IsActive,
+		IsVerified:        user.IsVerified,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+		LastLoginAt:       user.LastLoginAt,
+		PasswordChangedAt: user.PasswordChangedAt,
+		DeactivatedAt:     user.DeactivatedAt,
+		ErasedAt:          user.ErasedAt,
+		Profile:           user.Profile,
+		Version:           user.Version,
+	}
 }
@@ -2,65 +2,92 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/danilobml/user-manager/internal/errs"
 	"github.com/danilobml/user-manager/internal/helpers"
 	"github.com/danilobml/user-manager/internal/httpx/middleware"
 	mailer "github.com/danilobml/user-manager/internal/mailer/service"
 	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
 	"github.com/danilobml/user-manager/internal/user/jwt"
 	"github.com/danilobml/user-manager/internal/user/model"
 	passwordhasher "github.com/danilobml/user-manager/internal/user/password_hasher"
+	"github.com/danilobml/user-manager/internal/user/profile"
 	"github.com/danilobml/user-manager/internal/user/repository"
 
 	"github.com/google/uuid"
 )
 
 type UserServiceImpl struct {
-	userRepository repository.UserRepository
-	jwtManager     *jwt.JwtManager
-	passwordHasher passwordhasher.PasswordHasher
-	emailService   mailer.Mailer
-	baseUrl        string
+	userRepository         repository.UserRepository
+	organizationRepository repository.OrganizationRepository
+	auditRepository        repository.AuditRepository
+	jwtManager             *jwt.JwtManager
+	passwordHasher         passwordhasher.PasswordHasher
+	emailService           mailer.Mailer
+	baseUrl                string
+	emailNormalizer        *emailnorm.Normalizer
+	lifecycle              Lifecycle
+	profileSchemas         *profile.Schemas
 }
 
-func NewUserserviceImpl(userRepository repository.UserRepository, jwtManager *jwt.JwtManager, emailService mailer.Mailer, baseUrl string) *UserServiceImpl {
+// Deactivated users can be restored for RestoreGracePeriod and are purged after PurgeRetention,
+// or after the grace period if that is longer.
+type Lifecycle struct {
+	RestoreGracePeriod time.Duration
+	PurgeRetention     time.Duration
+}
+
+func NewUserserviceImpl(userRepository repository.UserRepository, organizationRepository repository.OrganizationRepository, auditRepository repository.AuditRepository, jwtManager *jwt.JwtManager, emailService mailer.Mailer, baseUrl string, emailNormalizer *emailnorm.Normalizer, lifecycle Lifecycle, profileSchemas *profile.Schemas) *UserServiceImpl {
 	return &UserServiceImpl{
-		userRepository: userRepository,
-		jwtManager:     jwtManager,
-		passwordHasher: passwordhasher.NewPasswordHasher(),
-		emailService:   emailService,
-		baseUrl:        baseUrl,
+		userRepository:         userRepository,
+		organizationRepository: organizationRepository,
+		auditRepository:        auditRepository,
+		jwtManager:             jwtManager,
+		passwordHasher:         passwordhasher.NewPasswordHasher(),
+		emailService:           emailService,
+		baseUrl:                baseUrl,
+		emailNormalizer:        emailNormalizer,
+		lifecycle:              lifecycle,
+		profileSchemas:         profileSchemas,
 	}
 }
 
+// Public, so only into the default organization. Other organizations are joined by invitation.
 func (us *UserServiceImpl) Register(ctx context.Context, registerReq dtos.RegisterRequest) (dtos.RegisterResponse, error) {
+	if registerReq.TenantID != model.DefaultTenantID {
+		return dtos.RegisterResponse{}, errs.ErrUnauthorized
+	}
+
 	hashedPassword, err := us.passwordHasher.HashPassword(registerReq.Password)
 	if err != nil {
 		return dtos.RegisterResponse{}, err
 	}
 
 	id := uuid.New()
-	parsedRoles, err := helpers.ParseRoles(registerReq.Roles)
-	if err != nil {
-		return dtos.RegisterResponse{}, err
-	}
+	now := time.Now().UTC()
 
 	user := model.User{
-		ID:             id,
-		HashedPassword: hashedPassword,
-		Email:          registerReq.Email,
-		Roles:          parsedRoles,
-		IsActive:       true,
+		ID:                id,
+		TenantID:          registerReq.TenantID,
+		HashedPassword:    hashedPassword,
+		Email:             us.emailNormalizer.Display(registerReq.Email),
+		EmailKey:          us.emailNormalizer.Key(registerReq.Email),
+		Roles:             []model.Role{model.DefaultRole},
+		IsActive:          true,
+		CreatedAt:         now,
+		PasswordChangedAt: now,
 	}
 	err = us.userRepository.Create(ctx, user)
 	if err != nil {
 		return dtos.RegisterResponse{}, err
 	}
 
-	jwt, err := us.jwtManager.CreateToken(user.Email, user.Roles)
+	jwt, err := us.jwtManager.CreateToken(user)
 	if err != nil {
 		return dtos.RegisterResponse{}, err
 	}
@@ -71,7 +98,7 @@ func (us *UserServiceImpl) Register(ctx context.Context, registerReq dtos.Regist
 }
 
 func (us *UserServiceImpl) Login(ctx context.Context, loginReq dtos.LoginRequest) (dtos.LoginResponse, error) {
-	user, err := us.userRepository.FindByEmail(ctx, loginReq.Email)
+	user, err := us.userRepository.FindByEmail(ctx, loginReq.TenantID, us.emailNormalizer.Key(loginReq.Email))
 	if err != nil {
 		return dtos.LoginResponse{}, err
 	}
@@ -88,7 +115,12 @@ func (us *UserServiceImpl) Login(ctx context.Context, loginReq dtos.LoginRequest
 		return dtos.LoginResponse{}, errs.ErrInvalidCredentials
 	}
 
-	j, err := us.jwtManager.CreateToken(user.Email, user.Roles)
+	// Bookkeeping only: a failed write shouldn't stop the user from logging in
+	if err := us.userRepository.RecordLogin(ctx, user.ID, time.Now().UTC()); err != nil {
+		log.Println("Error recording login: ", err)
+	}
+
+	j, err := us.jwtManager.CreateToken(*user)
 	if err != nil {
 		return dtos.LoginResponse{}, err
 	}
@@ -102,42 +134,39 @@ func (us *UserServiceImpl) GetUserData(ctx context.Context) (dtos.ResponseUser,
 		return dtos.ResponseUser{}, errs.ErrInvalidToken
 	}
 
-	user, err := us.userRepository.FindByEmail(ctx, claims.Email)
-	if err != nil {
+	user, err := findCaller(ctx, us.userRepository, us.emailNormalizer, claims)
+	if err != nil || user == nil {
 		return dtos.ResponseUser{}, errs.ErrNotFound
 	}
 
-	roleNames := helpers.GetRoleNames(user.Roles)
-
-	respUser := dtos.ResponseUser{
-		ID: user.ID,
-		Email: user.Email,
-		Roles: roleNames,
-		IsActive: user.IsActive,
-	}
-
-	return respUser, nil
+	return us.responseUserFor(user, us.profileViewer(ctx, user, us.IsUserAdmin(ctx))), nil
 }
 
 func (us *UserServiceImpl) Unregister(ctx context.Context, unregisterRequest dtos.UnregisterRequest) error {
-	user, err := us.userRepository.FindByEmail(ctx, unregisterRequest.Email)
+	claims, ok := middleware.GetClaimsFromContext(ctx)
+	if !ok {
+		return errs.ErrUnauthorized
+	}
+
+	user, err := us.userRepository.FindByEmail(ctx, claims.TenantID, us.emailNormalizer.Key(unregisterRequest.Email))
 	if err != nil {
 		return err
 	}
+	if user == nil {
+		return errs.ErrNotFound
+	}
 
 	// Only the user themselves, or admins can unregister
-	if !us.IsUserOwner(ctx, user.Email) && !us.IsUserAdmin(ctx) {
+	if !us.IsUserOwner(ctx, user) && !us.IsUserAdmin(ctx) {
 		return errs.ErrUnauthorized
 	}
-
-	userToUnregister := model.User{
-		ID:             user.ID,
-		Email:          user.Email,
-		HashedPassword: user.HashedPassword,
-		Roles:          user.Roles,
-		IsActive:       false,
+	if !versionMatches(user, unregisterRequest.ExpectedVersion) {
+		return errs.ErrPreconditionFailed
 	}
 
+	userToUnregister := *user
+	userToUnregister.IsActive = false
+
 	err = us.userRepository.Update(ctx, userToUnregister)
 	if err != nil {
 		return err
@@ -147,7 +176,7 @@ func (us *UserServiceImpl) Unregister(ctx context.Context, unregisterRequest dto
 }
 
 func (us *UserServiceImpl) RequestPasswordReset(ctx context.Context, requestPassResetReq dtos.RequestPasswordResetRequest) error {
-	user, err := us.userRepository.FindByEmail(ctx, requestPassResetReq.Email)
+	user, err := us.userRepository.FindByEmail(ctx, requestPassResetReq.TenantID, us.emailNormalizer.Key(requestPassResetReq.Email))
 	if err != nil || user == nil {
 		log.Println("Error sending email: ", err)
 		return nil
@@ -180,7 +209,7 @@ func (us *UserServiceImpl) ResetPassword(ctx context.Context, resetPassRequest d
 	}
 
 	user, err := us.userRepository.FindById(ctx, uid)
-	if err != nil {
+	if err != nil || user == nil {
 		return errs.ErrInvalidToken
 	}
 
@@ -189,13 +218,9 @@ func (us *UserServiceImpl) ResetPassword(ctx context.Context, resetPassRequest d
 		return err
 	}
 
-	userWithNewPassword := model.User{
-		ID:             user.ID,
-		Email:          user.Email,
-		HashedPassword: newHashedPassword,
-		Roles:          user.Roles,
-		IsActive:       user.IsActive,
-	}
+	userWithNewPassword := *user
+	userWithNewPassword.HashedPassword = newHashedPassword
+	userWithNewPassword.PasswordChangedAt = time.Now().UTC()
 
 	err = us.userRepository.Update(ctx, userWithNewPassword)
 	if err != nil {
@@ -210,23 +235,42 @@ func (us *UserServiceImpl) UpdateUserData(ctx context.Context, updateUserRequest
 	if err != nil {
 		return err
 	}
+	if !us.IsSameTenant(ctx, user) {
+		return errs.ErrNotFound
+	}
+	if !user.ErasedAt.IsZero() {
+		return errs.ErrUserErased
+	}
 
 	// Only the user themselves, or admins can update data
-	if !us.IsUserOwner(ctx, user.Email) && !us.IsUserAdmin(ctx) {
+	callerIsAdmin := us.IsUserAdmin(ctx)
+	if !us.IsUserOwner(ctx, user) && !callerIsAdmin {
 		return errs.ErrUnauthorized
 	}
+	if !versionMatches(user, updateUserRequest.ExpectedVersion) {
+		return errs.ErrPreconditionFailed
+	}
 
+	// Owners must send their current roles; only admins may change them
 	dbRoles, err := helpers.ParseRoles(updateUserRequest.Roles)
 	if err != nil {
 		return errs.ErrParsingRoles
 	}
+	if err := checkRoleChange(ctx, user, dbRoles, callerIsAdmin); err != nil {
+		return err
+	}
 
 	userToUnregister := model.User{
 		ID:             user.ID,
-		Email:          updateUserRequest.Email,
+		TenantID:       user.TenantID,
+		Email:          us.emailNormalizer.Display(updateUserRequest.Email),
+		EmailKey:       us.emailNormalizer.Key(updateUserRequest.Email),
 		HashedPassword: user.HashedPassword,
 		Roles:          dbRoles,
 		IsActive:       user.IsActive,
+		IsVerified:     user.IsVerified,
+		Profile:        user.Profile,
+		Version:        user.Version,
 	}
 
 	err = us.userRepository.Update(ctx, userToUnregister)
@@ -237,49 +281,467 @@ func (us *UserServiceImpl) UpdateUserData(ctx context.Context, updateUserRequest
 	return nil
 }
 
-// Admin only
-func (us *UserServiceImpl) ListAllUsers(ctx context.Context) (dtos.GetAllUsersResponse, error) {
+// Applies an RFC 7396 merge patch: only the fields in the patch change. Same rules as UpdateUserData.
+func (us *UserServiceImpl) PatchUser(ctx context.Context, patchUserReq dtos.PatchUserRequest) (dtos.ResponseUser, error) {
+	user, err := us.userRepository.FindById(ctx, patchUserReq.ID)
+	if err != nil {
+		return dtos.ResponseUser{}, err
+	}
+	if !us.IsSameTenant(ctx, user) {
+		return dtos.ResponseUser{}, errs.ErrNotFound
+	}
+	if !user.ErasedAt.IsZero() {
+		return dtos.ResponseUser{}, errs.ErrUserErased
+	}
+
+	callerIsAdmin := us.IsUserAdmin(ctx)
+	if !us.IsUserOwner(ctx, user) && !callerIsAdmin {
+		return dtos.ResponseUser{}, errs.ErrUnauthorized
+	}
+	if !versionMatches(user, patchUserReq.ExpectedVersion) {
+		return dtos.ResponseUser{}, errs.ErrPreconditionFailed
+	}
+
+	patched := *user
+	if patchUserReq.Email != nil {
+		patched.Email = us.emailNormalizer.Display(*patchUserReq.Email)
+		patched.EmailKey = us.emailNormalizer.Key(*patchUserReq.Email)
+	}
+	if patchUserReq.Roles != nil {
+		patched.Roles, err = helpers.ParseRoles(*patchUserReq.Roles)
+		if err != nil {
+			return dtos.ResponseUser{}, errs.ErrParsingRoles
+		}
+		if err := checkRoleChange(ctx, user, patched.Roles, callerIsAdmin); err != nil {
+			return dtos.ResponseUser{}, err
+		}
+	}
+
+	if err := us.userRepository.Update(ctx, patched); err != nil {
+		return dtos.ResponseUser{}, err
+	}
+
+	updated, err := us.userRepository.FindById(ctx, user.ID)
+	if err != nil {
+		return dtos.ResponseUser{}, err
+	}
+	if updated == nil {
+		return dtos.ResponseUser{}, errs.ErrNotFound
+	}
+	return us.responseUserFor(updated, us.profileViewer(ctx, updated, callerIsAdmin)), nil
+}
+
+// Admin only: admins manage roles in their own organization, platform admins in any
+func (us *UserServiceImpl) AssignRoles(ctx context.Context, assignRolesReq dtos.AssignRolesRequest) error {
 	if !us.IsUserAdmin(ctx) {
+		return errs.ErrUnauthorized
+	}
+
+	user, err := us.userRepository.FindById(ctx, assignRolesReq.ID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errs.ErrNotFound
+	}
+	if !us.IsSameTenant(ctx, user) && !isPlatformAdmin(ctx, us.userRepository, us.emailNormalizer) {
+		return errs.ErrNotFound
+	}
+	if !user.ErasedAt.IsZero() {
+		return errs.ErrUserErased
+	}
+
+	dbRoles, err := helpers.ParseRoles(assignRolesReq.Roles)
+	if err != nil {
+		return errs.ErrParsingRoles
+	}
+	if !canGrantRoles(ctx, user.Roles) || !canGrantRoles(ctx, dbRoles) {
+		return errs.ErrUnauthorized
+	}
+	if !versionMatches(user, assignRolesReq.ExpectedVersion) {
+		return errs.ErrPreconditionFailed
+	}
+
+	userWithRoles := *user
+	userWithRoles.Roles = dbRoles
+
+	return us.userRepository.Update(ctx, userWithRoles)
+}
+
+// Only the user themselves, or admins of their organization, can edit a profile; admin attributes are left to admins
+func (us *UserServiceImpl) UpdateProfile(ctx context.Context, updateProfileReq dtos.UpdateProfileRequest) (dtos.ResponseUser, error) {
+	user, err := us.userRepository.FindById(ctx, updateProfileReq.ID)
+	if err != nil {
+		return dtos.ResponseUser{}, err
+	}
+	if !us.IsSameTenant(ctx, user) {
+		return dtos.ResponseUser{}, errs.ErrNotFound
+	}
+	if !user.ErasedAt.IsZero() {
+		return dtos.ResponseUser{}, errs.ErrUserErased
+	}
+
+	editor := us.profileViewer(ctx, user, us.IsUserAdmin(ctx))
+	if editor == profile.ViewerOther {
+		return dtos.ResponseUser{}, errs.ErrUnauthorized
+	}
+	if !versionMatches(user, updateProfileReq.ExpectedVersion) {
+		return dtos.ResponseUser{}, errs.ErrPreconditionFailed
+	}
+
+	schema := us.profileSchemas.For(user.TenantID)
+	if err := schema.CheckEditable(updateProfileReq.Attributes, editor); err != nil {
+		return dtos.ResponseUser{}, err
+	}
+	updatedProfile, err := schema.Validate(mergeProfile(user.Profile, updateProfileReq), editor)
+	if err != nil {
+		return dtos.ResponseUser{}, err
+	}
+
+	userWithProfile := *user
+	userWithProfile.Profile = updatedProfile
+	if err := us.userRepository.Update(ctx, userWithProfile); err != nil {
+		return dtos.ResponseUser{}, err
+	}
+
+	updated, err := us.userRepository.FindById(ctx, user.ID)
+	if err != nil {
+		return dtos.ResponseUser{}, err
+	}
+	if updated == nil {
+		return dtos.ResponseUser{}, errs.ErrNotFound
+	}
+	return us.responseUserFor(updated, editor), nil
+}
+
+// Admin only: issues a short-lived token acting as the user, with the admin in the "act" claim
+func (us *UserServiceImpl) ImpersonateUser(ctx context.Context, id uuid.UUID) (dtos.ImpersonateResponse, error) {
+	if !hasPermission(ctx, us.userRepository, us.emailNormalizer, model.PermImpersonateUsers) {
+		return dtos.ImpersonateResponse{}, errs.ErrUnauthorized
+	}
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+
+	user, err := us.userRepository.FindById(ctx, id)
+	if err != nil {
+		return dtos.ImpersonateResponse{}, err
+	}
+	if user == nil {
+		return dtos.ImpersonateResponse{}, errs.ErrNotFound
+	}
+	if !us.IsSameTenant(ctx, user) && !isPlatformAdmin(ctx, us.userRepository, us.emailNormalizer) {
+		return dtos.ImpersonateResponse{}, errs.ErrNotFound
+	}
+
+	// Support may act as regular users only, never as another admin
+	if model.DefaultRoleHierarchy.EffectivePermissions(user.Roles).Has(model.PermManageUsers) {
+		return dtos.ImpersonateResponse{}, errs.ErrUnauthorized
+	}
+
+	admin, err := findCaller(ctx, us.userRepository, us.emailNormalizer, claims)
+	if err != nil {
+		return dtos.ImpersonateResponse{}, err
+	}
+	if admin == nil {
+		return dtos.ImpersonateResponse{}, errs.ErrUnauthorized
+	}
+
+	token, expiresAt, err := us.jwtManager.CreateImpersonationToken(*user, jwt.Actor{
+		Sub:      admin.ID.String(),
+		Email:    admin.Email,
+		TenantID: admin.TenantID,
+	})
+	if err != nil {
+		return dtos.ImpersonateResponse{}, err
+	}
+
+	log.Printf("Impersonation started: Actor: %s, Subject: %s, Expires: %s", admin.Email, user.Email, expiresAt.Format(time.RFC3339))
+	err = us.auditRepository.Record(ctx, model.AuditEvent{
+		ID:           uuid.New(),
+		TenantID:     user.TenantID,
+		OccurredAt:   time.Now().UTC(),
+		Action:       model.AuditImpersonationStarted,
+		ActorID:      admin.ID,
+		ActorEmail:   admin.Email,
+		SubjectID:    user.ID,
+		SubjectEmail: user.Email,
+		Impersonated: true,
+	})
+	if err != nil {
+		return dtos.ImpersonateResponse{}, err
+	}
+
+	return dtos.ImpersonateResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Support and up, scoped to the caller's own organization
+func (us *UserServiceImpl) ListAllUsers(ctx context.Context, listUsersReq dtos.ListUsersRequest) (dtos.GetAllUsersResponse, error) {
+	if !hasPermission(ctx, us.userRepository, us.emailNormalizer, model.PermReadUsers) {
 		return dtos.GetAllUsersResponse{}, errs.ErrUnauthorized
 	}
 
-	users, err := us.userRepository.List(ctx)
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+	opts, err := listOptionsFromRequest(claims.TenantID, listUsersReq)
 	if err != nil {
-		return nil, err
+		return dtos.GetAllUsersResponse{}, err
 	}
 
-	if len(users) == 0 {
-		return []dtos.ResponseUser{}, nil
+	page, err := us.userRepository.List(ctx, opts)
+	if err != nil {
+		return dtos.GetAllUsersResponse{}, err
 	}
 
-	var respUsers dtos.GetAllUsersResponse
-	for _, user := range users {
-		roleNames := helpers.GetRoleNames(user.Roles)
-		respUser := dtos.ResponseUser{
-			ID:       user.ID,
-			Email:    user.Email,
-			Roles:    roleNames,
-			IsActive: user.IsActive,
-		}
-		respUsers = append(respUsers, respUser)
+	// Support staff only see public profile fields
+	callerIsAdmin := us.IsUserAdmin(ctx)
+	respUsers := make([]dtos.ResponseUser, 0, len(page.Users))
+	for _, user := range page.Users {
+		respUsers = append(respUsers, us.responseUserFor(user, us.profileViewer(ctx, user, callerIsAdmin)))
 	}
 
-	return respUsers, nil
+	return dtos.GetAllUsersResponse{
+		Users:      respUsers,
+		NextCursor: page.NextCursor,
+	}, nil
 }
 
 // Admin only
+// Soft delete: the user is deactivated, can be restored during the grace period and is purged later.
 func (us *UserServiceImpl) RemoveUser(ctx context.Context, id uuid.UUID) error {
-	// Only admins can remove (delete from DB) an user
+	// Only admins can remove an user
 	if !us.IsUserAdmin(ctx) {
 		return errs.ErrUnauthorized
 	}
 
-	err := us.userRepository.Delete(ctx, id)
+	user, err := us.userRepository.FindById(ctx, id)
 	if err != nil {
 		return err
 	}
+	if !us.IsSameTenant(ctx, user) {
+		return errs.ErrNotFound
+	}
+	if !user.IsActive {
+		return nil
+	}
 
-	return nil
+	user.IsActive = false
+	return us.userRepository.Update(ctx, *user)
+}
+
+// Admin only: reactivates a removed or unregistered user within the grace period
+func (us *UserServiceImpl) RestoreUser(ctx context.Context, id uuid.UUID) error {
+	if !us.IsUserAdmin(ctx) {
+		return errs.ErrUnauthorized
+	}
+
+	user, err := us.userRepository.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !us.IsSameTenant(ctx, user) {
+		return errs.ErrNotFound
+	}
+	if !user.ErasedAt.IsZero() {
+		return errs.ErrUserErased
+	}
+	if user.IsActive {
+		return nil
+	}
+	// Users deactivated before deactivation times were recorded have none and can always be restored
+	if !user.DeactivatedAt.IsZero() && time.Since(user.DeactivatedAt) > us.lifecycle.RestoreGracePeriod {
+		return errs.ErrRestoreWindowExpired
+	}
+
+	user.IsActive = true
+	return us.userRepository.Update(ctx, *user)
+}
+
+// Only the user themselves, or admins of their organization, can export their data. Every export is audited.
+func (us *UserServiceImpl) ExportUser(ctx context.Context, id uuid.UUID) (dtos.UserExport, error) {
+	claims, ok := middleware.GetClaimsFromContext(ctx)
+	if !ok {
+		return dtos.UserExport{}, errs.ErrUnauthorized
+	}
+
+	user, err := us.userRepository.FindById(ctx, id)
+	if err != nil {
+		return dtos.UserExport{}, err
+	}
+	if !us.IsSameTenant(ctx, user) {
+		return dtos.UserExport{}, errs.ErrNotFound
+	}
+	if !us.IsUserOwner(ctx, user) && !us.IsUserAdmin(ctx) {
+		return dtos.UserExport{}, errs.ErrUnauthorized
+	}
+
+	caller, err := findCaller(ctx, us.userRepository, us.emailNormalizer, claims)
+	if err != nil {
+		return dtos.UserExport{}, err
+	}
+	if caller == nil {
+		return dtos.UserExport{}, errs.ErrUnauthorized
+	}
+
+	// The default organization isn't stored
+	var organization *model.Organization
+	if user.TenantID != model.DefaultTenantID {
+		organization, err = us.organizationRepository.FindById(ctx, user.TenantID)
+		if err != nil && !errors.Is(err, errs.ErrNotFound) {
+			return dtos.UserExport{}, err
+		}
+	}
+	auditEvents, err := us.auditRepository.ListBySubject(ctx, user.ID)
+	if err != nil {
+		return dtos.UserExport{}, err
+	}
+
+	exportedAt := time.Now().UTC()
+	err = us.auditRepository.Record(ctx, model.AuditEvent{
+		ID:           uuid.New(),
+		TenantID:     user.TenantID,
+		OccurredAt:   exportedAt,
+		Action:       model.AuditUserExported,
+		ActorID:      caller.ID,
+		ActorEmail:   caller.Email,
+		SubjectID:    user.ID,
+		SubjectEmail: user.Email,
+	})
+	if err != nil {
+		return dtos.UserExport{}, err
+	}
+
+	return dtos.UserExport{
+		ExportedAt:   exportedAt,
+		User:         newResponseUser(user),
+		Organization: organization,
+		AuditEvents:  auditEvents,
+	}, nil
+}
+
+// Admin only: erases a user of the caller's organization right away
+func (us *UserServiceImpl) EraseUser(ctx context.Context, id uuid.UUID) error {
+	if !us.IsUserAdmin(ctx) {
+		return errs.ErrUnauthorized
+	}
+	claims, _ := middleware.GetClaimsFromContext(ctx)
+
+	user, err := us.userRepository.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !us.IsSameTenant(ctx, user) {
+		return errs.ErrNotFound
+	}
+	// Like role changes, admins can't erase users above them
+	if !canGrantRoles(ctx, user.Roles) {
+		return errs.ErrUnauthorized
+	}
+
+	admin, err := findCaller(ctx, us.userRepository, us.emailNormalizer, claims)
+	if err != nil {
+		return err
+	}
+	if admin == nil {
+		return errs.ErrUnauthorized
+	}
+
+	return us.erase(ctx, user, admin)
+}
+
+// Users erase themselves in two steps: this sends a confirmation link to their current email,
+// and ConfirmErasure does the erasure once it's followed.
+func (us *UserServiceImpl) RequestErasure(ctx context.Context, id uuid.UUID) error {
+	user, err := us.userRepository.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !us.IsSameTenant(ctx, user) || !user.ErasedAt.IsZero() {
+		return errs.ErrNotFound
+	}
+	if !us.IsUserOwner(ctx, user) {
+		return errs.ErrUnauthorized
+	}
+
+	token, err := us.jwtManager.CreateErasureToken(user.ID.String())
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/confirm-erasure?token=%s", us.baseUrl, token)
+	subject := "Confirm Account Erasure"
+	body := fmt.Sprintf("Click the link below to permanently erase your account and personal data. This can't be undone:\r\n\r\n%s\r\n\r\nThis link expires in 1 hour. If you didn't ask for this, ignore this email.", link)
+
+	// Nothing happens without the confirmation, so a failed send is reported
+	return us.emailService.SendMail([]string{user.Email}, subject, body)
+}
+
+func (us *UserServiceImpl) ConfirmErasure(ctx context.Context, confirmErasureReq dtos.ConfirmErasureRequest) error {
+	userID, err := us.jwtManager.VerifyErasureToken(confirmErasureReq.Token)
+	if err != nil {
+		return errs.ErrInvalidToken
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return errs.ErrInvalidToken
+	}
+
+	user, err := us.userRepository.FindById(ctx, uid)
+	if err != nil || user == nil {
+		return errs.ErrInvalidToken
+	}
+
+	return us.erase(ctx, user, user)
+}
+
+// Anonymizes the user in place. The record and its ID stay, so audit trails and references still resolve,
+// but the email becomes a tombstone and the password, roles and profile are wiped. Without the email no token resolves
+// to the user any more, which revokes every session.
+// Audit entries are scrubbed first, so a failed erasure can simply be retried.
+func (us *UserServiceImpl) erase(ctx context.Context, user *model.User, actor *model.User) error {
+	if !user.ErasedAt.IsZero() {
+		return nil
+	}
+
+	tombstone := erasedEmail(user.ID)
+	scrubbed, err := us.auditRepository.AnonymizeUser(ctx, user.ID, tombstone)
+	if err != nil {
+		return err
+	}
+
+	erasedAt := time.Now().UTC()
+	err = us.userRepository.Update(ctx, model.User{
+		ID:       user.ID,
+		TenantID: user.TenantID,
+		Email:    tombstone,
+		EmailKey: tombstone,
+		Roles:    []model.Role{},
+		IsActive: false,
+		ErasedAt: erasedAt,
+		Version:  user.Version,
+	})
+	if err != nil {
+		return err
+	}
+
+	requestedBy := "admin"
+	actorEmail := actor.Email
+	if actor.ID == user.ID {
+		requestedBy = "user"
+		actorEmail = tombstone
+	}
+
+	return us.auditRepository.Record(ctx, model.AuditEvent{
+		ID:           uuid.New(),
+		TenantID:     user.TenantID,
+		OccurredAt:   erasedAt,
+		Action:       model.AuditUserErased,
+		ActorID:      actor.ID,
+		ActorEmail:   actorEmail,
+		SubjectID:    user.ID,
+		SubjectEmail: tombstone,
+		Detail:       fmt.Sprintf("requested by %s; email, password, roles and profile removed; %d audit events anonymized", requestedBy, scrubbed),
+	})
 }
 
 // For external services:
@@ -291,30 +753,125 @@ func (us *UserServiceImpl) CheckUser(ctx context.Context, checkUserReq dtos.Chec
 		}, err
 	}
 
-	user, err := us.userRepository.FindByEmail(ctx, claims.Email)
+	user, err := findCaller(ctx, us.userRepository, us.emailNormalizer, claims)
 	if err != nil {
 		return dtos.CheckUserResponse{
 			IsValid: false,
 		}, err
 	}
+	if user == nil {
+		return dtos.CheckUserResponse{
+			IsValid: false,
+		}, errs.ErrNotFound
+	}
+
+	impersonatedBy := ""
+	if claims.IsImpersonated() {
+		impersonatedBy = claims.Act.Email
+	}
 
 	if !user.IsActive {
 		return dtos.CheckUserResponse{
-			IsValid: false,
-			User:    *user,
+			IsValid:        false,
+			User:           *user,
+			ImpersonatedBy: impersonatedBy,
 		}, nil
 	}
 
 	return dtos.CheckUserResponse{
-		IsValid: true,
-		User:    *user,
+		IsValid:        true,
+		User:           *user,
+		ImpersonatedBy: impersonatedBy,
 	}, nil
 }
 
+// Not exposed: creates the first platform super-admin from config or the bootstrap CLI.
+// It refuses to run once one exists, so it can safely run on every startup.
+func (us *UserServiceImpl) BootstrapAdmin(ctx context.Context, email string, password string) error {
+	if email == "" || password == "" {
+		return errs.ErrInvalidCredentials
+	}
+
+	superAdmin := model.SuperAdmin
+	page, err := us.userRepository.List(ctx, repository.UserListOptions{
+		TenantID: model.DefaultTenantID,
+		Role:     &superAdmin,
+	})
+	if err != nil {
+		return err
+	}
+	for _, user := range page.Users {
+		if model.DefaultRoleHierarchy.EffectivePermissions(user.Roles).Has(model.PermManageOrganizations) {
+			return errs.ErrAlreadyBootstrapped
+		}
+	}
+
+	hashedPassword, err := us.passwordHasher.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	admin := model.User{
+		ID:                uuid.New(),
+		TenantID:          model.DefaultTenantID,
+		Email:             us.emailNormalizer.Display(email),
+		EmailKey:          us.emailNormalizer.Key(email),
+		HashedPassword:    hashedPassword,
+		Roles:             []model.Role{model.SuperAdmin},
+		IsActive:          true,
+		IsVerified:        true,
+		CreatedAt:         now,
+		PasswordChangedAt: now,
+	}
+
+	return us.userRepository.Create(ctx, admin)
+}
+
+const purgeBatchSize = 100
+
+// Not exposed: run by the purge job. Hard-deletes users deactivated longer than the retention window
+// and leaves an audit event for each one.
+func (us *UserServiceImpl) PurgeDeactivatedUsers(ctx context.Context, now time.Time) (int, error) {
+	cutoff := now.Add(-max(us.lifecycle.PurgeRetention, us.lifecycle.RestoreGracePeriod))
+
+	purged := 0
+	for {
+		users, err := us.userRepository.FindDeactivatedBefore(ctx, cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, user := range users {
+			if err := us.userRepository.Delete(ctx, user.ID); err != nil {
+				return purged, err
+			}
+			purged++
+
+			event := model.AuditEvent{
+				ID:           uuid.New(),
+				TenantID:     user.TenantID,
+				OccurredAt:   now.UTC(),
+				Action:       model.AuditUserPurged,
+				SubjectID:    user.ID,
+				SubjectEmail: user.Email,
+				Detail:       "deactivated at " + user.DeactivatedAt.Format(time.RFC3339),
+			}
+			if err := us.auditRepository.Record(ctx, event); err != nil {
+				log.Println("Error recording purge: ", err)
+			}
+		}
+
+		if len(users) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
 // Not exposed
 func (us *UserServiceImpl) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	user, err := us.userRepository.FindById(ctx, id)
-	if err != nil {
+	if err != nil || !us.IsSameTenant(ctx, user) {
 		return nil, errs.ErrNotFound
 	}
 
@@ -15,9 +15,18 @@ type UserService interface {
 	GetUserData(ctx context.Context) (dtos.ResponseUser, error)
 	RequestPasswordReset(ctx context.Context, requestPassResetReq dtos.RequestPasswordResetRequest) error
 	ResetPassword(ctx context.Context, resetPassRequest dtos.ResetPasswordRequest) error
-	ListAllUsers(ctx context.Context) (dtos.GetAllUsersResponse, error)
+	ListAllUsers(ctx context.Context, listUsersReq dtos.ListUsersRequest) (dtos.GetAllUsersResponse, error)
 	UpdateUserData(ctx context.Context, updateUserRequest dtos.UpdateUserRequest) error
+	PatchUser(ctx context.Context, patchUserReq dtos.PatchUserRequest) (dtos.ResponseUser, error)
+	AssignRoles(ctx context.Context, assignRolesReq dtos.AssignRolesRequest) error
+	UpdateProfile(ctx context.Context, updateProfileReq dtos.UpdateProfileRequest) (dtos.ResponseUser, error)
+	ImpersonateUser(ctx context.Context, id uuid.UUID) (dtos.ImpersonateResponse, error)
 	RemoveUser(ctx context.Context, id uuid.UUID) error
+	RestoreUser(ctx context.Context, id uuid.UUID) error
 	GetUser(ctx context.Context, id uuid.UUID) (*model.User, error)
+	ExportUser(ctx context.Context, id uuid.UUID) (dtos.UserExport, error)
+	EraseUser(ctx context.Context, id uuid.UUID) error
+	RequestErasure(ctx context.Context, id uuid.UUID) error
+	ConfirmErasure(ctx context.Context, confirmErasureReq dtos.ConfirmErasureRequest) error
 	CheckUser(ctx context.Context, checkUserReq dtos.CheckUserRequest) (dtos.CheckUserResponse, error)
 }
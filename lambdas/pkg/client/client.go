@@ -0,0 +1,261 @@
+// Package client is a typed Go client for the User Manager API. Requests and responses are the API's own
+// DTOs, and error responses come back as *Error, which matches the sentinel errors of this package:
+//
+//	c := client.New("https://users.example.com", client.WithAPIKey(key))
+//	check, err := c.CheckUser(ctx, client.CheckUserRequest{Token: token})
+//	if errors.Is(err, client.ErrInvalidToken) { ... }
+//
+// Reads, and writes the API deduplicates with an Idempotency-Key, are retried on network errors, on 429, 502
+// and 504 responses, and on 503 responses that have a Retry-After or don't come from the API itself, like a
+// proxy's. The API's own 503s, e.g. mail_unavailable, are configuration errors a retry won't fix.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxRetries = 2
+	defaultBackoff    = 200 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	apiKey     string
+	maxRetries int
+	backoff    time.Duration
+}
+
+type Option func(*Client)
+
+// Defaults to http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// The JWT sent to protected routes, e.g. from Login.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// The key sent to /check-user.
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// Retries after backoff, doubled for every attempt. WithRetries(0, 0) turns retries off.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithToken returns a copy of c that acts as the user the token belongs to.
+func (c *Client) WithToken(token string) *Client {
+	copied := *c
+	copied.token = token
+	return &copied
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey makes the next write sent with ctx use key instead of a random one, so a retry after a
+// crash can be recognized by the API too.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+type auth int
+
+const (
+	authNone auth = iota
+	authBearer
+	authAPIKey
+)
+
+type call struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+	auth        auth
+	// Sent as If-Match
+	version *int64
+	// Sends an Idempotency-Key, so the API answers a repeated write with the first response
+	idempotencyKey bool
+	// Safe to send again without a key, like a read
+	safe bool
+}
+
+func jsonCall(method, path string, body any) (call, error) {
+	c := call{method: method, path: path}
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return call{}, err
+		}
+		c.body = encoded
+		c.contentType = "application/json"
+	}
+	return c, nil
+}
+
+// Sends the call, decoding a JSON response into out when out isn't nil.
+func (c *Client) do(ctx context.Context, cl call, out any) error {
+	resp, err := c.send(ctx, cl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("user-manager: decoding %s %s response: %w", cl.method, cl.path, err)
+	}
+	return nil
+}
+
+// Returns the first successful response, or the last error. The caller closes the body.
+func (c *Client) send(ctx context.Context, cl call) (*http.Response, error) {
+	key := ""
+	if cl.idempotencyKey {
+		key, _ = ctx.Value(idempotencyKeyContextKey{}).(string)
+		if key == "" {
+			key = uuid.NewString()
+		}
+	}
+	retry := cl.method == http.MethodGet || cl.idempotencyKey || cl.safe
+
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, cl, key)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		var wait time.Duration
+		hasRetryAfter := false
+		if err == nil {
+			hasRetryAfter = resp.Header.Get("Retry-After") != ""
+			wait = retryAfter(resp)
+			err = decodeError(resp)
+		}
+		if !retry || attempt >= c.maxRetries || !isRetryable(ctx, err, hasRetryAfter) {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.backoff << attempt
+			wait = wait/2 + rand.N(wait/2+1)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(min(wait, maxBackoff)):
+		}
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, cl call, idempotencyKey string) (*http.Request, error) {
+	target := c.baseURL + cl.path
+	if len(cl.query) > 0 {
+		target += "?" + cl.query.Encode()
+	}
+	var body io.Reader
+	if cl.body != nil {
+		body = bytes.NewReader(cl.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, cl.method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if cl.contentType != "" {
+		req.Header.Set("Content-Type", cl.contentType)
+	}
+	switch cl.auth {
+	case authBearer:
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case authAPIKey:
+		req.Header.Set("User-Api-Key", c.apiKey)
+	}
+	if cl.version != nil {
+		req.Header.Set("If-Match", `"`+strconv.FormatInt(*cl.version, 10)+`"`)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	return req, nil
+}
+
+// Helpers
+func isRetryable(ctx context.Context, err error, hasRetryAfter bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		// Network errors
+		return true
+	}
+	switch apiErr.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	case http.StatusServiceUnavailable:
+		return apiErr.Code != CodeMailUnavailable && (hasRetryAfter || apiErr.Code == "")
+	}
+	// The first request with the same key is still running
+	return apiErr.Code == CodeIdempotencyKeyInUse
+}
+
+// Only the delay in seconds form of Retry-After is supported.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,121 @@
+// Package clienttest runs the User Manager API on in-memory storage behind an httptest server, for tests
+// of code that uses the client package. Emails aren't sent; the last one is kept, see LastEmail.
+package clienttest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danilobml/user-manager/internal/httpx/middleware"
+	"github.com/danilobml/user-manager/internal/mocks"
+	"github.com/danilobml/user-manager/internal/routes"
+	"github.com/danilobml/user-manager/internal/user/emailnorm"
+	"github.com/danilobml/user-manager/internal/user/handler"
+	"github.com/danilobml/user-manager/internal/user/jwt"
+	"github.com/danilobml/user-manager/internal/user/profile"
+	"github.com/danilobml/user-manager/internal/user/repository"
+	"github.com/danilobml/user-manager/internal/user/service"
+	"github.com/danilobml/user-manager/pkg/client"
+	"github.com/google/uuid"
+)
+
+// Credentials of the super admin every server starts with.
+const (
+	AdminEmail    = "admin@example.com"
+	AdminPassword = "StrongP@ssw0rd12345"
+)
+
+type Server struct {
+	*httptest.Server
+	APIKey string
+	mailer *mocks.MockMailer
+}
+
+type Email struct {
+	To      []string
+	Subject string
+	// Includes the subject line
+	Message string
+}
+
+// NewServer starts a server that is closed when the test ends.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+
+	jwtManager := jwt.NewJwtManager([]byte(uuid.NewString() + uuid.NewString()))
+	userRepository := repository.NewUserRepositoryInMemory()
+	organizationRepository := repository.NewOrganizationRepositoryInMemory()
+	invitationRepository := repository.NewInvitationRepositoryInMemory()
+	auditRepository := repository.NewAuditRepositoryInMemory()
+	mailer := &mocks.MockMailer{}
+	emailNormalizer := emailnorm.NewNormalizer(emailnorm.Rules{})
+	profileSchemas, err := profile.ParseSchemas("")
+	if err != nil {
+		tb.Fatalf("clienttest: %v", err)
+	}
+	lifecycle := service.Lifecycle{RestoreGracePeriod: 14 * 24 * time.Hour, PurgeRetention: 30 * 24 * time.Hour}
+	apiKey := uuid.NewString()
+
+	userService := service.NewUserserviceImpl(userRepository, organizationRepository, auditRepository, jwtManager, mailer, "http://localhost", emailNormalizer, lifecycle, profileSchemas)
+	if err := userService.BootstrapAdmin(context.Background(), AdminEmail, AdminPassword); err != nil {
+		tb.Fatalf("clienttest: bootstrap admin: %v", err)
+	}
+	organizationService := service.NewOrganizationServiceImpl(organizationRepository, userRepository, emailNormalizer)
+	invitationService := service.NewInvitationServiceImpl(invitationRepository, organizationRepository, userRepository, jwtManager, mailer, "http://localhost", emailNormalizer)
+
+	authMiddleware := middleware.ApplyMiddlewares(
+		middleware.Authenticate(jwtManager),
+		middleware.AuditImpersonation(auditRepository),
+	)
+	idempotencyMiddleware := middleware.Idempotency(repository.NewIdempotencyRepositoryInMemory(), 24*time.Hour)
+	router := routes.NewRouter(
+		handler.NewUserHandler(userService, apiKey),
+		handler.NewOrganizationHandler(organizationService),
+		handler.NewInvitationHandler(invitationService),
+		handler.NewBulkHandler(service.NewBulkServiceImpl(userRepository, invitationService, emailNormalizer, profileSchemas)),
+		authMiddleware,
+		idempotencyMiddleware,
+	)
+
+	s := &Server{Server: httptest.NewServer(router), APIKey: apiKey, mailer: mailer}
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client for the server that has its API key and no token.
+func (s *Server) Client(opts ...client.Option) *client.Client {
+	opts = append([]client.Option{client.WithHTTPClient(s.Server.Client()), client.WithAPIKey(s.APIKey)}, opts...)
+	return client.New(s.URL, opts...)
+}
+
+// AdminClient returns a client logged in as the super admin.
+func (s *Server) AdminClient(tb testing.TB) *client.Client {
+	tb.Helper()
+	return s.login(tb, AdminEmail, AdminPassword)
+}
+
+// UserClient registers a user and returns a client logged in as them.
+func (s *Server) UserClient(tb testing.TB, email, password string) *client.Client {
+	tb.Helper()
+	if _, err := s.Client().Register(context.Background(), client.RegisterRequest{Email: email, Password: password}); err != nil {
+		tb.Fatalf("clienttest: register %s: %v", email, err)
+	}
+	return s.login(tb, email, password)
+}
+
+// LastEmail returns the last email the API sent, e.g. with a reset or invitation link.
+func (s *Server) LastEmail() Email {
+	return Email{To: s.mailer.To, Subject: s.mailer.Subject, Message: s.mailer.Message}
+}
+
+// Helpers
+func (s *Server) login(tb testing.TB, email, password string) *client.Client {
+	tb.Helper()
+	resp, err := s.Client().Login(context.Background(), client.LoginRequest{Email: email, Password: password})
+	if err != nil {
+		tb.Fatalf("clienttest: login %s: %v", email, err)
+	}
+	return s.Client(client.WithToken(resp.Token))
+}
@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// Methods are named like the operationIds of the OpenAPI document.
+
+// Public
+
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, call{method: http.MethodGet, path: "/health"}, nil)
+}
+
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (RegisterResponse, error) {
+	var resp RegisterResponse
+	cl, err := jsonCall(http.MethodPost, "/register", req)
+	if err != nil {
+		return resp, err
+	}
+	cl.idempotencyKey = true
+	return resp, c.do(ctx, cl, &resp)
+}
+
+func (c *Client) Login(ctx context.Context, req LoginRequest) (LoginResponse, error) {
+	var resp LoginResponse
+	cl, err := jsonCall(http.MethodPost, "/login", req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, c.do(ctx, cl, &resp)
+}
+
+func (c *Client) RequestPasswordReset(ctx context.Context, req RequestPasswordResetRequest) error {
+	cl, err := jsonCall(http.MethodPost, "/request-password", req)
+	if err != nil {
+		return err
+	}
+	cl.idempotencyKey = true
+	return c.do(ctx, cl, nil)
+}
+
+func (c *Client) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	cl, err := jsonCall(http.MethodPut, "/users/reset-password", req)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, cl, nil)
+}
+
+func (c *Client) ConfirmErasure(ctx context.Context, req ConfirmErasureRequest) error {
+	cl, err := jsonCall(http.MethodPost, "/users/erase/confirm", req)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, cl, nil)
+}
+
+func (c *Client) AcceptInvitation(ctx context.Context, req AcceptInvitationRequest) (AcceptInvitationResponse, error) {
+	var resp AcceptInvitationResponse
+	cl, err := jsonCall(http.MethodPost, "/invitations/accept", req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, c.do(ctx, cl, &resp)
+}
+
+// Needs WithAPIKey. Only reads, so it is retried like a GET.
+func (c *Client) CheckUser(ctx context.Context, req CheckUserRequest) (CheckUserResponse, error) {
+	var resp CheckUserResponse
+	cl, err := jsonCall(http.MethodPost, "/check-user", req)
+	if err != nil {
+		return resp, err
+	}
+	cl.auth = authAPIKey
+	cl.safe = true
+	return resp, c.do(ctx, cl, &resp)
+}
+
+// Protected: these need a token, see WithToken. Writes are sent with an Idempotency-Key.
+
+// Version is the user's ETag, for the ExpectedVersion of later updates.
+func (c *Client) GetUserData(ctx context.Context) (User, error) {
+	var resp User
+	return resp, c.do(ctx, protected(http.MethodGet, "/users/data"), &resp)
+}
+
+// Deletes your own account. expectedVersion, when set, is sent as If-Match.
+func (c *Client) UnregisterUser(ctx context.Context, id uuid.UUID, expectedVersion *int64) error {
+	cl := protected(http.MethodDelete, userPath(id, ""))
+	cl.version = expectedVersion
+	return c.do(ctx, cl, nil)
+}
+
+func (c *Client) UpdateUser(ctx context.Context, req UpdateUserRequest) error {
+	cl, err := protectedJSON(http.MethodPut, userPath(req.ID, ""), req)
+	if err != nil {
+		return err
+	}
+	cl.version = req.ExpectedVersion
+	return c.do(ctx, cl, nil)
+}
+
+// Fields left nil aren't changed. An empty Roles list removes every role.
+func (c *Client) PatchUser(ctx context.Context, req PatchUserRequest) (User, error) {
+	var resp User
+	patch := map[string]any{}
+	if req.Email != nil {
+		patch["email"] = *req.Email
+	}
+	if req.Roles != nil {
+		patch["roles"] = *req.Roles
+	}
+	cl, err := protectedJSON(http.MethodPatch, userPath(req.ID, ""), patch)
+	if err != nil {
+		return resp, err
+	}
+	cl.contentType = "application/merge-patch+json"
+	cl.version = req.ExpectedVersion
+	return resp, c.do(ctx, cl, &resp)
+}
+
+func (c *Client) UpdateProfile(ctx context.Context, req UpdateProfileRequest) (User, error) {
+	var resp User
+	cl, err := protectedJSON(http.MethodPatch, userPath(req.ID, "/profile"), req)
+	if err != nil {
+		return resp, err
+	}
+	cl.version = req.ExpectedVersion
+	return resp, c.do(ctx, cl, &resp)
+}
+
+func (c *Client) ExportUser(ctx context.Context, id uuid.UUID) (UserExport, error) {
+	var resp UserExport
+	return resp, c.do(ctx, protected(http.MethodGet, userPath(id, "/export")), &resp)
+}
+
+// Emails a confirmation link; see ConfirmErasure.
+func (c *Client) RequestErasure(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, protected(http.MethodPost, userPath(id, "/erase")), nil)
+}
+
+// Admin
+
+func (c *Client) GetAllUsers(ctx context.Context, req ListUsersRequest) (GetAllUsersResponse, error) {
+	var resp GetAllUsersResponse
+	cl := protected(http.MethodGet, "/users")
+	cl.query = queryValues(req)
+	return resp, c.do(ctx, cl, &resp)
+}
+
+func (c *Client) RemoveUser(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, protected(http.MethodDelete, userPath(id, "/remove")), nil)
+}
+
+func (c *Client) RestoreUser(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, protected(http.MethodPost, adminUserPath(id, "/restore")), nil)
+}
+
+func (c *Client) EraseUser(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, protected(http.MethodPost, adminUserPath(id, "/erase")), nil)
+}
+
+func (c *Client) AssignRoles(ctx context.Context, req AssignRolesRequest) error {
+	cl, err := protectedJSON(http.MethodPut, adminUserPath(req.ID, "/roles"), req)
+	if err != nil {
+		return err
+	}
+	cl.version = req.ExpectedVersion
+	return c.do(ctx, cl, nil)
+}
+
+// The token acts as the user; use it with WithToken.
+func (c *Client) ImpersonateUser(ctx context.Context, id uuid.UUID) (ImpersonateResponse, error) {
+	var resp ImpersonateResponse
+	return resp, c.do(ctx, protected(http.MethodPost, adminUserPath(id, "/impersonate")), &resp)
+}
+
+// The file is read into memory first, so the request can be sent again on a retry.
+func (c *Client) ImportUsers(ctx context.Context, format Format, file io.Reader, opts ImportOptions) (ImportReport, error) {
+	var resp ImportReport
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return resp, err
+	}
+	cl := protected(http.MethodPost, "/admin/users/import")
+	cl.query = url.Values{
+		"format":  {string(format)},
+		"dry_run": {strconv.FormatBool(opts.DryRun)},
+		"invite":  {strconv.FormatBool(opts.Invite)},
+	}
+	cl.body = body
+	cl.contentType = "text/csv"
+	if format == JSONL {
+		cl.contentType = "application/x-ndjson"
+	}
+	return resp, c.do(ctx, cl, &resp)
+}
+
+// Streams the file; the caller closes it. A server error after the first user cuts the file short.
+func (c *Client) ExportUsers(ctx context.Context, format Format) (io.ReadCloser, error) {
+	cl := protected(http.MethodGet, "/admin/users/export")
+	cl.query = url.Values{"format": {string(format)}}
+	resp, err := c.send(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) CreateInvitation(ctx context.Context, req CreateInvitationRequest) (Invitation, error) {
+	var resp Invitation
+	cl, err := protectedJSON(http.MethodPost, "/invitations", req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, c.do(ctx, cl, &resp)
+}
+
+func (c *Client) GetAllInvitations(ctx context.Context) ([]Invitation, error) {
+	var resp []Invitation
+	return resp, c.do(ctx, protected(http.MethodGet, "/invitations"), &resp)
+}
+
+func (c *Client) RevokeInvitation(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, protected(http.MethodDelete, "/invitations/"+id.String()), nil)
+}
+
+// Platform admin
+
+func (c *Client) CreateOrganization(ctx context.Context, req CreateOrganizationRequest) (Organization, error) {
+	var resp Organization
+	cl, err := protectedJSON(http.MethodPost, "/organizations", req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, c.do(ctx, cl, &resp)
+}
+
+func (c *Client) GetAllOrganizations(ctx context.Context) ([]Organization, error) {
+	var resp []Organization
+	return resp, c.do(ctx, protected(http.MethodGet, "/organizations"), &resp)
+}
+
+// Helpers
+func protected(method, path string) call {
+	return call{method: method, path: path, auth: authBearer, idempotencyKey: method != http.MethodGet}
+}
+
+func protectedJSON(method, path string, body any) (call, error) {
+	cl, err := jsonCall(method, path, body)
+	if err != nil {
+		return call{}, err
+	}
+	cl.auth = authBearer
+	cl.idempotencyKey = method != http.MethodGet
+	return cl, nil
+}
+
+func userPath(id uuid.UUID, suffix string) string {
+	return "/users/" + id.String() + suffix
+}
+
+func adminUserPath(id uuid.UUID, suffix string) string {
+	return "/admin/users/" + id.String() + suffix
+}
+
+// Encodes the query-tagged fields of req that aren't zero.
+func queryValues(req any) url.Values {
+	values := url.Values{}
+	v := reflect.ValueOf(req)
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Tag.Get("query")
+		field := v.Field(i)
+		if name == "" || field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			field = field.Elem()
+		}
+		values.Set(name, fmt.Sprint(field.Interface()))
+	}
+	return values
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Code is the stable name of an API error, like "not_found". Branch on codes, not messages.
+type Code string
+
+const (
+	CodeInvalidJSON           Code = "invalid_json"
+	CodeInvalidID             Code = "invalid_id"
+	CodeValidationFailed      Code = "validation_failed"
+	CodeInvalidRole           Code = "invalid_role"
+	CodeInvalidCursor         Code = "invalid_cursor"
+	CodeInvalidDateRange      Code = "invalid_date_range"
+	CodeInvalidFormat         Code = "invalid_format"
+	CodeInvalidImportFile     Code = "invalid_import_file"
+	CodeInvalidInvitation     Code = "invalid_invitation"
+	CodeInvalidProfile        Code = "invalid_profile"
+	CodeInvalidIdempotencyKey Code = "invalid_idempotency_key"
+	CodeAlreadyExists         Code = "already_exists"
+	CodeInvalidCredentials    Code = "invalid_credentials"
+	CodeInvalidToken          Code = "invalid_token"
+	CodeUnauthorized          Code = "unauthorized"
+	CodeImpersonationBlocked  Code = "impersonation_not_allowed"
+	CodeOriginNotAllowed      Code = "origin_not_allowed"
+	CodeNotFound              Code = "not_found"
+	CodeConflict              Code = "conflict"
+	CodeAlreadyBootstrapped   Code = "already_bootstrapped"
+	CodeIdempotencyKeyInUse   Code = "idempotency_key_in_use"
+	CodeRestoreWindowExpired  Code = "restore_window_expired"
+	CodeUserErased            Code = "user_erased"
+	CodePreconditionFailed    Code = "precondition_failed"
+	CodeRequestTooLarge       Code = "request_too_large"
+	CodeUnsupportedMediaType  Code = "unsupported_media_type"
+	CodeIdempotencyKeyReused  Code = "idempotency_key_reused"
+	CodeInternal              Code = "internal_error"
+	CodeMailUnavailable       Code = "mail_unavailable"
+)
+
+// FieldError is one invalid field of a request that failed validation.
+type FieldError struct {
+	// JSON name of the field (or query parameter), with the index for list items: roles[0]
+	Field string `json:"field"`
+	// The failed rule, e.g. required, email, oneof
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Sentinels to match an *Error against with errors.Is, by its code.
+var (
+	ErrInvalidJSON             = newSentinel(CodeInvalidJSON, "request body is not valid JSON")
+	ErrInvalidID               = newSentinel(CodeInvalidID, "invalid id")
+	ErrValidation              = newSentinel(CodeValidationFailed, "validation failed")
+	ErrInvalidRole             = newSentinel(CodeInvalidRole, "invalid role")
+	ErrInvalidCursor           = newSentinel(CodeInvalidCursor, "invalid pagination cursor")
+	ErrInvalidFormat           = newSentinel(CodeInvalidFormat, "invalid format")
+	ErrInvalidInvitation       = newSentinel(CodeInvalidInvitation, "invitation is invalid, expired or revoked")
+	ErrInvalidProfile          = newSentinel(CodeInvalidProfile, "invalid profile")
+	ErrAlreadyExists           = newSentinel(CodeAlreadyExists, "already exists")
+	ErrInvalidCredentials      = newSentinel(CodeInvalidCredentials, "invalid credentials")
+	ErrInvalidToken            = newSentinel(CodeInvalidToken, "invalid token")
+	ErrUnauthorized            = newSentinel(CodeUnauthorized, "unauthorized")
+	ErrImpersonationNotAllowed = newSentinel(CodeImpersonationBlocked, "not allowed while impersonating")
+	ErrNotFound                = newSentinel(CodeNotFound, "not found")
+	ErrConflict                = newSentinel(CodeConflict, "conflict")
+	ErrIdempotencyKeyInUse     = newSentinel(CodeIdempotencyKeyInUse, "a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyReused    = newSentinel(CodeIdempotencyKeyReused, "idempotency key was already used with a different request body")
+	ErrRestoreWindowExpired    = newSentinel(CodeRestoreWindowExpired, "restore window expired")
+	ErrUserErased              = newSentinel(CodeUserErased, "user has been erased")
+	ErrPreconditionFailed      = newSentinel(CodePreconditionFailed, "precondition failed")
+	ErrRequestTooLarge         = newSentinel(CodeRequestTooLarge, "request body too large")
+	ErrMailUnavailable         = newSentinel(CodeMailUnavailable, "mail unavailable")
+)
+
+// Error is an error response. Responses that aren't problem+json, e.g. from a proxy, have no Code.
+type Error struct {
+	Status    int
+	Code      Code
+	Title     string
+	Detail    string
+	RequestID string
+	// Set when Code is validation_failed
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	message := e.Title
+	if e.Detail != "" {
+		message = e.Detail
+	}
+	if e.Code == "" {
+		return fmt.Sprintf("user-manager: %d %s", e.Status, message)
+	}
+	return fmt.Sprintf("user-manager: %d %s: %s", e.Status, e.Code, message)
+}
+
+// Is reports whether target is a sentinel with the same code, so errors.Is(err, client.ErrNotFound) works.
+func (e *Error) Is(target error) bool {
+	s, ok := target.(*sentinel)
+	return ok && e.Code != "" && s.code == e.Code
+}
+
+type sentinel struct {
+	code    Code
+	message string
+}
+
+func newSentinel(code Code, message string) error {
+	return &sentinel{code: code, message: message}
+}
+
+func (s *sentinel) Error() string {
+	return "user-manager: " + s.message
+}
+
+// The RFC 7807 body of API errors.
+type problem struct {
+	Title     string       `json:"title"`
+	Detail    string       `json:"detail"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id"`
+	Errors    []FieldError `json:"errors"`
+}
+
+// Helpers
+func decodeError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	apiErr := &Error{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode), RequestID: resp.Header.Get("X-Request-ID")}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/problem+json" {
+		io.Copy(io.Discard, resp.Body)
+		return apiErr
+	}
+
+	var body problem
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return apiErr
+	}
+	apiErr.Code = body.Code
+	apiErr.Title = body.Title
+	apiErr.Detail = body.Detail
+	apiErr.Fields = body.Errors
+	if body.RequestID != "" {
+		apiErr.RequestID = body.RequestID
+	}
+	return apiErr
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"github.com/danilobml/user-manager/internal/user/bulkio"
+	"github.com/danilobml/user-manager/internal/user/dtos"
+	"github.com/danilobml/user-manager/internal/user/model"
+)
+
+// The API's request and response types.
+type (
+	RegisterRequest             = dtos.RegisterRequest
+	RegisterResponse            = dtos.RegisterResponse
+	LoginRequest                = dtos.LoginRequest
+	LoginResponse               = dtos.LoginResponse
+	RequestPasswordResetRequest = dtos.RequestPasswordResetRequest
+	ResetPasswordRequest        = dtos.ResetPasswordRequest
+	ConfirmErasureRequest       = dtos.ConfirmErasureRequest
+	AcceptInvitationRequest     = dtos.AcceptInvitationRequest
+	AcceptInvitationResponse    = dtos.AcceptInvitationResponse
+	CheckUserRequest            = dtos.CheckUserRequest
+	CheckUserResponse           = dtos.CheckUserResponse
+	// ID picks the user and ExpectedVersion, when set, is sent as If-Match
+	UpdateUserRequest         = dtos.UpdateUserRequest
+	PatchUserRequest          = dtos.PatchUserRequest
+	UpdateProfileRequest      = dtos.UpdateProfileRequest
+	AssignRolesRequest        = dtos.AssignRolesRequest
+	ListUsersRequest          = dtos.ListUsersRequest
+	GetAllUsersResponse       = dtos.GetAllUsersResponse
+	ImportOptions             = dtos.ImportOptions
+	ImportReport              = dtos.ImportReport
+	ImportRowResult           = dtos.ImportRowResult
+	CreateInvitationRequest   = dtos.CreateInvitationRequest
+	CreateOrganizationRequest = dtos.CreateOrganizationRequest
+	ImpersonateResponse       = dtos.ImpersonateResponse
+	User                      = dtos.ResponseUser
+	UserExport                = dtos.UserExport
+	Invitation                = dtos.ResponseInvitation
+	Organization              = model.Organization
+	Format                    = bulkio.Format
+)
+
+// Bulk import and export file formats.
+const (
+	CSV   = bulkio.CSV
+	JSONL = bulkio.JSONL
+)